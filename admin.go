@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// runDeliveries implements the deliveries subcommand, for inspecting and replaying reminders that
+// moved to the failed status after their delivery attempts ran out:
+//
+//	goremindbot deliveries failed            list failed reminders with their last error
+//	goremindbot deliveries show TASK_ID      show every delivery attempt of a task
+//	goremindbot deliveries replay TASK_ID... send failed reminders again; "all" replays every one
+//
+// A running bot picks up replayed reminders at its next reconciliation.
+func runDeliveries(args []string) int {
+	if len(args) == 0 {
+		args = []string{"failed"}
+	}
+
+	store, err := InitDatabase(getEnv("DATABASE_URL", DefaultDatabaseURL), SystemClock)
+	if err != nil {
+		log.Printf("Failed to initialize database: %v", err)
+		return 1
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "failed":
+		tasks, err := store.GetFailedTasks()
+		if err != nil {
+			log.Printf("%v", err)
+			return 1
+		}
+		if len(tasks) == 0 {
+			fmt.Println("No failed reminders")
+			return 0
+		}
+		for _, task := range tasks {
+			lastError := ""
+			if attempts, err := store.GetDeliveryAttempts(task.ID); err == nil && len(attempts) > 0 {
+				last := attempts[len(attempts)-1]
+				lastError = fmt.Sprintf("%s: %s", last.ErrorClass, last.Error)
+			}
+			fmt.Printf("#%d  user %d  due %s  %d %s  %q\n      %s\n",
+				task.ID, task.User.TelegramID, task.DueDateTime.Format(time.RFC3339),
+				task.DeliveryAttempts, pluralize(task.DeliveryAttempts, "attempt", "attempts"), task.Title, lastError)
+		}
+		return 0
+
+	case "show":
+		if len(args) != 2 {
+			log.Printf("Usage: goremindbot deliveries show TASK_ID")
+			return 2
+		}
+		taskID, err := strconv.ParseUint(args[1], 10, 0)
+		if err != nil {
+			log.Printf("Invalid task ID %q", args[1])
+			return 2
+		}
+		attempts, err := store.GetDeliveryAttempts(uint(taskID))
+		if err != nil {
+			log.Printf("%v", err)
+			return 1
+		}
+		if len(attempts) == 0 {
+			fmt.Printf("No delivery attempts for task %d\n", taskID)
+			return 0
+		}
+		for _, attempt := range attempts {
+			outcome := "sent"
+			if attempt.ErrorClass != "" {
+				outcome = fmt.Sprintf("%s: %s", attempt.ErrorClass, attempt.Error)
+			}
+			retry := ""
+			if attempt.NextRetryAt != nil {
+				retry = ", retry at " + attempt.NextRetryAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%s  attempt %d by %s  %s%s\n",
+				attempt.CreatedAt.Format(time.RFC3339), attempt.Attempt, attempt.WorkerID, outcome, retry)
+		}
+		return 0
+
+	case "replay":
+		if len(args) < 2 {
+			log.Printf("Usage: goremindbot deliveries replay TASK_ID... | all")
+			return 2
+		}
+		var taskIDs []uint
+		if len(args) == 2 && args[1] == "all" {
+			tasks, err := store.GetFailedTasks()
+			if err != nil {
+				log.Printf("%v", err)
+				return 1
+			}
+			for _, task := range tasks {
+				taskIDs = append(taskIDs, task.ID)
+			}
+		} else {
+			for _, arg := range args[1:] {
+				taskID, err := strconv.ParseUint(arg, 10, 0)
+				if err != nil {
+					log.Printf("Invalid task ID %q", arg)
+					return 2
+				}
+				taskIDs = append(taskIDs, uint(taskID))
+			}
+		}
+
+		replayed := 0
+		for _, taskID := range taskIDs {
+			if err := store.ReplayTask(taskID); err != nil {
+				log.Printf("%v", err)
+				continue
+			}
+			replayed++
+		}
+		fmt.Printf("Replayed %d of %d %s\n", replayed, len(taskIDs), pluralize(len(taskIDs), "reminder", "reminders"))
+		if replayed < len(taskIDs) {
+			return 1
+		}
+		return 0
+
+	default:
+		log.Printf("Unknown deliveries command %q, expected failed, show or replay", args[0])
+		return 2
+	}
+}
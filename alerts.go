@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits on the alerts a task can have ahead of its due time
+const (
+	maxAlerts      = 5
+	maxAlertOffset = 4 * 7 * 24 * time.Hour
+)
+
+var (
+	// reAlertOffset matches one alert offset such as "30m", "2 hours", "1d" or "1 week"
+	reAlertOffset = regexp.MustCompile(`^(\d+)\s*(m|mins?|minutes?|h|hrs?|hours?|d|days?|w|wks?|weeks?)$`)
+	// reAlertArg splits typed alert offsets like "1d, 2 hours 30m" into their entries
+	reAlertArg = regexp.MustCompile(`\d+\s*[[:alpha:]]+|[^\s,]+`)
+)
+
+// ParseAlertOffset parses how long before the due time an alert goes out, e.g. "30m", "2 hours",
+// "1d" or "1w"
+func ParseAlertOffset(text string) (time.Duration, error) {
+	m := reAlertOffset.FindStringSubmatch(strings.ToLower(strings.TrimSpace(text)))
+	if m == nil {
+		return 0, fmt.Errorf("invalid alert %q, expected a duration like 30m, 1h, 1d or 1w", text)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid alert %q, expected a duration like 30m, 1h, 1d or 1w", text)
+	}
+
+	unit := time.Minute
+	switch m[2][0] {
+	case 'h':
+		unit = time.Hour
+	case 'd':
+		unit = 24 * time.Hour
+	case 'w':
+		unit = 7 * 24 * time.Hour
+	}
+	offset := time.Duration(n) * unit
+	if offset > maxAlertOffset {
+		return 0, fmt.Errorf("alert %q is too early, alerts can be at most %s before", text, describeDuration(maxAlertOffset))
+	}
+	return offset, nil
+}
+
+// ParseAlertOffsets parses a list of alert offsets and returns them without duplicates, earliest
+// alert first
+func ParseAlertOffsets(values []string) ([]time.Duration, error) {
+	var offsets []time.Duration
+	for _, value := range values {
+		offset, err := ParseAlertOffset(value)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(offsets, offset) {
+			offsets = append(offsets, offset)
+		}
+	}
+	if len(offsets) > maxAlerts {
+		return nil, fmt.Errorf("a task can have at most %d alerts, got %d", maxAlerts, len(offsets))
+	}
+	slices.SortFunc(offsets, func(a, b time.Duration) int { return int(b - a) })
+	return offsets, nil
+}
+
+// FormatAlertOffsets returns the stored form of alert offsets, e.g. "1d,1h"
+func FormatAlertOffsets(offsets []time.Duration) string {
+	parts := make([]string, len(offsets))
+	for i, offset := range offsets {
+		switch {
+		case offset%(7*24*time.Hour) == 0:
+			parts[i] = fmt.Sprintf("%dw", offset/(7*24*time.Hour))
+		case offset%(24*time.Hour) == 0:
+			parts[i] = fmt.Sprintf("%dd", offset/(24*time.Hour))
+		case offset%time.Hour == 0:
+			parts[i] = fmt.Sprintf("%dh", offset/time.Hour)
+		default:
+			parts[i] = fmt.Sprintf("%dm", offset/time.Minute)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// canonicalAlerts parses the alerts of a parsed reminder and returns their stored form
+func canonicalAlerts(values []string) (string, error) {
+	offsets, err := ParseAlertOffsets(values)
+	if err != nil {
+		return "", err
+	}
+	return FormatAlertOffsets(offsets), nil
+}
+
+// splitAlertArgs splits alert offsets typed by the user, e.g. "1d, 2 hours 30m"
+func splitAlertArgs(text string) []string {
+	return reAlertArg.FindAllString(text, -1)
+}
+
+// alertList splits stored alert offsets into their entries
+func alertList(stored string) []string {
+	if stored == "" {
+		return nil
+	}
+	return strings.Split(stored, ",")
+}
+
+// describeAlerts renders stored alert offsets for people, e.g. "1 day and 1 hour before"
+func describeAlerts(stored string) string {
+	offsets, err := ParseAlertOffsets(alertList(stored))
+	if err != nil || len(offsets) == 0 {
+		return ""
+	}
+	parts := make([]string, len(offsets))
+	for i, offset := range offsets {
+		parts[i] = describeDuration(offset)
+	}
+	if len(parts) == 1 {
+		return parts[0] + " before"
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1] + " before"
+}
+
+// describeDuration renders a duration for people with its two largest units, e.g. "1 day 2 hours"
+// or "45 minutes"
+func describeDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Minute {
+		return "less than a minute"
+	}
+
+	units := []struct {
+		size             time.Duration
+		singular, plural string
+	}{
+		{7 * 24 * time.Hour, "week", "weeks"},
+		{24 * time.Hour, "day", "days"},
+		{time.Hour, "hour", "hours"},
+		{time.Minute, "minute", "minutes"},
+	}
+	var parts []string
+	for _, unit := range units {
+		if n := int(d / unit.size); n > 0 && len(parts) < 2 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, pluralize(n, unit.singular, unit.plural)))
+			d -= time.Duration(n) * unit.size
+		} else if len(parts) > 0 {
+			break
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// pendingTaskAlerts builds the unsaved alerts of a task that are still ahead of now. Alerts in sent
+// that already went out for the same time aren't built again, so an edit that keeps the due time
+// doesn't repeat them.
+func pendingTaskAlerts(task *Task, now time.Time, sent []TaskAlert) []TaskAlert {
+	offsets, err := ParseAlertOffsets(alertList(task.AlertOffsets))
+	if err != nil {
+		return nil
+	}
+
+	var alerts []TaskAlert
+	for _, offset := range offsets {
+		alertAt := task.DueDateTime.Add(-offset).UTC()
+		if !alertAt.After(now) {
+			continue
+		}
+		alreadySent := slices.ContainsFunc(sent, func(a TaskAlert) bool {
+			return a.SentAt != nil && a.AlertAt.Equal(alertAt)
+		})
+		if !alreadySent {
+			alerts = append(alerts, TaskAlert{TaskID: task.ID, OffsetMinutes: int(offset / time.Minute), AlertAt: alertAt})
+		}
+	}
+	return alerts
+}
+
+// applyDefaultAlerts gives parsed reminders that don't ask for alerts of their own the user's
+// default alerts
+func applyDefaultAlerts(payloads []ReminderPayload, user *User) {
+	if user.DefaultAlerts == "" {
+		return
+	}
+	for i := range payloads {
+		if len(payloads[i].Alerts) == 0 {
+			payloads[i].Alerts = alertList(user.DefaultAlerts)
+		}
+	}
+}
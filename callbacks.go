@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// handleTaskCallback handles buttons in the "task" namespace, e.g. "v1:task:42:done"
+func (d *Dispatcher) handleTaskCallback(ctx *CallbackContext) CallbackResult {
+	task, err := ctx.Store.GetUserTask(ctx.User.ID, uint(ctx.Data.ID))
+	if err != nil {
+		return CallbackResult{Answer: "This task no longer exists"}
+	}
+	if task.Status != "pending" {
+		return CallbackResult{Answer: fmt.Sprintf("This task is already %s", task.Status)}
+	}
+
+	switch ctx.Data.Action {
+	case "done":
+		if err := ctx.Store.MarkTaskAsCompleted(task.ID); err != nil {
+			log.Printf("Error completing task %d: %v", task.ID, err)
+			return CallbackResult{Answer: "❌ Failed to mark task as completed"}
+		}
+		return CallbackResult{Answer: "✅ Marked as completed", EditText: fmt.Sprintf("✅ Completed: %s", task.Title)}
+	case "snooze":
+		return d.handleSnoozeCallback(ctx, task)
+	case "cancel", "delete":
+		return handleRemoveCallback(ctx, task)
+	case "undo":
+		return handleUndoCallback(ctx, task)
+	default:
+		return CallbackResult{Answer: "Unknown action"}
+	}
+}
+
+// handleRemoveCallback handles cancel/delete buttons from /mytasks and the recurring series confirmation
+func handleRemoveCallback(ctx *CallbackContext, task *Task) CallbackResult {
+	action := ctx.Data.Action
+	scope := ""
+	if len(ctx.Data.Args) > 0 {
+		scope = ctx.Data.Args[0]
+	}
+
+	switch scope {
+	case "keep":
+		return CallbackResult{Answer: "👍 Kept", EditText: fmt.Sprintf("👍 Kept '%s'.", task.Title)}
+	case "":
+		// A cancel button in /mytasks; recurring tasks ask first
+		if task.Recurrence != nil {
+			text, keyboard := removalConfirmation(task, action)
+			return CallbackResult{EditText: text, Keyboard: keyboard}
+		}
+		if _, err := removeTask(ctx.Store, task, action, false); err != nil {
+			log.Printf("Error removing task %d: %v", task.ID, err)
+			return CallbackResult{Answer: fmt.Sprintf("❌ Failed to %s the task", action)}
+		}
+		// Refresh the task list in place
+		text, keyboard := handleMyTasksCommand(ctx.Store, ctx.User)
+		return CallbackResult{Answer: removedAnswer(task, action), EditText: text, Keyboard: keyboard}
+	case "one", "series":
+		response, err := removeTask(ctx.Store, task, action, scope == "series")
+		if err != nil {
+			log.Printf("Error removing task %d: %v", task.ID, err)
+			return CallbackResult{Answer: fmt.Sprintf("❌ Failed to %s the task", action)}
+		}
+		return CallbackResult{Answer: "Done", EditText: response}
+	default:
+		return CallbackResult{Answer: "Unknown action"}
+	}
+}
+
+// removedAnswer is the callback answer once a task was cancelled or deleted
+func removedAnswer(task *Task, action string) string {
+	if action == "delete" {
+		return fmt.Sprintf("🗑 Deleted '%s'", task.Title)
+	}
+	return fmt.Sprintf("❌ Cancelled '%s'", task.Title)
+}
+
+// handleUndoCallback deletes a task that was just created from a message and refreshes the
+// confirmation so it lists only the tasks that are left
+func handleUndoCallback(ctx *CallbackContext, task *Task) CallbackResult {
+	if err := ctx.Store.DeleteTask(task.ID); err != nil {
+		log.Printf("Error undoing task %d: %v", task.ID, err)
+		return CallbackResult{Answer: "❌ Failed to undo the task"}
+	}
+
+	message := ctx.Query.Message
+	remaining, err := ctx.Store.FindTasksByMessage(ctx.User.ID, message.Chat.ID, message.MessageID)
+	if err != nil {
+		log.Printf("Error refreshing confirmation for task %d: %v", task.ID, err)
+		return CallbackResult{Answer: fmt.Sprintf("↩️ Removed '%s'", task.Title), EditText: fmt.Sprintf("↩️ Removed '%s'.", task.Title)}
+	}
+
+	text, keyboard := reminderConfirmation("", remaining, ctx.User.Timezone)
+	if len(remaining) > 0 {
+		text = fmt.Sprintf("↩️ Removed '%s'.\n\n%s", task.Title, text)
+	}
+	return CallbackResult{Answer: fmt.Sprintf("↩️ Removed '%s'", task.Title), EditText: text, Keyboard: keyboard}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// maxClarificationRounds is how many follow-up questions one reminder may need before giving up
+	maxClarificationRounds = 3
+	// maxClarificationOptions is how many candidate answers are offered as buttons
+	maxClarificationOptions = 4
+)
+
+// reminderDraft is a reminder message together with the answers the user gave to follow-up questions
+type reminderDraft struct {
+	ID              uint64
+	Original        string
+	Answers         []clarificationAnswer
+	Question        string   // the open question, if any
+	Options         []string // candidate answers to the open question
+	PromptMessageID int      // the bot message asking the open question
+}
+
+type clarificationAnswer struct {
+	Question string
+	Answer   string
+}
+
+// Message returns the text sent to the parser: the original message followed by the questions
+// asked so far and their answers, one "Q:"/"A:" pair each
+func (d *reminderDraft) Message() string {
+	var b strings.Builder
+	b.WriteString(d.Original)
+	for _, a := range d.Answers {
+		fmt.Fprintf(&b, "\nQ: %s\nA: %s", a.Question, a.Answer)
+	}
+	return b.String()
+}
+
+// withAnswer returns a copy of the draft with the open question answered
+func (d *reminderDraft) withAnswer(answer string) *reminderDraft {
+	answers := append([]clarificationAnswer(nil), d.Answers...)
+	answers = append(answers, clarificationAnswer{Question: d.Question, Answer: answer})
+	return &reminderDraft{Original: d.Original, Answers: answers}
+}
+
+// askClarification shows the parser's follow-up question in place of the placeholder, with a
+// button per candidate answer, and remembers the draft until the user answers
+func (d *Dispatcher) askClarification(chatID int64, placeholderMessageID int, draft *reminderDraft, result *ParseResult) {
+	if len(draft.Answers) >= maxClarificationRounds {
+		editOrSendMessage(d.bot, chatID, placeholderMessageID,
+			"❌ Sorry, I still couldn't work out when to remind you. Please send the reminder again with an exact date and time.", nil)
+		return
+	}
+
+	draft.ID = d.clarificationSeq.Add(1)
+	draft.Question = result.Question
+	draft.Options = result.Options
+	if len(draft.Options) > maxClarificationOptions {
+		draft.Options = draft.Options[:maxClarificationOptions]
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for i, option := range draft.Options {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(option, NewCallbackData("clarify", uint(draft.ID), "pick", strconv.Itoa(i))))
+		if len(row) == 2 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✖️ Never mind", NewCallbackData("clarify", uint(draft.ID), "dismiss"))))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	text := "❓ " + draft.Question + "\n\nTap an answer or reply with your own."
+	if len(draft.Options) == 0 {
+		text = "❓ " + draft.Question + "\n\nReply with your answer."
+	}
+	draft.PromptMessageID = editOrSendMessage(d.bot, chatID, placeholderMessageID, text, &keyboard)
+	d.clarifications.Set(chatID, draft)
+}
+
+// answerClarification treats a text message as the answer to the chat's open follow-up question.
+// It returns false if there is no open question.
+func (d *Dispatcher) answerClarification(message *tgbotapi.Message, user *User, text string) bool {
+	draft, ok := d.clarifications.Take(message.Chat.ID)
+	if !ok {
+		return false
+	}
+
+	// Keep the question and answer on the question message and drop its buttons
+	if draft.PromptMessageID != 0 {
+		edit := tgbotapi.NewEditMessageText(message.Chat.ID, draft.PromptMessageID, fmt.Sprintf("❓ %s\n💬 %s", draft.Question, text))
+		if _, err := d.bot.Send(edit); err != nil {
+			log.Printf("Error editing clarification message %d: %v", draft.PromptMessageID, err)
+		}
+	}
+
+	d.startReminder(user, draft.withAnswer(text), message.Chat.ID, message.MessageID)
+	return true
+}
+
+// handleClarifyCallback handles the answer and Never mind buttons of a follow-up question
+func (d *Dispatcher) handleClarifyCallback(ctx *CallbackContext) CallbackResult {
+	chatID := ctx.Query.Message.Chat.ID
+	draft, ok := d.clarifications.Get(chatID)
+	if !ok || draft.ID != ctx.Data.ID {
+		return CallbackResult{Answer: "This question has expired", EditText: "⌛ This question has expired. Please send your reminder again."}
+	}
+
+	switch ctx.Data.Action {
+	case "dismiss":
+		d.clarifications.Delete(chatID)
+		return CallbackResult{Answer: "OK", EditText: "✖️ Never mind, nothing was scheduled."}
+	case "pick":
+		if len(ctx.Data.Args) == 0 {
+			return CallbackResult{Answer: "Unknown action"}
+		}
+		i, err := strconv.Atoi(ctx.Data.Args[0])
+		if err != nil || i < 0 || i >= len(draft.Options) {
+			return CallbackResult{Answer: "Unknown action"}
+		}
+		d.clarifications.Delete(chatID)
+
+		answer := draft.Options[i]
+		d.startReminder(ctx.User, draft.withAnswer(answer), chatID, ctx.Query.Message.MessageID)
+		return CallbackResult{Answer: answer, EditText: fmt.Sprintf("❓ %s\n💬 %s", draft.Question, answer)}
+	default:
+		return CallbackResult{Answer: "Unknown action"}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import "time"
+
+// Clock tells the time and sets timers. The scheduler, the stores, the parsers and the handlers
+// read the time through one, so tests can use a FakeClock instead of waiting for real time to pass.
+type Clock interface {
+	Now() time.Time
+	// NewTimer returns a timer that fires once d has passed on this clock
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is the part of *time.Timer the scheduler uses
+type Timer interface {
+	// C delivers the time when the timer fires
+	C() <-chan time.Time
+	// Reset makes the timer fire after d instead, discarding a pending expiry
+	Reset(d time.Duration) bool
+	// Stop prevents the timer from firing
+	Stop() bool
+}
+
+// SystemClock is the real wall clock
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer { return systemTimer{time.NewTimer(d)} }
+
+type systemTimer struct{ *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time { return t.Timer.C }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// FakeClock is a Clock that only moves when told to. Timers fire as Advance or Set moves the
+// clock past their expiry, so e.g. a reminder due "at 09:00 tomorrow" can be delivered in a test
+// without waiting, and minute boundaries and DST transitions can be hit exactly.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFakeClock creates a FakeClock set to now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the clock's current time
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d and fires the timers that expire on the way
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	now := c.now.Add(d)
+	c.mu.Unlock()
+	c.Set(now)
+}
+
+// Set moves the clock to now and fires the timers that expire by then. Moving it backwards
+// fires nothing.
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+	c.timers = slices.DeleteFunc(c.timers, func(t *fakeTimer) bool {
+		if t.expires.After(now) {
+			return false
+		}
+		select {
+		case t.c <- now:
+		default:
+		}
+		return true
+	})
+}
+
+// Timers returns how many timers are waiting to fire, so a test can tell that the code under
+// test has gone to sleep before advancing the clock
+func (c *FakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// NewTimer returns a timer that fires once the clock has moved d past its current time
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+type fakeTimer struct {
+	clock   *FakeClock
+	c       chan time.Time
+	expires time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	active := t.Stop()
+
+	c := t.clock
+	c.mu.Lock()
+	t.expires = c.now.Add(d)
+	if d <= 0 {
+		t.c <- c.now
+	} else {
+		c.timers = append(c.timers, t)
+	}
+	c.mu.Unlock()
+	return active
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Like time.Timer since Go 1.23, a stopped or reset timer never delivers a stale expiry
+	select {
+	case <-t.c:
+	default:
+	}
+	active := slices.Contains(c.timers, t)
+	c.timers = slices.DeleteFunc(c.timers, func(other *fakeTimer) bool { return other == t })
+	return active
+}
@@ -2,12 +2,16 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"strconv"
 	"strings"
 	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 // handleSetTimezoneCommand handles the /settimezone command
-func handleSetTimezoneCommand(text string, user *User) string {
+func handleSetTimezoneCommand(store Store, text string, user *User, now time.Time) string {
 	parts := strings.Fields(text)
 	if len(parts) < 2 {
 		// Show available timezones
@@ -32,31 +36,189 @@ func handleSetTimezoneCommand(text string, user *User) string {
 	}
 
 	// Update user's timezone
-	err = UpdateUserTimezone(user.ID, timezone)
+	err = store.UpdateUserTimezone(user.ID, timezone)
 	if err != nil {
 		return "❌ Failed to update timezone. Please try again."
 	}
 
 	// Show current time in user's timezone
-	now := time.Now().UTC()
-	userTime, _ := ConvertToUserTimezone(now, timezone)
+	userTime, _ := ConvertToUserTimezone(now.UTC(), timezone)
 
 	return fmt.Sprintf("✅ Timezone updated to %s\n\nCurrent time: %s",
 		timezone, userTime.Format("2006-01-02 15:04:05 MST"))
 }
 
-// handleMyTasksCommand handles the /mytasks command
-func handleMyTasksCommand(user *User) string {
-	tasks, err := GetUserTasks(user.ID)
+// handleQuietCommand handles the /quiet command, which shows or sets the user's daily quiet hours,
+// e.g. "/quiet 22:00-07:00", "/quiet 10pm-7am silent" or "/quiet off"
+func handleQuietCommand(store Store, text string, user *User) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(text, "/quiet"))
+	if arg == "" {
+		return fmt.Sprintf("🌙 Quiet hours: %s\n\nSet them with e.g. `/quiet 22:00-07:00`, or turn them off with `/quiet off`. "+
+			"`/quiet silent` sends reminders during them without sound and `/quiet defer` holds them until the end. "+
+			"Urgent reminders always come through, e.g. \"Urgent: call the hospital at 2 AM\".", describeQuietHours(user))
+	}
+
+	// A trailing "silent" or "defer" picks what happens to reminders during the quiet hours
+	mode := user.QuietMode
+	if mode == "" {
+		mode = QuietModeDefer
+	}
+	fields := strings.Fields(arg)
+	if last := strings.ToLower(fields[len(fields)-1]); last == QuietModeSilent || last == QuietModeDefer {
+		mode = last
+		arg = strings.TrimSpace(strings.Join(fields[:len(fields)-1], " "))
+	}
+
+	start, end := user.QuietHoursStart, user.QuietHoursEnd
+	switch {
+	case strings.EqualFold(arg, "off"):
+		start, end = "", ""
+	case arg != "":
+		var err error
+		start, end, err = ParseQuietHours(arg)
+		if err != nil {
+			return fmt.Sprintf("❌ %v", err)
+		}
+	}
+
+	if err := store.UpdateUserQuietHours(user.ID, start, end, mode); err != nil {
+		return "❌ Failed to update your quiet hours. Please try again."
+	}
+	resumeDeferredReminders(store, user)
+	if start == "" {
+		if arg == "" {
+			return fmt.Sprintf("✅ During do not disturb, %s.", describeQuietMode(mode))
+		}
+		return "🔔 Quiet hours turned off. Reminders arrive whenever they're due."
+	}
+	return fmt.Sprintf("✅ Quiet hours set to %s-%s (%s): %s. Urgent reminders still come through.", start, end, user.Timezone, describeQuietMode(mode))
+}
+
+// handleDNDCommand handles the /dnd command, which turns do not disturb on for a while, e.g.
+// "/dnd 2h", or off again with "/dnd off"
+func handleDNDCommand(store Store, text string, user *User, now time.Time) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(text, "/dnd"))
+	if arg == "" {
+		if user.DNDUntil != nil && user.DNDUntil.After(now) {
+			return fmt.Sprintf("🔕 Do not disturb is on until %s. Turn it off with `/dnd off`.",
+				FormatTaskDateTime(*user.DNDUntil, user.Timezone))
+		}
+		return "🔔 Do not disturb is off. Turn it on for a while with e.g. `/dnd 2h` or `/dnd 30m`."
+	}
+
+	if strings.EqualFold(arg, "off") {
+		if err := store.UpdateUserDND(user.ID, nil); err != nil {
+			return "❌ Failed to turn off do not disturb. Please try again."
+		}
+		resumeDeferredReminders(store, user)
+		return "🔔 Do not disturb turned off."
+	}
+
+	duration, err := parseSnoozeDuration(arg)
+	if err != nil || duration > maxDND {
+		return fmt.Sprintf("❌ Usage: /dnd <duration>, e.g. /dnd 2h, up to %s, or /dnd off", describeDuration(maxDND))
+	}
+	until := now.Add(duration).UTC()
+	if err := store.UpdateUserDND(user.ID, &until); err != nil {
+		return "❌ Failed to turn on do not disturb. Please try again."
+	}
+	return fmt.Sprintf("🔕 Do not disturb until %s: %s. Urgent reminders still come through.",
+		FormatTaskDateTime(until, user.Timezone), describeQuietMode(user.QuietMode))
+}
+
+// resumeDeferredReminders sends the reminders held back for a quiet period that may have just ended
+func resumeDeferredReminders(store Store, user *User) {
+	taskIDs, err := store.ResumeDeferredReminders(user.ID)
 	if err != nil {
-		return "❌ Failed to retrieve your tasks. Please try again."
+		log.Printf("Error resuming deferred reminders for user %d: %v", user.TelegramID, err)
+	} else if len(taskIDs) > 0 {
+		log.Printf("Resumed %d deferred %s for user %d", len(taskIDs), pluralize(len(taskIDs), "reminder", "reminders"), user.TelegramID)
+	}
+}
+
+// handleNagCommand handles the /nag command, which shows or sets how new reminders are repeated
+// until they're marked done, e.g. "/nag 10m", "/nag 15m 3" or "/nag off"
+func handleNagCommand(store Store, text string, user *User) string {
+	parts := strings.Fields(strings.TrimPrefix(text, "/nag"))
+	if len(parts) == 0 {
+		current := "off"
+		if user.NagEveryMinutes != 0 {
+			current = describeNag(user.NagEveryMinutes, user.NagRepeats)
+		}
+		return fmt.Sprintf("📣 Nagging for new reminders: %s\n\nRepeat reminders until you mark them done with e.g. `/nag 10m` or `/nag 15m 3` "+
+			"(every 15 minutes, up to 3 times), or turn it off with `/nag off`. "+
+			"You can also ask for it in a reminder, e.g. \"Take out the trash at 8 PM, keep reminding me every 15 minutes\".", current)
+	}
+	if len(parts) > 2 {
+		return "❌ Usage: /nag <interval> [times], e.g. /nag 10m 5, or /nag off"
+	}
+
+	repeats := 0
+	if len(parts) == 2 {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(parts[1]), "x"))
+		if err != nil {
+			return "❌ Usage: /nag <interval> [times], e.g. /nag 10m 5, or /nag off"
+		}
+		repeats = n
+	}
+	every, repeats, err := nagPolicy(parts[0], repeats)
+	if err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+
+	if err := store.UpdateUserNagPolicy(user.ID, every, repeats); err != nil {
+		return "❌ Failed to update your nagging. Please try again."
+	}
+	if every == 0 {
+		return "🔕 Nagging turned off. New reminders are sent once."
+	}
+	return fmt.Sprintf("✅ New reminders will be repeated %s, until you mark them done.", describeNag(every, repeats))
+}
+
+// handleAlertsCommand handles the /alerts command, which shows or sets the early alerts new tasks get
+// when the message doesn't ask for its own, e.g. "/alerts 1d 1h" or "/alerts off"
+func handleAlertsCommand(store Store, text string, user *User) string {
+	parts := splitAlertArgs(strings.TrimPrefix(text, "/alerts"))
+	if len(parts) == 0 {
+		current := "none"
+		if user.DefaultAlerts != "" {
+			current = describeAlerts(user.DefaultAlerts)
+		}
+		return fmt.Sprintf("🔔 Default alerts for new reminders: %s\n\nSet them with e.g. `/alerts 1d 1h` or `/alerts 30m`, or turn them off with `/alerts off`. "+
+			"You can also ask for alerts in a reminder, e.g. \"Dentist on Friday at 4 PM, remind me a day before\".", current)
+	}
+
+	var alerts string
+	if len(parts) > 1 || strings.ToLower(parts[0]) != "off" {
+		var err error
+		alerts, err = canonicalAlerts(parts)
+		if err != nil {
+			return fmt.Sprintf("❌ %v", err)
+		}
+	}
+
+	if err := store.UpdateUserDefaultAlerts(user.ID, alerts); err != nil {
+		return "❌ Failed to update your default alerts. Please try again."
+	}
+	if alerts == "" {
+		return "🔕 Default alerts turned off. New reminders only fire at their due time."
+	}
+	return fmt.Sprintf("✅ New reminders will also alert you %s.", describeAlerts(alerts))
+}
+
+// handleMyTasksCommand handles the /mytasks command. Pending tasks get a cancel button each.
+func handleMyTasksCommand(store Store, user *User) (string, *tgbotapi.InlineKeyboardMarkup) {
+	tasks, err := store.GetUserTasks(user.ID)
+	if err != nil {
+		return "❌ Failed to retrieve your tasks. Please try again.", nil
 	}
 
 	if len(tasks) == 0 {
-		return "📝 You don't have any active tasks yet.\n\nSend me a message like 'Remind me to buy groceries tomorrow at 2 PM' to create your first task!"
+		return "📝 You don't have any active tasks yet.\n\nSend me a message like 'Remind me to buy groceries tomorrow at 2 PM' to create your first task!", nil
 	}
 
 	response := "📋 Your active tasks:\n\n"
+	var buttons []tgbotapi.InlineKeyboardButton
 	for i, task := range tasks {
 		formattedTime := FormatTaskDateTime(task.DueDateTime, user.Timezone)
 		status := "⏰"
@@ -65,30 +227,183 @@ func handleMyTasksCommand(user *User) string {
 			status = "✅"
 		case "cancelled":
 			status = "❌"
+		case "missed":
+			status = "⚠️"
+		case "failed":
+			status = "📭"
 		}
 
-		response += fmt.Sprintf("%d. %s %s - %s at %s\n\n",
-			i+1, status, task.Title, task.Description, formattedTime)
+		response += fmt.Sprintf("%d. %s %s - %s at %s (#%d)\n",
+			i+1, status, task.Title, task.Description, formattedTime, task.ID)
+		if rule, err := TaskRecurrence(&task); err == nil && rule != nil {
+			response += fmt.Sprintf("   🔁 Repeats %s\n", rule.Describe())
+		}
+		if alerts := describeAlerts(task.AlertOffsets); alerts != "" {
+			response += fmt.Sprintf("   🔔 Alerts %s\n", alerts)
+		}
+		if nag := describeNag(task.NagEveryMinutes, task.NagRepeats); nag != "" {
+			response += fmt.Sprintf("   📣 Nagging %s\n", nag)
+		}
+		if task.Urgent {
+			response += "   🚨 Urgent\n"
+		}
+		if n := len(task.Snoozes); n > 0 {
+			response += fmt.Sprintf("   💤 Snoozed %d %s\n", n, pluralize(n, "time", "times"))
+		}
+		response += "\n"
+
+		if task.Status == "pending" {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("❌ %d", i+1), NewCallbackData("task", task.ID, "cancel")))
+		}
+	}
+
+	if len(buttons) == 0 {
+		return response, nil
+	}
+	response += "Tap a button to cancel a task, or use /cancel <number>."
+
+	// Five cancel buttons per row
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for len(buttons) > 0 {
+		n := min(5, len(buttons))
+		rows = append(rows, buttons[:n])
+		buttons = buttons[n:]
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return response, &keyboard
+}
+
+// handleRemoveCommand handles /cancel and /delete. The argument is either the number shown by
+// /mytasks or a task ID prefixed with "#". action is "cancel" or "delete".
+func handleRemoveCommand(store Store, text string, user *User, action string) (string, *tgbotapi.InlineKeyboardMarkup) {
+	parts := strings.Fields(text)
+	if len(parts) < 2 {
+		return fmt.Sprintf("Please tell me which task to %s, e.g. `/%s 2` for the second task in /mytasks or `/%s #42` for task ID 42.",
+			action, action, action), nil
+	}
+
+	task, err := resolveTaskReference(store, user, parts[1])
+	if err != nil {
+		return fmt.Sprintf("❌ %v. Use /mytasks to see your tasks.", err), nil
+	}
+	if task.Status != "pending" {
+		return fmt.Sprintf("❌ '%s' is already %s.", task.Title, task.Status), nil
+	}
+
+	// Recurring tasks need confirmation whether to remove one occurrence or the whole series
+	if task.Recurrence != nil {
+		return removalConfirmation(task, action)
+	}
+
+	response, err := removeTask(store, task, action, false)
+	if err != nil {
+		log.Printf("Error removing task %d: %v", task.ID, err)
+		return fmt.Sprintf("❌ Failed to %s the task. Please try again.", action), nil
+	}
+	return response, nil
+}
+
+// resolveTaskReference finds a task from a /mytasks list number ("2") or a task ID ("#42")
+func resolveTaskReference(store Store, user *User, ref string) (*Task, error) {
+	if id, ok := strings.CutPrefix(ref, "#"); ok {
+		taskID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid task ID %s", ref)
+		}
+		task, err := store.GetUserTask(user.ID, uint(taskID))
+		if err != nil {
+			return nil, fmt.Errorf("task %s not found", ref)
+		}
+		return task, nil
+	}
+
+	n, err := strconv.Atoi(ref)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid task number %s", ref)
+	}
+	tasks, err := store.GetUserTasks(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve your tasks")
+	}
+	if n > len(tasks) {
+		return nil, fmt.Errorf("there is no task number %d", n)
+	}
+	return store.GetUserTask(user.ID, tasks[n-1].ID)
+}
+
+// removalConfirmation asks whether to remove one occurrence or the whole recurring series
+func removalConfirmation(task *Task, action string) (string, *tgbotapi.InlineKeyboardMarkup) {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Only this one", NewCallbackData("task", task.ID, action, "one")),
+			tgbotapi.NewInlineKeyboardButtonData("Whole series", NewCallbackData("task", task.ID, action, "series")),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Keep it", NewCallbackData("task", task.ID, action, "keep")),
+		),
+	)
+	return fmt.Sprintf("🔁 '%s' is a recurring task. Do you want to %s only this occurrence or the whole series?",
+		task.Title, action), &keyboard
+}
+
+// removeTask cancels or deletes a task, or its whole recurring series, and returns the confirmation text.
+// Removing a single occurrence of a recurring task keeps the series going.
+func removeTask(store Store, task *Task, action string, wholeSeries bool) (string, error) {
+	if wholeSeries {
+		var count int64
+		var err error
+		if action == "delete" {
+			count, err = store.DeleteTaskSeries(task.SeriesKey())
+		} else {
+			count, err = store.CancelTaskSeries(task.SeriesKey())
+		}
+		if err != nil {
+			return "", err
+		}
+		if action == "delete" {
+			return fmt.Sprintf("🗑 Deleted the recurring series '%s' (%d %s).", task.Title, count, pluralize(int(count), "task", "tasks")), nil
+		}
+		return fmt.Sprintf("❌ Cancelled the recurring series '%s' (%d %s).", task.Title, count, pluralize(int(count), "task", "tasks")), nil
 	}
 
-	return response
+	var err error
+	if action == "delete" {
+		err = store.DeleteTask(task.ID)
+	} else {
+		err = store.CancelTask(task.ID)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	response := fmt.Sprintf("❌ Cancelled '%s'.", task.Title)
+	if action == "delete" {
+		response = fmt.Sprintf("🗑 Deleted '%s'.", task.Title)
+	}
+
+	if task.Recurrence != nil {
+		next, err := store.ScheduleNextOccurrence(task)
+		if err != nil {
+			return "", err
+		}
+		if next != nil {
+			response += fmt.Sprintf("\n\n🔁 Next occurrence: %s", FormatTaskDateTime(next.DueDateTime, task.User.Timezone))
+		}
+	}
+	return response, nil
 }
 
 // handleDoneCommand handles the "done" response to mark the most recent reminder as completed
-func handleDoneCommand(user *User) string {
+func handleDoneCommand(store Store, user *User) string {
 	// Find the most recent task that had a reminder sent but is still pending
-	var task Task
-	result := DB.Where(
-		"user_id = ? AND status = ? AND is_active = ? AND reminder_sent_at IS NOT NULL",
-		user.ID, "pending", true,
-	).Order("reminder_sent_at DESC").First(&task)
-
-	if result.Error != nil {
+	task, err := store.GetLastRemindedTask(user.ID)
+	if err != nil {
 		return "❌ No recent reminder found to mark as done. You can use /mytasks to see your active tasks."
 	}
 
 	// Mark the task as completed
-	err := MarkTaskAsCompleted(task.ID)
+	err = store.MarkTaskAsCompleted(task.ID)
 	if err != nil {
 		return "❌ Failed to mark task as completed. Please try again."
 	}
@@ -107,11 +422,22 @@ func handleHelpCommand() string {
 		• "Call mom on Friday at 6 PM"
 		• "Submit the report by 5 PM today"
 		• "Take medicine every day at 9 AM"
+		• "Call the bank at 10 and pick up the kids at 3:30"
+		• "Dentist on Friday at 4 PM, remind me a day before and 30 minutes before"
+		• "Take out the trash at 8 PM, keep reminding me every 15 minutes"
+		• "Urgent: call the hospital at 2 AM"
 
 		**Commands:**
 		• /help - Show this help message
 		• /mytasks - View your active tasks  
+		• /cancel <number> - Cancel a task (use the number from /mytasks, or #<id>)
+		• /delete <number> - Delete a task permanently
+		• /edit <number> <change> - Change a task, e.g. /edit 2 make it 6pm instead
 		• /settimezone <timezone> - Set your timezone (e.g., /settimezone Asia/Kolkata)
+		• /alerts <offsets> - Get early alerts for new reminders, e.g. /alerts 1d 1h, or /alerts off
+		• /nag <interval> [times] - Repeat new reminders until they're done, e.g. /nag 10m 5, or /nag off
+		• /quiet <from-to> - Hold back reminders during quiet hours, e.g. /quiet 22:00-07:00, or /quiet off
+		• /dnd <duration> - Do not disturb for a while, e.g. /dnd 2h, or /dnd off
 
 		**Supported Timezones:**
 	` + strings.Join(GetCommonTimezones(), ", ") + `
@@ -119,8 +445,14 @@ func handleHelpCommand() string {
 		• Natural language processing
 		• Timezone support
 		• Recurring reminders
+		• Early alerts ahead of a reminder
+		• Nagging: repeat a reminder until you mark it done
+		• Quiet hours and do not disturb, with urgent reminders that still come through
 		• Task management
 		• Reply "done" to mark reminders as completed
+		• Snooze reminders with the buttons under each reminder
+		• Reply to one of my reminders with a change like "move to Friday"
+		• If a reminder is ambiguous, I'll ask a quick follow-up question
 
 		Just start chatting with me naturally! 🚀
 	`
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Missed reminder policies
+const (
+	MissedPolicyDeliver = "deliver" // deliver every missed reminder late, marked as missed
+	MissedPolicyDrop    = "drop"    // deliver late within the grace window, drop anything older
+)
+
+// LLM providers
+const (
+	LLMProviderGemini = "gemini" // Google Gemini
+	LLMProviderOpenAI = "openai" // any OpenAI-compatible chat completions API, including Ollama
+	LLMProviderFake   = "fake"   // scripted offline parser for tests and local development
+	LLMProviderRules  = "rules"  // rule-based parser only, no API key needed
+)
+
+// How the rule-based parser is combined with the LLM provider
+const (
+	RuleParserFallback = "fallback" // ask the LLM first, use the rules if it fails
+	RuleParserFirst    = "first"    // try the rules first, ask the LLM if they don't match
+	RuleParserOff      = "off"      // LLM only
+)
+
+// How the bot receives updates from Telegram
+const (
+	UpdateModePolling = "polling" // long polling with getUpdates
+	UpdateModeWebhook = "webhook" // Telegram POSTs updates to our HTTP server
+)
+
+// reWebhookSecret is the character set Telegram allows in a webhook secret token
+var reWebhookSecret = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// Config holds the bot's runtime configuration, read from environment variables
+type Config struct {
+	TelegramToken string
+	// TelegramAPIEndpoint is the Bot API URL template, with %s for the token and the method;
+	// point it at a local Bot API server or a FakeTelegram
+	TelegramAPIEndpoint string
+
+	// DatabaseURL selects the database driver and location, see databaseDialector
+	DatabaseURL string
+
+	// LLMProvider selects the ReminderParser implementation
+	LLMProvider string
+	// LLMModel is the model name sent to the provider
+	LLMModel      string
+	GeminiAPIKey  string
+	OpenAIBaseURL string
+	OpenAIAPIKey  string
+	// FakeLLMScript is the JSON script file answered by the fake provider
+	FakeLLMScript string
+	// RuleParserMode decides when the rule-based parser is used alongside the LLM
+	RuleParserMode string
+
+	// MissedReminderPolicy decides what happens to reminders whose time passed while the bot was down
+	MissedReminderPolicy string
+	// MissedReminderGrace is how late a reminder may be delivered under the "drop" policy
+	MissedReminderGrace time.Duration
+
+	// UpdateMode selects long polling or webhooks
+	UpdateMode string
+	// WebhookURL is the public HTTPS URL Telegram sends updates to
+	WebhookURL string
+	// WebhookListenAddr and WebhookPath are where the webhook HTTP server listens
+	WebhookListenAddr string
+	WebhookPath       string
+	// WebhookSecret is checked against the X-Telegram-Bot-Api-Secret-Token header; a random one
+	// is generated at startup if unset
+	WebhookSecret string
+	// WebhookTLSCert and WebhookTLSKey make the webhook server serve HTTPS itself
+	WebhookTLSCert string
+	WebhookTLSKey  string
+	// WebhookSelfSigned uploads the certificate to Telegram, generating one if no files are given
+	WebhookSelfSigned bool
+
+	// ShutdownTimeout bounds how long shutdown waits for in-flight work
+	ShutdownTimeout time.Duration
+
+	// WorkerID identifies this process when claiming due reminders; it must be unique among replicas
+	WorkerID string
+	// ClaimLease is how long a claimed reminder stays reserved for this worker before another may take it over
+	ClaimLease time.Duration
+	// ReconcileInterval is how often the scheduler reloads its queue from the database
+	ReconcileInterval time.Duration
+	// MaxDeliveryAttempts is how often sending a reminder is tried before it moves to the failed status
+	MaxDeliveryAttempts int
+}
+
+// LoadConfig reads the configuration from the environment and applies defaults
+func LoadConfig() (*Config, error) {
+	config := &Config{
+		TelegramToken:        os.Getenv("TELEGRAM_APITOKEN"),
+		TelegramAPIEndpoint:  getEnv("TELEGRAM_API_ENDPOINT", tgbotapi.APIEndpoint),
+		DatabaseURL:          getEnv("DATABASE_URL", DefaultDatabaseURL),
+		LLMProvider:          getEnv("LLM_PROVIDER", LLMProviderGemini),
+		GeminiAPIKey:         os.Getenv("GEMINI_API_KEY"),
+		OpenAIBaseURL:        getEnv("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+		OpenAIAPIKey:         os.Getenv("OPENAI_API_KEY"),
+		FakeLLMScript:        os.Getenv("FAKE_LLM_SCRIPT"),
+		RuleParserMode:       getEnv("RULE_PARSER", RuleParserFallback),
+		MissedReminderPolicy: getEnv("MISSED_REMINDER_POLICY", MissedPolicyDeliver),
+		MissedReminderGrace:  time.Hour,
+		ShutdownTimeout:      30 * time.Second,
+		WorkerID:             getEnv("WORKER_ID", defaultWorkerID()),
+		ClaimLease:           2 * time.Minute,
+		ReconcileInterval:    time.Minute,
+		MaxDeliveryAttempts:  5,
+	}
+
+	switch config.LLMProvider {
+	case LLMProviderGemini:
+		config.LLMModel = getEnv("LLM_MODEL", "gemini-2.5-flash-lite")
+	case LLMProviderOpenAI:
+		config.LLMModel = getEnv("LLM_MODEL", "gpt-4o-mini")
+	case LLMProviderFake, LLMProviderRules:
+	default:
+		return nil, fmt.Errorf("invalid LLM_PROVIDER %q, expected %q, %q, %q or %q",
+			config.LLMProvider, LLMProviderGemini, LLMProviderOpenAI, LLMProviderFake, LLMProviderRules)
+	}
+
+	switch config.RuleParserMode {
+	case RuleParserFallback, RuleParserFirst, RuleParserOff:
+	default:
+		return nil, fmt.Errorf("invalid RULE_PARSER %q, expected %q, %q or %q",
+			config.RuleParserMode, RuleParserFallback, RuleParserFirst, RuleParserOff)
+	}
+
+	switch config.MissedReminderPolicy {
+	case MissedPolicyDeliver, MissedPolicyDrop:
+	default:
+		return nil, fmt.Errorf("invalid MISSED_REMINDER_POLICY %q, expected %q or %q",
+			config.MissedReminderPolicy, MissedPolicyDeliver, MissedPolicyDrop)
+	}
+
+	if grace := os.Getenv("MISSED_REMINDER_GRACE"); grace != "" {
+		d, err := time.ParseDuration(grace)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid MISSED_REMINDER_GRACE %q", grace)
+		}
+		config.MissedReminderGrace = d
+	}
+
+	if timeout := os.Getenv("SHUTDOWN_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT %q", timeout)
+		}
+		config.ShutdownTimeout = d
+	}
+
+	if lease := os.Getenv("CLAIM_LEASE"); lease != "" {
+		d, err := time.ParseDuration(lease)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid CLAIM_LEASE %q", lease)
+		}
+		config.ClaimLease = d
+	}
+
+	if interval := os.Getenv("RECONCILE_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid RECONCILE_INTERVAL %q", interval)
+		}
+		config.ReconcileInterval = d
+	}
+
+	if attempts := os.Getenv("MAX_DELIVERY_ATTEMPTS"); attempts != "" {
+		n, err := strconv.Atoi(attempts)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid MAX_DELIVERY_ATTEMPTS %q", attempts)
+		}
+		config.MaxDeliveryAttempts = n
+	}
+
+	if strings.Count(config.TelegramAPIEndpoint, "%s") != 2 {
+		return nil, fmt.Errorf("invalid TELEGRAM_API_ENDPOINT %q, expected a URL with %%s for the token and the method", config.TelegramAPIEndpoint)
+	}
+
+	if err := loadWebhookConfig(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// loadWebhookConfig reads the update mode and, in webhook mode, the webhook settings
+func loadWebhookConfig(config *Config) error {
+	config.UpdateMode = getEnv("UPDATE_MODE", UpdateModePolling)
+	switch config.UpdateMode {
+	case UpdateModePolling:
+		return nil
+	case UpdateModeWebhook:
+	default:
+		return fmt.Errorf("invalid UPDATE_MODE %q, expected %q or %q", config.UpdateMode, UpdateModePolling, UpdateModeWebhook)
+	}
+
+	config.WebhookURL = os.Getenv("WEBHOOK_URL")
+	webhookURL, err := url.Parse(config.WebhookURL)
+	if config.WebhookURL == "" || err != nil || webhookURL.Scheme != "https" || webhookURL.Host == "" {
+		return fmt.Errorf("invalid WEBHOOK_URL %q, expected a public https:// URL", config.WebhookURL)
+	}
+
+	defaultPath := webhookURL.Path
+	if defaultPath == "" {
+		defaultPath = "/"
+	}
+	config.WebhookListenAddr = getEnv("WEBHOOK_LISTEN_ADDR", ":8080")
+	config.WebhookPath = getEnv("WEBHOOK_PATH", defaultPath)
+
+	config.WebhookSecret = os.Getenv("WEBHOOK_SECRET")
+	if config.WebhookSecret != "" && !reWebhookSecret.MatchString(config.WebhookSecret) {
+		return fmt.Errorf("invalid WEBHOOK_SECRET, expected 1-256 characters of A-Z, a-z, 0-9, _ and -")
+	}
+
+	config.WebhookTLSCert = os.Getenv("WEBHOOK_TLS_CERT")
+	config.WebhookTLSKey = os.Getenv("WEBHOOK_TLS_KEY")
+	if (config.WebhookTLSCert == "") != (config.WebhookTLSKey == "") {
+		return fmt.Errorf("WEBHOOK_TLS_CERT and WEBHOOK_TLS_KEY must be set together")
+	}
+
+	if selfSigned := os.Getenv("WEBHOOK_SELF_SIGNED"); selfSigned != "" {
+		config.WebhookSelfSigned, err = strconv.ParseBool(selfSigned)
+		if err != nil {
+			return fmt.Errorf("invalid WEBHOOK_SELF_SIGNED %q", selfSigned)
+		}
+	}
+	return nil
+}
+
+// defaultWorkerID identifies this process by host name and process ID
+func defaultWorkerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// getEnv returns the value of an environment variable or a default if it is unset
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
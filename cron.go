@@ -1,68 +1,365 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"strings"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-// TaskChecker runs as a background goroutine to check for due tasks and send reminders
-func TaskChecker(bot *tgbotapi.BotAPI) {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+// missedAfter is how late a reminder may be sent before it counts as missed while offline
+const missedAfter = time.Minute
 
-	log.Println("Task checker started - checking for due tasks every second")
+// Delivery error classes recorded with each failed attempt
+const (
+	DeliveryErrorRateLimited = "rate_limited" // Telegram answered 429; retried after its retry_after
+	DeliveryErrorServer      = "server"       // Telegram answered 5xx; retried with backoff
+	DeliveryErrorNetwork     = "network"      // no answer from Telegram; retried with backoff
+	DeliveryErrorBadRequest  = "bad_request"  // Telegram refused this message, e.g. its formatting; retried with backoff
+	DeliveryErrorRejected    = "rejected"     // Telegram refused the chat, e.g. the user blocked the bot; not retried
+)
 
-	for range ticker.C {
-		// Check for tasks that are due now
-		tasks, err := GetTasksDueNow()
-		if err != nil {
-			log.Printf("Error getting tasks due now: %v", err)
-			continue
-		}
+// Backoff between delivery attempts: deliveryRetryBase after the first failure, doubling up to deliveryRetryMax
+const (
+	deliveryRetryBase = 30 * time.Second
+	deliveryRetryMax  = time.Hour
+)
 
-		// Send reminders for each due task
-		for _, task := range tasks {
-			err := sendTaskReminder(bot, &task)
-			if err != nil {
-				log.Printf("Error sending reminder for task %d: %v", task.ID, err)
+// checkDueTasks claims every task that is due or overdue and sends its reminder. A task whose
+// reminder fails to send is retried with backoff, see recordDeliveryFailure.
+func checkDueTasks(bot Messenger, store Store, clock Clock, config *Config) {
+	now := clock.Now()
+	tasks, err := store.ClaimDueTasks(config.WorkerID, now, config.ClaimLease)
+	if err != nil {
+		log.Printf("Error claiming due tasks: %v", err)
+		return
+	}
+
+	// Send reminders for each due task
+	for _, task := range tasks {
+		// Retries and replays are late because sending failed, not because the bot was offline
+		missed := task.NextRetryAt == nil && now.Sub(task.DueDateTime) > missedAfter
+
+		if missed && config.MissedReminderPolicy == MissedPolicyDrop && now.Sub(task.DueDateTime) > config.MissedReminderGrace {
+			if err := store.MarkTaskMissed(task.ID); err != nil {
+				log.Printf("Error marking task %d as missed: %v", task.ID, err)
 				continue
 			}
-
-			// Mark task as reminder sent (but keep it pending so user can mark as completed)
-			err = MarkTaskReminderSent(task.ID)
+			log.Printf("Dropped missed reminder for task %d: %s (due %s)", task.ID, task.Title, task.DueDateTime.Format(time.RFC3339))
+		} else if deferUntil, silent := quietDelivery(&task, now); deferUntil != nil {
+			// Hold the reminder back until the user's quiet hours or do not disturb end
+			if err := store.DeferTaskReminder(&task, config.WorkerID, *deferUntil); err != nil {
+				log.Printf("Error deferring reminder for task %d: %v", task.ID, err)
+			} else {
+				log.Printf("Deferred reminder for task %d to %s (quiet hours)", task.ID, deferUntil.Format(time.RFC3339))
+			}
+			continue
+		} else {
+			err := sendTaskReminder(bot, store, &task, missed, silent)
 			if err != nil {
-				log.Printf("Error marking task %d reminder as sent: %v", task.ID, err)
+				log.Printf("Error sending reminder for task %d: %v", task.ID, err)
+				if retrying := recordDeliveryFailure(store, config, &task, err, now); retrying {
+					continue
+				}
 			} else {
-				log.Printf("Sent reminder for task %d: %s", task.ID, task.Title)
+				// Mark task as reminder sent (but keep it pending so user can mark as completed),
+				// and nag about it until it's done if the task asks for that
+				err = store.MarkTaskReminderSent(task.ID, config.WorkerID, nextNagAt(&task, 0, now))
+				if err != nil {
+					log.Printf("Error marking task %d reminder as sent: %v", task.ID, err)
+				} else {
+					log.Printf("Sent reminder for task %d: %s", task.ID, task.Title)
+				}
 			}
 		}
+
+		// Recurring tasks get their next occurrence scheduled as a new pending task
+		if _, err := store.ScheduleNextOccurrence(&task); err != nil {
+			log.Printf("Error scheduling next occurrence of task %d: %v", task.ID, err)
+		}
+	}
+}
+
+// recordDeliveryFailure records a failed attempt to send a task's reminder and schedules the next
+// attempt with exponential backoff, or after the retry_after Telegram asked for. Once the task has
+// run out of attempts, or Telegram refused the chat, it moves to the failed status
+// for an admin to inspect and replay. It reports whether the reminder will be retried.
+func recordDeliveryFailure(store Store, config *Config, task *Task, sendErr error, now time.Time) bool {
+	class, retryAfter := classifyDeliveryError(sendErr)
+	attempt := DeliveryAttempt{
+		Attempt:    task.DeliveryAttempts + 1,
+		ErrorClass: class,
+		Error:      sendErr.Error(),
+	}
+
+	// Rate limits don't use up attempts, since Telegram says exactly when to try again
+	retrying := class == DeliveryErrorRateLimited ||
+		class != DeliveryErrorRejected && attempt.Attempt < config.MaxDeliveryAttempts
+	if retrying {
+		delay := retryAfter
+		if delay == 0 {
+			delay = deliveryBackoff(attempt.Attempt)
+		}
+		next := now.Add(delay).UTC()
+		attempt.NextRetryAt = &next
+	}
+
+	if err := store.RecordDeliveryFailure(task.ID, config.WorkerID, &attempt); err != nil {
+		log.Printf("Error recording delivery failure for task %d: %v", task.ID, err)
+		return retrying
+	}
+	if retrying {
+		log.Printf("Delivery attempt %d for task %d failed (%s), retrying at %s",
+			attempt.Attempt, task.ID, class, attempt.NextRetryAt.Format(time.RFC3339))
+	} else {
+		log.Printf("Delivery attempt %d for task %d failed (%s), giving up", attempt.Attempt, task.ID, class)
 	}
+	return retrying
 }
 
-// sendTaskReminder sends a reminder message to the user for a specific task
-func sendTaskReminder(bot *tgbotapi.BotAPI, task *Task) error {
+// classifyDeliveryError sorts a failed send into a DeliveryError class and returns how long
+// Telegram asked us to wait before retrying, if it did. The senders wrap the Telegram error with
+// %w so it can be found here.
+func classifyDeliveryError(err error) (string, time.Duration) {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return DeliveryErrorNetwork, 0
+	}
+	switch {
+	case apiErr.Code == http.StatusTooManyRequests || apiErr.RetryAfter > 0:
+		return DeliveryErrorRateLimited, time.Duration(apiErr.RetryAfter) * time.Second
+	case apiErr.Code >= 500:
+		return DeliveryErrorServer, 0
+	case apiErr.Code == http.StatusForbidden || strings.Contains(strings.ToLower(apiErr.Message), "chat not found"):
+		// The user blocked the bot or the chat is gone, so no later attempt can succeed
+		return DeliveryErrorRejected, 0
+	case apiErr.Code >= 400:
+		return DeliveryErrorBadRequest, 0
+	default:
+		// The library reports some failures without an HTTP status
+		return DeliveryErrorServer, 0
+	}
+}
+
+// deliveryBackoff returns the delay before the attempt after the given failed one
+func deliveryBackoff(attempt int) time.Duration {
+	delay := deliveryRetryBase
+	for i := 1; i < attempt && delay < deliveryRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, deliveryRetryMax)
+}
+
+// sendTaskReminder sends a reminder message to the user for a specific task.
+// missed marks reminders that are delivered late because the bot was offline at the due time;
+// silent ones go out without a notification during the user's quiet hours.
+func sendTaskReminder(bot Messenger, store Store, task *Task, missed, silent bool) error {
 	// Format the reminder message
 	formattedTime := FormatTaskDateTime(task.DueDateTime, task.User.Timezone)
 
-	message := fmt.Sprintf("🔔 **Reminder: %s**\n\n📝 %s\n\n⏰ Scheduled for: %s (%s)\n\n✅ Reply with 'done' to mark as completed",
-		task.Title,
-		task.Description,
+	message := fmt.Sprintf("🔔 **Reminder: %s**\n\n📝 %s\n\n⏰ Scheduled for: %s (%s)",
+		escapeMarkdown(task.Title),
+		escapeMarkdown(task.Description),
 		formattedTime,
-		task.User.Timezone,
+		escapeMarkdown(task.User.Timezone),
 	)
+	if missed {
+		message = "⚠️ _Missed while offline - delivering late_\n\n" + message
+	}
+	if silent {
+		message = quietNote + message
+	}
+	if rule, err := TaskRecurrence(task); err == nil && rule != nil {
+		message += fmt.Sprintf("\n\n🔁 Repeats %s", rule.Describe())
+	}
+	message += "\n\n✅ Reply with 'done' or use the buttons below"
 
-	// Create the message
+	// Create the message with Done and Snooze buttons
 	msg := tgbotapi.NewMessage(int64(task.User.TelegramID), message)
 	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = reminderKeyboard(task.ID)
+	msg.DisableNotification = silent
 
 	// Send the message
-	_, err := bot.Send(msg)
+	sent, err := bot.Send(msg)
+	if err != nil {
+		return fmt.Errorf("failed to send reminder message: %w", err)
+	}
+
+	// Link the reminder to the task so replies to it can edit the task
+	if err := store.RecordTaskMessage(task.ID, sent.Chat.ID, sent.MessageID, "reminder"); err != nil {
+		log.Printf("Error recording reminder message for task %d: %v", task.ID, err)
+	}
+
+	return nil
+}
+
+// escapeMarkdown escapes user text, such as a task title, for a message sent with the Markdown
+// parse mode, so a stray _ or * can't make Telegram refuse the whole message
+func escapeMarkdown(text string) string {
+	return tgbotapi.EscapeText(tgbotapi.ModeMarkdown, text)
+}
+
+// checkDueNags claims every task whose reminder is due to be sent again because it wasn't marked
+// done yet, and sends it again. A repeat that fails to send isn't retried: the next one follows at
+// the usual interval, unless Telegram refused the chat, which stops the nagging. Repeats during
+// quiet hours wait or go out silently like reminders.
+func checkDueNags(bot Messenger, store Store, clock Clock, config *Config) {
+	now := clock.Now()
+	tasks, err := store.ClaimDueNags(config.WorkerID, now, config.ClaimLease)
 	if err != nil {
-		return fmt.Errorf("failed to send reminder message: %v", err)
+		log.Printf("Error claiming due nags: %v", err)
+		return
 	}
 
+	for _, task := range tasks {
+		deferUntil, silent := quietDelivery(&task, now)
+		if deferUntil != nil {
+			if err := store.DeferTaskReminder(&task, config.WorkerID, *deferUntil); err != nil {
+				log.Printf("Error deferring repeated reminder for task %d: %v", task.ID, err)
+			}
+			continue
+		}
+
+		repeat := task.NagCount + 1
+		next := nextNagAt(&task, repeat, now)
+		err := sendTaskNag(bot, store, &task, repeat, silent)
+		if err != nil {
+			class, _ := classifyDeliveryError(err)
+			log.Printf("Error repeating reminder for task %d (%s): %v", task.ID, class, err)
+			if class == DeliveryErrorRejected {
+				next = nil
+			}
+		}
+		if err := store.RecordTaskNag(task.ID, config.WorkerID, err == nil, next); err != nil {
+			log.Printf("Error recording repeated reminder for task %d: %v", task.ID, err)
+		} else if err == nil {
+			log.Printf("Repeated reminder %d of %d for task %d: %s", repeat, task.NagRepeats, task.ID, task.Title)
+		}
+	}
+}
+
+// sendTaskNag sends a task's reminder again because it wasn't marked done yet
+func sendTaskNag(bot Messenger, store Store, task *Task, repeat int, silent bool) error {
+	formattedTime := FormatTaskDateTime(task.DueDateTime, task.User.Timezone)
+
+	message := fmt.Sprintf("📣 **Still waiting: %s**\n\n📝 %s\n\n⏰ Was due: %s (%s)\n\n_Repeat %d of %d - mark it done to stop them_\n\n✅ Reply with 'done' or use the buttons below",
+		escapeMarkdown(task.Title),
+		escapeMarkdown(task.Description),
+		formattedTime,
+		escapeMarkdown(task.User.Timezone),
+		repeat,
+		task.NagRepeats,
+	)
+	if silent {
+		message = quietNote + message
+	}
+
+	msg := tgbotapi.NewMessage(int64(task.User.TelegramID), message)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = reminderKeyboard(task.ID)
+	msg.DisableNotification = silent
+
+	sent, err := bot.Send(msg)
+	if err != nil {
+		return fmt.Errorf("failed to send repeated reminder: %w", err)
+	}
+
+	// Link the repeat to the task so replies to it can edit the task
+	if err := store.RecordTaskMessage(task.ID, sent.Chat.ID, sent.MessageID, "nag"); err != nil {
+		log.Printf("Error recording repeated reminder message for task %d: %v", task.ID, err)
+	}
+	return nil
+}
+
+// checkDueAlerts claims every alert that is due ahead of its task and sends it. Alerts that fail to
+// send are retried like reminders, see recordAlertFailure. Alerts during the user's quiet hours are
+// sent silently rather than held back, since by the end of them the task may be due already.
+func checkDueAlerts(bot Messenger, store Store, clock Clock, config *Config) {
+	now := clock.Now()
+	alerts, err := store.ClaimDueAlerts(config.WorkerID, now, config.ClaimLease)
+	if err != nil {
+		log.Printf("Error claiming due alerts: %v", err)
+		return
+	}
+
+	for _, alert := range alerts {
+		_, quiet := quietUntil(&alert.Task.User, now)
+		if err := sendTaskAlert(bot, store, &alert, now, quiet && !alert.Task.Urgent); err != nil {
+			log.Printf("Error sending alert %d for task %d: %v", alert.ID, alert.TaskID, err)
+			recordAlertFailure(store, config, &alert, err, now)
+			continue
+		}
+		if err := store.MarkAlertSent(alert.ID, config.WorkerID); err != nil {
+			log.Printf("Error marking alert %d as sent: %v", alert.ID, err)
+		} else {
+			log.Printf("Sent alert %d for task %d: %s", alert.ID, alert.TaskID, alert.Task.Title)
+		}
+	}
+}
+
+// recordAlertFailure records a failed attempt to send an alert and schedules the next attempt the
+// same way as for reminders. An alert is given up once a retry would no longer arrive ahead of the
+// task, since the reminder itself takes over from there.
+func recordAlertFailure(store Store, config *Config, alert *TaskAlert, sendErr error, now time.Time) {
+	class, retryAfter := classifyDeliveryError(sendErr)
+	alert.Attempts++
+	alert.NextRetryAt = nil
+
+	if class == DeliveryErrorRateLimited || class != DeliveryErrorRejected && alert.Attempts < config.MaxDeliveryAttempts {
+		delay := retryAfter
+		if delay == 0 {
+			delay = deliveryBackoff(alert.Attempts)
+		}
+		if next := now.Add(delay).UTC(); next.Before(alert.Task.DueDateTime) {
+			alert.NextRetryAt = &next
+		}
+	}
+
+	if err := store.RecordAlertFailure(alert, config.WorkerID); err != nil {
+		log.Printf("Error recording failure of alert %d: %v", alert.ID, err)
+		return
+	}
+	if alert.NextRetryAt != nil {
+		log.Printf("Attempt %d for alert %d failed (%s), retrying at %s",
+			alert.Attempts, alert.ID, class, alert.NextRetryAt.Format(time.RFC3339))
+	} else {
+		log.Printf("Attempt %d for alert %d failed (%s), giving up", alert.Attempts, alert.ID, class)
+	}
+}
+
+// sendTaskAlert sends an alert ahead of a task's due time, telling the user how far away it is
+func sendTaskAlert(bot Messenger, store Store, alert *TaskAlert, now time.Time, silent bool) error {
+	task := &alert.Task
+	formattedTime := FormatTaskDateTime(task.DueDateTime, task.User.Timezone)
+
+	message := fmt.Sprintf("⏳ **Coming up in %s: %s**\n\n📝 %s\n\n⏰ Scheduled for: %s (%s)",
+		describeDuration(task.DueDateTime.Sub(now)),
+		escapeMarkdown(task.Title),
+		escapeMarkdown(task.Description),
+		formattedTime,
+		escapeMarkdown(task.User.Timezone),
+	)
+	if silent {
+		message = quietNote + message
+	}
+
+	msg := tgbotapi.NewMessage(int64(task.User.TelegramID), message)
+	msg.ParseMode = "Markdown"
+	msg.DisableNotification = silent
+
+	sent, err := bot.Send(msg)
+	if err != nil {
+		return fmt.Errorf("failed to send alert message: %w", err)
+	}
+
+	// Link the alert to the task so replies to it can edit the task
+	if err := store.RecordTaskMessage(task.ID, sent.Chat.ID, sent.MessageID, "alert"); err != nil {
+		log.Printf("Error recording alert message for task %d: %v", task.ID, err)
+	}
 	return nil
 }
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeliveryBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{50, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := deliveryBackoff(tt.attempt); got != tt.want {
+			t.Errorf("deliveryBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestCheckDueTasksRetries(t *testing.T) {
+	serverError := FakeFailure{Code: http.StatusBadGateway, Description: "Bad Gateway"}
+	rateLimited := FakeFailure{Code: http.StatusTooManyRequests, Description: "Too Many Requests: retry after 7", RetryAfter: 7}
+	blocked := FakeFailure{Code: http.StatusForbidden, Description: "Forbidden: bot was blocked by the user"}
+	chatNotFound := FakeFailure{Code: http.StatusBadRequest, Description: "Bad Request: chat not found"}
+	unparsable := FakeFailure{Code: http.StatusBadRequest, Description: "Bad Request: can't parse entities: Can't find end of the entity starting at byte offset 20"}
+
+	// retry is a failed attempt the test expects: its class and the wait before the next one, or 0
+	// if the reminder gives up
+	type retry struct {
+		class string
+		after time.Duration
+	}
+	tests := []struct {
+		name     string
+		failures []FakeFailure
+		want     []retry
+		failed   bool // whether the reminder ends up failed rather than sent
+	}{
+		{
+			name:     "backs off and then sends",
+			failures: []FakeFailure{serverError, serverError},
+			want:     []retry{{DeliveryErrorServer, 30 * time.Second}, {DeliveryErrorServer, time.Minute}},
+		},
+		{
+			// newTestScheduler allows 3 attempts
+			name:     "fails after the last attempt",
+			failures: []FakeFailure{serverError, serverError, serverError},
+			want:     []retry{{DeliveryErrorServer, 30 * time.Second}, {DeliveryErrorServer, time.Minute}, {DeliveryErrorServer, 0}},
+			failed:   true,
+		},
+		{
+			name:     "waits as long as Telegram asks without using up attempts",
+			failures: []FakeFailure{rateLimited, rateLimited, rateLimited},
+			want:     []retry{{DeliveryErrorRateLimited, 7 * time.Second}, {DeliveryErrorRateLimited, 7 * time.Second}, {DeliveryErrorRateLimited, 7 * time.Second}},
+		},
+		{
+			name:     "gives up when Telegram rejects the message",
+			failures: []FakeFailure{blocked},
+			want:     []retry{{DeliveryErrorRejected, 0}},
+			failed:   true,
+		},
+		{
+			name:     "gives up when the chat is gone",
+			failures: []FakeFailure{chatNotFound},
+			want:     []retry{{DeliveryErrorRejected, 0}},
+			failed:   true,
+		},
+		{
+			name:     "retries a message Telegram couldn't parse",
+			failures: []FakeFailure{unparsable},
+			want:     []retry{{DeliveryErrorBadRequest, 30 * time.Second}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler, fake, store, clock := newTestScheduler(t)
+			task := newStoreTask(t, store, ReminderPayload{Title: "Take pills", Datetime: "2026-10-17T08:00:00"})
+			for _, failure := range tt.failures {
+				fake.FailNext("sendMessage", failure)
+			}
+			check := func() { checkDueTasks(scheduler.bot, store, clock, scheduler.config) }
+
+			for i, want := range tt.want {
+				check()
+				if sent := len(fake.Calls("sendMessage")); sent != i+1 {
+					t.Fatalf("attempt %d: tried to send %d times", i+1, sent)
+				}
+				attempts, err := store.GetDeliveryAttempts(task.ID)
+				if err != nil || len(attempts) != i+1 {
+					t.Fatalf("attempt %d: recorded %+v, %v", i+1, attempts, err)
+				}
+				attempt := attempts[i]
+				if attempt.Attempt != i+1 || attempt.ErrorClass != want.class {
+					t.Errorf("attempt %d recorded as attempt %d (%s), want %s", i+1, attempt.Attempt, attempt.ErrorClass, want.class)
+				}
+				if want.after == 0 {
+					if attempt.NextRetryAt != nil {
+						t.Errorf("attempt %d retries at %v, want it to give up", i+1, attempt.NextRetryAt)
+					}
+					continue
+				}
+				if next := clock.Now().Add(want.after); attempt.NextRetryAt == nil || !attempt.NextRetryAt.Equal(next) {
+					t.Fatalf("attempt %d retries at %v, want %v", i+1, attempt.NextRetryAt, next)
+				}
+
+				// Nothing is sent again until the backoff has passed
+				clock.Advance(want.after - time.Second)
+				check()
+				if sent := len(fake.Calls("sendMessage")); sent != i+1 {
+					t.Fatalf("attempt %d: retried %v early", i+1, time.Second)
+				}
+				clock.Advance(time.Second)
+			}
+
+			check()
+			got, err := store.GetUserTask(task.UserID, task.ID)
+			if err != nil {
+				t.Fatalf("GetUserTask() error = %v", err)
+			}
+			if tt.failed {
+				if got.Status != "failed" || got.ReminderSentAt != nil || len(fake.Calls("sendMessage")) != len(tt.want) {
+					t.Errorf("task is %s, sent at %v after %d sends, want it failed", got.Status, got.ReminderSentAt, len(fake.Calls("sendMessage")))
+				}
+				if failed, err := store.GetFailedTasks(); err != nil || len(failed) != 1 || failed[0].ID != task.ID {
+					t.Errorf("GetFailedTasks() = %v, %v, want task %d", taskIDs(failed), err, task.ID)
+				}
+				return
+			}
+			if got.Status != "pending" || got.ReminderSentAt == nil || got.DeliveryAttempts != 0 || got.NextRetryAt != nil {
+				t.Errorf("task is %s, sent at %v with %d attempts and a retry at %v, want it sent and reset",
+					got.Status, got.ReminderSentAt, got.DeliveryAttempts, got.NextRetryAt)
+			}
+		})
+	}
+}
+
+func TestCheckDueTasksEscapesMarkdown(t *testing.T) {
+	scheduler, fake, store, clock := newTestScheduler(t)
+	newStoreTask(t, store, ReminderPayload{Title: "Rename my_file *now*", Datetime: "2026-10-17T08:00:00"})
+	checkDueTasks(scheduler.bot, store, clock, scheduler.config)
+
+	calls := fake.Calls("sendMessage")
+	if len(calls) != 1 {
+		t.Fatalf("sent %d messages, want the reminder", len(calls))
+	}
+	if text := calls[0].Params["text"]; !strings.Contains(text, `Reminder: Rename my\_file \*now\*`) {
+		t.Errorf("reminder = %q, want the title escaped", text)
+	}
+}
+
+func TestCheckDueAlerts(t *testing.T) {
+	scheduler, fake, store, clock := newTestScheduler(t)
+	task := newStoreTask(t, store, ReminderPayload{Title: "Flight", Datetime: "2026-10-18T10:00:00", Alerts: []string{"15m", "1d", "1h"}})
+	check := func() {
+		checkDueAlerts(scheduler.bot, store, clock, scheduler.config)
+		checkDueTasks(scheduler.bot, store, clock, scheduler.config)
+	}
+
+	// Each offset goes out on its own at its time, and the reminder follows at the due time
+	steps := []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC), "Coming up in 1 day: Flight"},
+		{time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC), "Coming up in 1 hour: Flight"},
+		{time.Date(2026, 10, 18, 9, 45, 0, 0, time.UTC), "Coming up in 15 minutes: Flight"},
+		{time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC), "Reminder: Flight"},
+	}
+	for i, step := range steps {
+		clock.Set(step.at.Add(-time.Second))
+		check()
+		if sent := len(fake.Calls("sendMessage")); sent != i {
+			t.Fatalf("sent %d messages a second before %v, want %d", sent, step.at, i)
+		}
+
+		clock.Set(step.at)
+		check()
+		calls := fake.Calls("sendMessage")
+		if len(calls) != i+1 {
+			t.Fatalf("sent %d messages at %v, want %d", len(calls), step.at, i+1)
+		}
+		if text := calls[i].Params["text"]; !strings.Contains(text, step.want) {
+			t.Errorf("message at %v = %q, want it to contain %q", step.at, text, step.want)
+		}
+	}
+
+	got, err := store.GetUserTask(task.UserID, task.ID)
+	if err != nil {
+		t.Fatalf("GetUserTask() error = %v", err)
+	}
+	for _, alert := range got.Alerts {
+		if alert.SentAt == nil || alert.Attempts != 0 {
+			t.Errorf("alert at %v was sent at %v after %d failed attempts", alert.AlertAt, alert.SentAt, alert.Attempts)
+		}
+	}
+}
+
+func TestCheckDueAlertsGivesUpAtTheDueTime(t *testing.T) {
+	scheduler, fake, store, clock := newTestScheduler(t)
+	task := newStoreTask(t, store, ReminderPayload{Title: "Standup", Datetime: "2026-10-17T08:10:00", Alerts: []string{"5m"}})
+
+	// A retry that would only come after the task is due isn't worth it: the reminder takes over
+	fake.FailNext("sendMessage", FakeFailure{Code: http.StatusTooManyRequests, Description: "Too Many Requests: retry after 600", RetryAfter: 600})
+	clock.Set(time.Date(2026, 10, 17, 8, 5, 0, 0, time.UTC))
+	checkDueAlerts(scheduler.bot, store, clock, scheduler.config)
+
+	got, err := store.GetUserTask(task.UserID, task.ID)
+	if err != nil || len(got.Alerts) != 1 {
+		t.Fatalf("GetUserTask() = %+v, %v, want a task with one alert", got, err)
+	}
+	if alert := got.Alerts[0]; alert.Attempts != 1 || alert.NextRetryAt != nil || alert.FailedAt == nil {
+		t.Errorf("alert has %d attempts, a retry at %v and failed at %v, want it given up", alert.Attempts, alert.NextRetryAt, alert.FailedAt)
+	}
+}
+
+func TestCheckDueNags(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure *FakeFailure // the first repeat fails with this
+		done    bool         // the task is marked done after the first repeat
+		want    []string     // the messages sent at 08:00, 08:10, 08:20 and 08:30
+	}{
+		{
+			name: "stops at the repeat limit",
+			want: []string{"Reminder: Take pills", "Repeat 1 of 2", "Repeat 2 of 2", ""},
+		},
+		{
+			name: "stops once done",
+			done: true,
+			want: []string{"Reminder: Take pills", "Repeat 1 of 2", "", ""},
+		},
+		{
+			name:    "carries on after a failed repeat",
+			failure: &FakeFailure{Code: http.StatusBadGateway, Description: "Bad Gateway"},
+			want:    []string{"Reminder: Take pills", "", "Repeat 2 of 2", ""},
+		},
+		{
+			name:    "stops when Telegram rejects a repeat",
+			failure: &FakeFailure{Code: http.StatusForbidden, Description: "Forbidden: bot was blocked by the user"},
+			want:    []string{"Reminder: Take pills", "", "", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler, fake, store, clock := newTestScheduler(t)
+			task := newStoreTask(t, store, ReminderPayload{Title: "Take pills", Datetime: "2026-10-17T08:00:00", NagEvery: "10m", NagRepeats: 2})
+			check := func() {
+				checkDueTasks(scheduler.bot, store, clock, scheduler.config)
+				checkDueNags(scheduler.bot, store, clock, scheduler.config)
+			}
+
+			// Messages only lists what was delivered, not the failed attempts
+			delivered := 0
+			for i, want := range tt.want {
+				if i > 0 {
+					// Nothing goes out between the repeats
+					clock.Advance(10*time.Minute - time.Second)
+					check()
+					if messages := fake.Messages(testUserID); len(messages) != delivered {
+						t.Fatalf("sent %d messages a second before %s", len(messages), clock.Now().Add(time.Second).Format("15:04"))
+					}
+					clock.Advance(time.Second)
+				}
+				if i == 1 && tt.failure != nil {
+					fake.FailNext("sendMessage", *tt.failure)
+				}
+				check()
+
+				messages := fake.Messages(testUserID)
+				if want != "" {
+					delivered++
+				}
+				if len(messages) != delivered || want != "" && !strings.Contains(messages[delivered-1].Text, want) {
+					t.Fatalf("at %s sent %d messages, want %d ending with %q", clock.Now().Format("15:04"), len(messages), delivered, want)
+				}
+				if i == 1 && tt.done {
+					if err := store.MarkTaskAsCompleted(task.ID); err != nil {
+						t.Fatalf("MarkTaskAsCompleted() error = %v", err)
+					}
+				}
+			}
+
+			if got, err := store.GetUserTask(task.UserID, task.ID); err != nil || !tt.done && got.NextNagAt != nil {
+				t.Errorf("task = %+v, %v, want it no longer nagging", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// callbackDataVersion prefixes all inline button data, so buttons created by an
+// older format can be recognised and rejected instead of being misread
+const callbackDataVersion = "v1"
+
+// CallbackData is the parsed form of inline button data such as "v1:task:42:snooze:10m"
+type CallbackData struct {
+	Namespace string   // handler the button belongs to, e.g. "task"
+	ID        uint64   // ID of the object the button acts on
+	Action    string   // e.g. "done" or "snooze"
+	Args      []string // extra action arguments, e.g. "10m"
+}
+
+// NewCallbackData encodes inline button data in the versioned callback scheme
+func NewCallbackData(namespace string, id uint, action string, args ...string) string {
+	parts := append([]string{callbackDataVersion, namespace, strconv.FormatUint(uint64(id), 10), action}, args...)
+	return strings.Join(parts, ":")
+}
+
+// ParseCallbackData decodes inline button data created by NewCallbackData
+func ParseCallbackData(data string) (*CallbackData, error) {
+	parts := strings.Split(data, ":")
+	if len(parts) < 4 {
+		return nil, fmt.Errorf("malformed callback data %q", data)
+	}
+	if parts[0] != callbackDataVersion {
+		return nil, fmt.Errorf("unsupported callback data version %q", parts[0])
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid callback data ID %q", parts[2])
+	}
+	return &CallbackData{
+		Namespace: parts[1],
+		ID:        id,
+		Action:    parts[3],
+		Args:      parts[4:],
+	}, nil
+}
+
+// CallbackContext is what a callback handler gets to work with
+type CallbackContext struct {
+	Bot   Messenger
+	Query *tgbotapi.CallbackQuery // Query.Message is always set
+	Store Store
+	Clock Clock
+	User  *User
+	Data  *CallbackData
+}
+
+// CallbackResult tells the dispatcher how to answer a callback query and
+// how to update the message the button belongs to
+type CallbackResult struct {
+	Answer   string                         // short notification shown to the user
+	EditText string                         // replaces the message text if set
+	Keyboard *tgbotapi.InlineKeyboardMarkup // keyboard for the message; nil removes it when EditText is set
+}
+
+// CallbackHandler handles button presses for one callback namespace
+type CallbackHandler func(ctx *CallbackContext) CallbackResult
+
+// Dispatcher routes incoming Telegram updates to message and callback handlers
+type Dispatcher struct {
+	bot       Messenger
+	botID     int64 // the bot's own user ID, to recognize replies to its messages
+	parser    ReminderParser
+	store     Store
+	clock     Clock
+	callbacks map[string]CallbackHandler
+	jobs      *jobGroup // background LLM work started by updates
+
+	// Conversations in progress, keyed by chat or by user and task. They are short-lived and
+	// forgotten when the bot restarts.
+	snoozePrompts    *expiringMap[int64, snoozePrompt]   // task a chat is choosing a custom snooze for
+	clarifications   *expiringMap[int64, *reminderDraft] // reminder waiting for an answer to a follow-up question
+	clarificationSeq atomic.Uint64                       // numbers drafts so buttons of an older question can be told apart
+	edits            *expiringMap[editKey, pendingEdit]  // edits waiting for the user to confirm them
+}
+
+// NewDispatcher creates a dispatcher with the bot's callback handlers registered.
+// botID is the user ID of the bot itself, as returned by getMe.
+func NewDispatcher(bot Messenger, botID int64, parser ReminderParser, store Store, clock Clock) *Dispatcher {
+	d := &Dispatcher{
+		bot:       bot,
+		botID:     botID,
+		parser:    parser,
+		store:     store,
+		clock:     clock,
+		callbacks: make(map[string]CallbackHandler),
+		jobs:      newJobGroup(),
+
+		snoozePrompts:  newExpiringMap[int64, snoozePrompt](10*time.Minute, clock),
+		clarifications: newExpiringMap[int64, *reminderDraft](10*time.Minute, clock),
+		edits:          newExpiringMap[editKey, pendingEdit](15*time.Minute, clock),
+	}
+	d.HandleCallback("task", d.handleTaskCallback)
+	d.HandleCallback("edit", d.handleEditCallback)
+	d.HandleCallback("clarify", d.handleClarifyCallback)
+	return d
+}
+
+// Shutdown waits for background jobs started by earlier updates to finish, up to the deadline of ctx.
+// Call it once no more updates are dispatched.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	return d.jobs.Drain(ctx)
+}
+
+// HandleCallback registers the handler for a callback namespace
+func (d *Dispatcher) HandleCallback(namespace string, handler CallbackHandler) {
+	d.callbacks[namespace] = handler
+}
+
+// Dispatch handles a single update from Telegram
+func (d *Dispatcher) Dispatch(update tgbotapi.Update) {
+	switch {
+	case update.CallbackQuery != nil:
+		d.dispatchCallback(update.CallbackQuery)
+	case update.Message != nil:
+		d.handleMessage(update.Message)
+	case update.EditedMessage != nil:
+		d.handleEditedMessage(update.EditedMessage)
+	}
+}
+
+// dispatchCallback routes a button press to its namespace handler, answers the
+// callback query and edits the original message in place
+func (d *Dispatcher) dispatchCallback(query *tgbotapi.CallbackQuery) {
+	data, err := ParseCallbackData(query.Data)
+	if err != nil {
+		log.Printf("Ignoring callback query: %v", err)
+		d.answerCallback(query, "This button has expired")
+		return
+	}
+
+	handler, ok := d.callbacks[data.Namespace]
+	if !ok {
+		log.Printf("No callback handler for namespace %q", data.Namespace)
+		d.answerCallback(query, "Unknown action")
+		return
+	}
+
+	// Buttons on inline mode messages come without the message; every handler acts on its chat
+	if query.Message == nil {
+		log.Printf("Ignoring callback query %s without a message", query.ID)
+		d.answerCallback(query, "This button can't be used here")
+		return
+	}
+
+	user, err := d.store.GetUserByTelegramID(query.From.ID)
+	if err != nil {
+		d.answerCallback(query, "Please send /start first")
+		return
+	}
+
+	result := handler(&CallbackContext{Bot: d.bot, Query: query, Store: d.store, Clock: d.clock, User: user, Data: data})
+	d.answerCallback(query, result.Answer)
+
+	var edit tgbotapi.Chattable
+	switch {
+	case result.EditText != "" && result.Keyboard != nil:
+		edit = tgbotapi.NewEditMessageTextAndMarkup(query.Message.Chat.ID, query.Message.MessageID, result.EditText, *result.Keyboard)
+	case result.EditText != "":
+		edit = tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, result.EditText)
+	case result.Keyboard != nil:
+		edit = tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID, *result.Keyboard)
+	default:
+		return
+	}
+	if _, err := d.bot.Send(edit); err != nil {
+		log.Printf("Error editing message: %v", err)
+	}
+}
+
+// answerCallback acknowledges a callback query so Telegram stops showing a loading spinner
+func (d *Dispatcher) answerCallback(query *tgbotapi.CallbackQuery, text string) {
+	if _, err := d.bot.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		log.Printf("Error answering callback query: %v", err)
+	}
+}
+
+// handleEditedMessage tells the user that edits to earlier messages are not applied
+func (d *Dispatcher) handleEditedMessage(message *tgbotapi.Message) {
+	log.Printf("Ignoring edited message %d in chat %d", message.MessageID, message.Chat.ID)
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, "✏️ I noticed you edited this message. Edits aren't applied to reminders I've already created - check /mytasks.")
+	msg.ReplyToMessageID = message.MessageID
+	if _, err := d.bot.Send(msg); err != nil {
+		log.Printf("Error sending message: %v", err)
+	}
+}
+
+// startReplyEdit treats a reply to one of the bot's confirmations or reminders as a change to
+// that task, e.g. "make it 6pm instead". It returns false if the message is not such a reply.
+func (d *Dispatcher) startReplyEdit(message *tgbotapi.Message, user *User, text string) bool {
+	replyTo := message.ReplyToMessage
+	if replyTo == nil || replyTo.From == nil || replyTo.From.ID != d.botID || strings.HasPrefix(text, "/") {
+		return false
+	}
+
+	tasks, err := d.store.FindTasksByMessage(user.ID, message.Chat.ID, replyTo.MessageID)
+	if err != nil {
+		log.Printf("Error finding tasks for message %d: %v", replyTo.MessageID, err)
+		return false
+	}
+	if len(tasks) == 0 {
+		return false
+	}
+
+	if len(tasks) > 1 || tasks[0].Status != "pending" {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "🤔 I'm not sure which reminder you mean. Use /mytasks and then `/edit <number> <change>`.")
+		msg.ReplyToMessageID = message.MessageID
+		if _, err := d.bot.Send(msg); err != nil {
+			log.Printf("Error sending message: %v", err)
+		}
+		return true
+	}
+
+	task := &tasks[0]
+	d.jobs.Go(func(ctx context.Context) {
+		d.processTaskEdit(ctx, user, task, text, message.Chat.ID, message.MessageID)
+	})
+	return true
+}
+
+// startReminder replies with a placeholder right away, then parses the draft with the LLM in the
+// background and edits the placeholder with the result
+func (d *Dispatcher) startReminder(user *User, draft *reminderDraft, chatID int64, replyTo int) {
+	msg := tgbotapi.NewMessage(chatID, "⏳ Working on it...")
+	msg.ReplyToMessageID = replyTo
+	sent, err := d.bot.Send(msg)
+	if err != nil {
+		log.Printf("Error sending placeholder response: %v", err)
+	}
+
+	// Process the reminder in a separate goroutine
+	d.jobs.Go(func(ctx context.Context) {
+		d.processUserReminder(ctx, user, draft, chatID, sent.MessageID)
+	})
+}
+
+// handleMessage handles a new message sent to the bot
+func (d *Dispatcher) handleMessage(message *tgbotapi.Message) {
+	// Get or create user in database
+	var username, languageCode *string
+	if message.From.UserName != "" {
+		username = &message.From.UserName
+	}
+	if message.From.LanguageCode != "" {
+		languageCode = &message.From.LanguageCode
+	}
+
+	user, err := d.store.GetOrCreateUser(
+		int64(message.From.ID),
+		username,
+		&message.From.FirstName,
+		&message.From.LastName,
+		languageCode,
+	)
+	if err != nil {
+		log.Printf("Error handling user: %v", err)
+		return
+	}
+
+	// Handle different types of messages
+	var responseText string
+	var replyMarkup *tgbotapi.InlineKeyboardMarkup
+
+	if message.Text != "" {
+		// Check for special commands
+		text := strings.TrimSpace(message.Text)
+
+		if reply, ok := d.handleCustomSnoozeReply(user, message, text); ok {
+			responseText = reply
+		} else if d.startReplyEdit(message, user, text) {
+			return // The edit is processed in the background
+		} else if strings.HasPrefix(text, "/edit") {
+			task, change, errText := parseEditCommand(d.store, text, user)
+			if task == nil {
+				responseText = errText
+			} else {
+				d.jobs.Go(func(ctx context.Context) {
+					d.processTaskEdit(ctx, user, task, change, message.Chat.ID, message.MessageID)
+				})
+				return
+			}
+		} else if strings.HasPrefix(text, "/settimezone") {
+			responseText = handleSetTimezoneCommand(d.store, text, user, d.clock.Now())
+		} else if strings.HasPrefix(text, "/alerts") {
+			responseText = handleAlertsCommand(d.store, text, user)
+		} else if strings.HasPrefix(text, "/nag") {
+			responseText = handleNagCommand(d.store, text, user)
+		} else if strings.HasPrefix(text, "/quiet") {
+			responseText = handleQuietCommand(d.store, text, user)
+		} else if strings.HasPrefix(text, "/dnd") {
+			responseText = handleDNDCommand(d.store, text, user, d.clock.Now())
+		} else if strings.HasPrefix(text, "/mytasks") {
+			responseText, replyMarkup = handleMyTasksCommand(d.store, user)
+		} else if strings.HasPrefix(text, "/cancel") {
+			responseText, replyMarkup = handleRemoveCommand(d.store, text, user, "cancel")
+		} else if strings.HasPrefix(text, "/delete") {
+			responseText, replyMarkup = handleRemoveCommand(d.store, text, user, "delete")
+		} else if strings.HasPrefix(text, "/start") {
+			responseText = "Welcome to GoRemindBot! I'm here to help you create and manage reminders. Use /help to get started or /mytasks to view your tasks."
+		} else if strings.HasPrefix(text, "/help") {
+			responseText = handleHelpCommand()
+		} else if strings.ToLower(strings.TrimSpace(text)) == "done" {
+			responseText = handleDoneCommand(d.store, user)
+		} else if d.answerClarification(message, user, text) {
+			return // The answer is processed in the background
+		} else {
+			// Regular text message - parse it as a new reminder
+			d.startReminder(user, &reminderDraft{Original: message.Text}, message.Chat.ID, message.MessageID)
+			return // Skip the generic reply for this message
+		}
+	} else if message.Voice != nil {
+		// Audio/voice message
+		responseText = "🎵 I received your audio message! I can only process text messages for now."
+	} else if message.Audio != nil {
+		// Audio file
+		responseText = "🎶 I received your audio file! I can only process text messages for now."
+	} else if message.Photo != nil {
+		// Photo message
+		responseText = "📸 I received your photo! I can only process text messages for now."
+	} else if message.Video != nil {
+		// Video message
+		responseText = "🎥 I received your video! I can only process text messages for now."
+	} else if message.Document != nil {
+		// Document message
+		responseText = "📄 I received your document! I can only process text messages for now."
+	} else {
+		// Other message types
+		responseText = "I received your message, but I can only process text messages for now."
+	}
+
+	// Create a reply message
+	msg := tgbotapi.NewMessage(message.Chat.ID, responseText)
+	msg.ReplyToMessageID = message.MessageID
+	if replyMarkup != nil {
+		msg.ReplyMarkup = replyMarkup
+	}
+
+	// Send the message
+	if _, err := d.bot.Send(msg); err != nil {
+		// Note that panics are a bad way to handle errors. Telegram can
+		// have service outages or network errors, you should retry sending
+		// messages or more gracefully handle failures.
+		log.Printf("Error sending message: %v", err)
+	}
+}
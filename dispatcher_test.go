@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const testUserID int64 = 42
+
+// newTestDispatcher wires a dispatcher to a fake Telegram server, a memory store and a fake clock
+func newTestDispatcher(t *testing.T) (*Dispatcher, *FakeTelegram, Store, *FakeClock) {
+	t.Helper()
+	return newTestDispatcherWith(t, func(clock Clock) ReminderParser { return NewRuleParser(clock) })
+}
+
+// newTestDispatcherWith is newTestDispatcher with the parser made by newParser
+func newTestDispatcherWith(t *testing.T, newParser func(Clock) ReminderParser) (*Dispatcher, *FakeTelegram, Store, *FakeClock) {
+	t.Helper()
+	clock := NewFakeClock(testStart)
+	fake := NewFakeTelegram(clock)
+	t.Cleanup(fake.Close)
+	bot, err := fake.NewBot()
+	if err != nil {
+		t.Fatalf("failed to create bot: %v", err)
+	}
+	store := NewMemoryStore(clock)
+	return NewDispatcher(bot, fake.Bot.ID, newParser(clock), store, clock), fake, store, clock
+}
+
+// newTestTask creates a user in UTC and a task of theirs due at the given UTC time
+func newTestTask(t *testing.T, store Store, title, due string) (*User, *Task) {
+	t.Helper()
+	user, err := store.GetOrCreateUser(testUserID, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	task, err := store.CreateTask(user.ID, &ReminderPayload{Type: "task", Title: title, Datetime: due, Timezone: "UTC"})
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	return user, task
+}
+
+// callbackUpdate builds a button press; messageID 0 stands for a button on an inline mode
+// message, which Telegram sends without the message
+func callbackUpdate(messageID int, data string) tgbotapi.Update {
+	return callbackUpdateFrom(testUserID, messageID, data)
+}
+
+// callbackUpdateFrom builds a button press by another user in their private chat
+func callbackUpdateFrom(userID int64, messageID int, data string) tgbotapi.Update {
+	query := &tgbotapi.CallbackQuery{ID: "1", From: &tgbotapi.User{ID: userID}, Data: data}
+	if messageID == 0 {
+		query.InlineMessageID = "inline"
+	} else {
+		query.Message = &tgbotapi.Message{MessageID: messageID, Chat: &tgbotapi.Chat{ID: userID, Type: "private"}}
+	}
+	return tgbotapi.Update{CallbackQuery: query}
+}
+
+// lastAnswer returns the text of the last callback query answer
+func lastAnswer(t *testing.T, fake *FakeTelegram) string {
+	t.Helper()
+	calls := fake.Calls("answerCallbackQuery")
+	if len(calls) == 0 {
+		t.Fatalf("callback query was not answered")
+	}
+	return calls[len(calls)-1].Params["text"]
+}
+
+func TestParseCallbackData(t *testing.T) {
+	data, err := ParseCallbackData(NewCallbackData("task", 42, "snooze", "10m"))
+	if err != nil {
+		t.Fatalf("ParseCallbackData() error = %v", err)
+	}
+	if data.Namespace != "task" || data.ID != 42 || data.Action != "snooze" || len(data.Args) != 1 || data.Args[0] != "10m" {
+		t.Errorf("ParseCallbackData() = %+v", data)
+	}
+
+	for _, bad := range []string{"task:42:done", "v0:task:42:done", "v1:task:x:done", "v1:task"} {
+		if _, err := ParseCallbackData(bad); err == nil {
+			t.Errorf("ParseCallbackData(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestDispatchCallbackWithoutMessage(t *testing.T) {
+	d, fake, store, _ := newTestDispatcher(t)
+	_, task := newTestTask(t, store, "Call mom", "2026-10-17T09:00:00")
+
+	d.Dispatch(callbackUpdate(0, NewCallbackData("task", task.ID, "snooze", "custom")))
+
+	if got := lastAnswer(t, fake); got != "This button can't be used here" {
+		t.Errorf("answer = %q", got)
+	}
+	if calls := fake.Calls("sendMessage"); len(calls) != 0 {
+		t.Errorf("sent %d messages, want none", len(calls))
+	}
+}
+
+func TestCustomSnoozePrompt(t *testing.T) {
+	d, fake, store, _ := newTestDispatcher(t)
+	_, task := newTestTask(t, store, "Call mom", "2026-10-17T09:00:00")
+
+	d.Dispatch(callbackUpdate(7, NewCallbackData("task", task.ID, "snooze", "custom")))
+
+	calls := fake.Calls("sendMessage")
+	if len(calls) != 1 {
+		t.Fatalf("sent %d messages, want the snooze prompt", len(calls))
+	}
+	if want := "⏳ How long should I snooze 'Call mom'? Reply with a duration like 30m, 2h or 1d."; calls[0].Params["text"] != want {
+		t.Errorf("prompt = %q, want %q", calls[0].Params["text"], want)
+	}
+
+	prompt := fake.Messages(testUserID)[0]
+	reply := fake.Reply(testUserID, prompt.MessageID, "30m")
+	d.Dispatch(tgbotapi.Update{Message: &reply})
+	task, err := store.GetUserTask(task.UserID, task.ID)
+	if err != nil {
+		t.Fatalf("failed to load task: %v", err)
+	}
+	if want := time.Date(2026, 10, 17, 8, 30, 0, 0, time.UTC); !task.DueDateTime.Equal(want) {
+		t.Errorf("snoozed until %v, want %v", task.DueDateTime, want)
+	}
+}
+
+func TestCustomSnoozePromptLetsOtherMessagesThrough(t *testing.T) {
+	d, fake, store, _ := newTestDispatcher(t)
+	user, task := newTestTask(t, store, "Call mom", "2026-10-17T09:00:00")
+	d.Dispatch(callbackUpdate(7, NewCallbackData("task", task.ID, "snooze", "custom")))
+
+	// A message that doesn't reply to the prompt is a new reminder, even while the prompt is pending
+	message := fake.SendText(testUserID, "remind me to water the plants in 2 hours")
+	d.Dispatch(tgbotapi.Update{Message: &message})
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to finish processing: %v", err)
+	}
+
+	tasks, err := store.GetUserTasks(user.ID)
+	if err != nil || len(tasks) != 2 {
+		t.Fatalf("GetUserTasks() = %v, %v, want the task and the new reminder", taskIDs(tasks), err)
+	}
+	if tasks[1].Title != "Water the plants" {
+		t.Errorf("new reminder = %q, want 'Water the plants'", tasks[1].Title)
+	}
+	if want := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC); !tasks[0].DueDateTime.Equal(want) {
+		t.Errorf("the message snoozed the task to %v", tasks[0].DueDateTime)
+	}
+	if _, ok := d.snoozePrompts.Get(testUserID); !ok {
+		t.Errorf("the prompt is no longer pending")
+	}
+}
+
+func TestConversationStateIsPerDispatcher(t *testing.T) {
+	d, _, store, _ := newTestDispatcher(t)
+	_, task := newTestTask(t, store, "Call mom", "2026-10-17T09:00:00")
+	d.Dispatch(callbackUpdate(7, NewCallbackData("task", task.ID, "snooze", "custom")))
+
+	// Another bot in the same process knows nothing of the first one's prompt, so "30m" is
+	// taken as a new reminder instead of a snooze
+	other, otherFake, otherStore, _ := newTestDispatcher(t)
+	_, otherTask := newTestTask(t, otherStore, "Call mom", "2026-10-17T09:00:00")
+	reply := otherFake.SendText(testUserID, "30m")
+	other.Dispatch(tgbotapi.Update{Message: &reply})
+	if err := other.Shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to finish processing: %v", err)
+	}
+
+	otherTask, err := otherStore.GetUserTask(otherTask.UserID, otherTask.ID)
+	if err != nil {
+		t.Fatalf("failed to load task: %v", err)
+	}
+	if want := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC); !otherTask.DueDateTime.Equal(want) {
+		t.Errorf("the other dispatcher snoozed its task to %v", otherTask.DueDateTime)
+	}
+	if _, ok := d.snoozePrompts.Get(testUserID); !ok {
+		t.Errorf("the first dispatcher lost its prompt")
+	}
+}
+
+func TestCustomSnoozePromptExpires(t *testing.T) {
+	d, fake, store, clock := newTestDispatcher(t)
+	_, task := newTestTask(t, store, "Call mom", "2026-10-17T09:00:00")
+	d.Dispatch(callbackUpdate(7, NewCallbackData("task", task.ID, "snooze", "custom")))
+
+	// Ten minutes later the prompt is gone, so the reply is taken as a new reminder
+	clock.Advance(10*time.Minute + time.Second)
+	reply := fake.Reply(testUserID, fake.Messages(testUserID)[0].MessageID, "30m")
+	d.Dispatch(tgbotapi.Update{Message: &reply})
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to finish processing: %v", err)
+	}
+
+	task, err := store.GetUserTask(task.UserID, task.ID)
+	if err != nil {
+		t.Fatalf("failed to load task: %v", err)
+	}
+	if want := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC); !task.DueDateTime.Equal(want) {
+		t.Errorf("an expired prompt snoozed the task to %v", task.DueDateTime)
+	}
+}
+
+func TestUndoCallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		messageID int
+		answer    string
+		removed   bool
+	}{
+		{name: "on the confirmation", messageID: 7, answer: "↩️ Removed 'Call mom'", removed: true},
+		{name: "without a message", messageID: 0, answer: "This button can't be used here", removed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, fake, store, _ := newTestDispatcher(t)
+			user, task := newTestTask(t, store, "Call mom", "2026-10-17T09:00:00")
+
+			d.Dispatch(callbackUpdate(tt.messageID, NewCallbackData("task", task.ID, "undo")))
+
+			if got := lastAnswer(t, fake); got != tt.answer {
+				t.Errorf("answer = %q, want %q", got, tt.answer)
+			}
+			_, err := store.GetUserTask(user.ID, task.ID)
+			if removed := err != nil; removed != tt.removed {
+				t.Errorf("task removed = %v, want %v", removed, tt.removed)
+			}
+		})
+	}
+}
+
+func TestClarifyCallbackWithoutMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		messageID int
+		answer    string
+	}{
+		{name: "on the question", messageID: 7, answer: "This question has expired"},
+		{name: "without a message", messageID: 0, answer: "This button can't be used here"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, fake, store, _ := newTestDispatcher(t)
+			if _, err := store.GetOrCreateUser(testUserID, nil, nil, nil, nil); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+
+			d.Dispatch(callbackUpdate(tt.messageID, NewCallbackData("clarify", 1, "pick", "0")))
+
+			if got := lastAnswer(t, fake); got != tt.answer {
+				t.Errorf("answer = %q, want %q", got, tt.answer)
+			}
+		})
+	}
+}
+
+func TestRemoveCallbackAnswer(t *testing.T) {
+	tests := []struct {
+		action string
+		answer string
+		status string
+	}{
+		{action: "cancel", answer: "❌ Cancelled 'Call mom'", status: "cancelled"},
+		{action: "delete", answer: "🗑 Deleted 'Call mom'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			d, fake, store, _ := newTestDispatcher(t)
+			user, task := newTestTask(t, store, "Call mom", "2026-10-17T09:00:00")
+
+			d.Dispatch(callbackUpdate(7, NewCallbackData("task", task.ID, tt.action)))
+
+			if got := lastAnswer(t, fake); got != tt.answer {
+				t.Errorf("answer = %q, want %q", got, tt.answer)
+			}
+			got, err := store.GetUserTask(user.ID, task.ID)
+			switch {
+			case tt.status == "" && err == nil:
+				t.Errorf("task was not deleted")
+			case tt.status != "" && (err != nil || got.Status != tt.status):
+				t.Errorf("task = %+v, %v, want status %s", got, err, tt.status)
+			}
+		})
+	}
+}
+
+func TestRemoveSeriesCallback(t *testing.T) {
+	tests := []struct {
+		action string
+		text   string
+	}{
+		{action: "cancel", text: "❌ Cancelled the recurring series 'Stretch' (1 task)."},
+		{action: "delete", text: "🗑 Deleted the recurring series 'Stretch' (1 task)."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			d, fake, store, _ := newTestDispatcher(t)
+			daily := "FREQ=DAILY"
+			task := newStoreTask(t, store, ReminderPayload{Title: "Stretch", Datetime: "2026-10-17T09:00:00", Recurrence: &daily})
+
+			d.Dispatch(callbackUpdate(7, NewCallbackData("task", task.ID, tt.action, "series")))
+
+			calls := fake.Calls("editMessageText")
+			if len(calls) != 1 {
+				t.Fatalf("edited %d messages, want the confirmation", len(calls))
+			}
+			if got := calls[0].Params["text"]; got != tt.text {
+				t.Errorf("confirmation = %q, want %q", got, tt.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// editKey identifies a pending edit by the user who asked for it and the task it changes
+type editKey struct {
+	UserID uint
+	TaskID uint
+}
+
+// pendingEdit is a change waiting for confirmation, along with the task as it was when the
+// change was worked out
+type pendingEdit struct {
+	Payload *ReminderPayload
+	Fields  editedFields
+}
+
+// editedFields are the fields of a task an edit can change. The bot's own bookkeeping, such as
+// claims, retries and nags, leaves them alone, so comparing them tells whether the user changed
+// the task while an edit waited for confirmation.
+type editedFields struct {
+	Title           string
+	Description     string
+	DueDateTime     time.Time
+	Timezone        string
+	Recurrence      string
+	AlertOffsets    string
+	NagEveryMinutes int
+	NagRepeats      int
+	Urgent          bool
+}
+
+// editedFieldsOf returns the fields of a task an edit can change
+func editedFieldsOf(task *Task) editedFields {
+	fields := editedFields{
+		Title:           task.Title,
+		Description:     task.Description,
+		DueDateTime:     task.DueDateTime.UTC(),
+		Timezone:        task.Timezone,
+		AlertOffsets:    task.AlertOffsets,
+		NagEveryMinutes: task.NagEveryMinutes,
+		NagRepeats:      task.NagRepeats,
+		Urgent:          task.Urgent,
+	}
+	if task.Recurrence != nil {
+		fields.Recurrence = *task.Recurrence
+	}
+	return fields
+}
+
+// parseEditCommand parses "/edit <number> <change>" and resolves the task it refers to.
+// It returns a user-facing error message when the command can't be used.
+func parseEditCommand(store Store, text string, user *User) (*Task, string, string) {
+	parts := strings.Fields(text)
+	if len(parts) < 3 {
+		return nil, "", "Please tell me which task to change and how, e.g. `/edit 2 make it 6pm instead`. You can also reply to one of my reminders with the change."
+	}
+
+	task, err := resolveTaskReference(store, user, parts[1])
+	if err != nil {
+		return nil, "", fmt.Sprintf("❌ %v. Use /mytasks to see your tasks.", err)
+	}
+	if task.Status != "pending" {
+		return nil, "", fmt.Sprintf("❌ '%s' is already %s and can't be edited.", task.Title, task.Status)
+	}
+	return task, strings.Join(parts[2:], " "), ""
+}
+
+// processTaskEdit runs the requested change through the LLM and asks the user to confirm the result
+func (d *Dispatcher) processTaskEdit(ctx context.Context, user *User, task *Task, change string, chatID int64, replyTo int) {
+	reply := func(text string, keyboard *tgbotapi.InlineKeyboardMarkup) {
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ReplyToMessageID = replyTo
+		if keyboard != nil {
+			msg.ReplyMarkup = keyboard
+		}
+		if _, err := d.bot.Send(msg); err != nil {
+			log.Printf("Error sending edit response: %v", err)
+		}
+	}
+
+	payload, err := d.parser.ParseTaskEdit(ctx, task, change, user.Timezone)
+	if err != nil {
+		log.Printf("Error parsing edit for task %d: %v", task.ID, err)
+		reply("❌ Sorry, I couldn't understand that change. Please try rephrasing it.", nil)
+		return
+	}
+	if payload.Type != "task" {
+		reply("❌ Sorry, I couldn't turn that into a change to your reminder.", nil)
+		return
+	}
+
+	diff, err := taskEditDiff(task, payload, user.Timezone)
+	if err != nil {
+		log.Printf("Invalid edit for task %d: %v", task.ID, err)
+		reply("❌ Sorry, I couldn't understand that change. Please try rephrasing it.", nil)
+		return
+	}
+	if diff == "" {
+		reply(fmt.Sprintf("🤔 That doesn't change anything about '%s'.", task.Title), nil)
+		return
+	}
+
+	d.edits.Set(editKey{UserID: user.ID, TaskID: task.ID}, pendingEdit{Payload: payload, Fields: editedFieldsOf(task)})
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💾 Save", NewCallbackData("edit", task.ID, "save")),
+			tgbotapi.NewInlineKeyboardButtonData("✖️ Discard", NewCallbackData("edit", task.ID, "discard")),
+		),
+	)
+	reply(fmt.Sprintf("✏️ Here's the change to '%s':\n\n%s\nSave it?", task.Title, diff), &keyboard)
+}
+
+// taskEditDiff describes the fields an edit changes, one "old → new" line per field
+func taskEditDiff(task *Task, payload *ReminderPayload, userTimezone string) (string, error) {
+	timezone := payload.Timezone
+	if timezone == "" {
+		timezone = task.Timezone
+	}
+	newDue, err := ParseTaskDateTime(payload.Datetime, timezone)
+	if err != nil {
+		return "", err
+	}
+	newRecurrence, err := canonicalRecurrence(payload.Recurrence, newDue, timezone)
+	if err != nil {
+		return "", err
+	}
+	newAlerts, err := canonicalAlerts(payload.Alerts)
+	if err != nil {
+		return "", err
+	}
+	newNagEvery, newNagRepeats, err := nagPolicy(payload.NagEvery, payload.NagRepeats)
+	if err != nil {
+		return "", err
+	}
+
+	describe := func(recurrence *string, tz string) string {
+		if recurrence == nil {
+			return "never"
+		}
+		rule, err := ParseRecurrence(*recurrence, LoadTimezone(tz))
+		if err != nil {
+			return *recurrence
+		}
+		return rule.Describe()
+	}
+	describeAlertsOrNone := func(alerts string) string {
+		if alerts == "" {
+			return "none"
+		}
+		return describeAlerts(alerts)
+	}
+	describeNagOrOff := func(minutes, repeats int) string {
+		if minutes == 0 {
+			return "off"
+		}
+		return describeNag(minutes, repeats)
+	}
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+
+	var diff string
+	line := func(label, old, new string) {
+		if old != new {
+			diff += fmt.Sprintf("%s: %s → %s\n", label, old, new)
+		}
+	}
+	line("📌 Title", task.Title, payload.Title)
+	line("📝 Description", task.Description, payload.Description)
+	line("⏰ When", FormatTaskDateTime(task.DueDateTime, userTimezone), FormatTaskDateTime(newDue, userTimezone))
+	line("🔁 Repeats", describe(task.Recurrence, task.Timezone), describe(newRecurrence, timezone))
+	line("🔔 Alerts", describeAlertsOrNone(task.AlertOffsets), describeAlertsOrNone(newAlerts))
+	line("📣 Nagging", describeNagOrOff(task.NagEveryMinutes, task.NagRepeats), describeNagOrOff(newNagEvery, newNagRepeats))
+	line("🚨 Urgent", yesNo(task.Urgent), yesNo(payload.Urgent))
+	return diff, nil
+}
+
+// handleEditCallback handles the Save and Discard buttons of an edit confirmation
+func (d *Dispatcher) handleEditCallback(ctx *CallbackContext) CallbackResult {
+	taskID := uint(ctx.Data.ID)
+	key := editKey{UserID: ctx.User.ID, TaskID: taskID}
+
+	if ctx.Data.Action == "discard" {
+		d.edits.Delete(key)
+		return CallbackResult{Answer: "Discarded", EditText: "✖️ Change discarded."}
+	}
+	if ctx.Data.Action != "save" {
+		return CallbackResult{Answer: "Unknown action"}
+	}
+
+	edit, ok := d.edits.Take(key)
+	if !ok {
+		return CallbackResult{Answer: "This edit has expired", EditText: "⌛ This edit has expired. Please send the change again."}
+	}
+
+	task, err := ctx.Store.GetUserTask(ctx.User.ID, taskID)
+	if err != nil || task.Status != "pending" {
+		return CallbackResult{Answer: "This task can no longer be edited"}
+	}
+	// The change was worked out against the task as it was then; applying it now could undo
+	// whatever changed the task in the meantime
+	if editedFieldsOf(task) != edit.Fields {
+		return CallbackResult{Answer: "This task has changed", EditText: fmt.Sprintf("⚠️ '%s' changed since I suggested this edit. Please send the change again.", task.Title)}
+	}
+
+	if err := ctx.Store.UpdateTaskFromPayload(task, edit.Payload); err != nil {
+		log.Printf("Error updating task %d: %v", task.ID, err)
+		return CallbackResult{Answer: "❌ Failed to save the change"}
+	}
+
+	updated, err := ctx.Store.GetUserTask(ctx.User.ID, taskID)
+	if err != nil {
+		return CallbackResult{Answer: "✅ Saved", EditText: "✅ Saved your change."}
+	}
+	return CallbackResult{
+		Answer: "✅ Saved",
+		EditText: fmt.Sprintf("✅ Saved: '%s' at %s (%s)",
+			updated.Title, FormatTaskDateTime(updated.DueDateTime, ctx.User.Timezone), ctx.User.Timezone),
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// editPress is a user pressing Save or Discard on an edit confirmation
+type editPress struct {
+	from   int64
+	action string
+}
+
+func TestEditCallback(t *testing.T) {
+	const otherUserID int64 = 43
+	change := &ReminderPayload{Type: "task", Title: "Call dad", Datetime: "2026-10-17T10:00:00", Timezone: "UTC"}
+
+	tests := []struct {
+		name      string
+		presses   []editPress
+		meanwhile func(t *testing.T, store Store, task *Task, clock *FakeClock) // changes the task between the preview and the presses
+		answer    string                                                        // answer to the last press
+		title     string                                                        // task title afterwards
+	}{
+		{
+			name:    "owner saves",
+			presses: []editPress{{testUserID, "save"}},
+			answer:  "✅ Saved",
+			title:   "Call dad",
+		},
+		{
+			name:    "owner discards",
+			presses: []editPress{{testUserID, "discard"}, {testUserID, "save"}},
+			answer:  "This edit has expired",
+			title:   "Call mom",
+		},
+		{
+			name:    "another user can't save",
+			presses: []editPress{{otherUserID, "save"}},
+			answer:  "This edit has expired",
+			title:   "Call mom",
+		},
+		{
+			name:    "another user can't discard",
+			presses: []editPress{{otherUserID, "discard"}, {testUserID, "save"}},
+			answer:  "✅ Saved",
+			title:   "Call dad",
+		},
+		{
+			name:    "task changed since the preview",
+			presses: []editPress{{testUserID, "save"}},
+			meanwhile: func(t *testing.T, store Store, task *Task, clock *FakeClock) {
+				clock.Advance(time.Minute)
+				if err := store.SnoozeTask(task, clock.Now().Add(time.Hour)); err != nil {
+					t.Fatalf("failed to snooze: %v", err)
+				}
+			},
+			answer: "This task has changed",
+			title:  "Call mom",
+		},
+		{
+			name:    "reminder sent since the preview",
+			presses: []editPress{{testUserID, "save"}},
+			meanwhile: func(t *testing.T, store Store, task *Task, clock *FakeClock) {
+				clock.Advance(10 * time.Minute)
+				if _, err := store.ClaimDueTasks(testWorker, clock.Now(), time.Minute); err != nil {
+					t.Fatalf("failed to claim: %v", err)
+				}
+				if err := store.MarkTaskReminderSent(task.ID, testWorker, nil); err != nil {
+					t.Fatalf("failed to mark the reminder sent: %v", err)
+				}
+			},
+			answer: "✅ Saved",
+			title:  "Call dad",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, fake, store, clock := newTestDispatcher(t)
+			user, task := newTestTask(t, store, "Call mom", "2026-10-17T08:10:00")
+			if _, err := store.GetOrCreateUser(otherUserID, nil, nil, nil, nil); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			d.edits.Set(editKey{UserID: user.ID, TaskID: task.ID}, pendingEdit{Payload: change, Fields: editedFieldsOf(task)})
+
+			if tt.meanwhile != nil {
+				tt.meanwhile(t, store, task, clock)
+			}
+			for _, press := range tt.presses {
+				d.Dispatch(callbackUpdateFrom(press.from, 7, NewCallbackData("edit", task.ID, press.action)))
+			}
+
+			if got := lastAnswer(t, fake); got != tt.answer {
+				t.Errorf("answer = %q, want %q", got, tt.answer)
+			}
+			got, err := store.GetUserTask(user.ID, task.ID)
+			if err != nil {
+				t.Fatalf("failed to load task: %v", err)
+			}
+			if got.Title != tt.title {
+				t.Errorf("title = %q, want %q", got.Title, tt.title)
+			}
+		})
+	}
+}
@@ -18,3 +18,11 @@ func cleanJSONResponse(response string) string {
 
 	return response
 }
+
+// pluralize returns singular when n is 1 and plural otherwise
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// jobGroup runs background jobs, such as LLM parsing, and lets shutdown wait for them.
+// Every job gets a context that is cancelled when draining runs out of time.
+type jobGroup struct {
+	wg      sync.WaitGroup
+	running atomic.Int64
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func newJobGroup() *jobGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobGroup{ctx: ctx, cancel: cancel}
+}
+
+// Go runs job in a new goroutine
+func (g *jobGroup) Go(job func(ctx context.Context)) {
+	g.wg.Add(1)
+	g.running.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer g.running.Add(-1)
+		job(g.ctx)
+	}()
+}
+
+// Drain waits for running jobs to finish. If ctx ends first, the jobs' context is cancelled
+// so they can give up, and an error reports how many were still running.
+func (g *jobGroup) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		g.cancel()
+		return nil
+	case <-ctx.Done():
+		n := g.running.Load()
+		g.cancel()
+		return fmt.Errorf("%d background %s still running after the shutdown deadline", n, pluralize(int(n), "job", "jobs"))
+	}
+}
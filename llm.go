@@ -4,15 +4,80 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"time"
+	"log"
+	"reflect"
+)
+
+// ReminderParser turns user messages into structured reminders. Implementations are
+// chosen by the LLM_PROVIDER setting, see NewReminderParser.
+type ReminderParser interface {
+	// ParseReminder takes a user message and returns every reminder it contains
+	ParseReminder(ctx context.Context, message string, userTimezone string) (*ParseResult, error)
+	// ParseTaskEdit applies a natural language change to an existing task and returns the updated task
+	ParseTaskEdit(ctx context.Context, task *Task, change string, userTimezone string) (*ReminderPayload, error)
+}
+
+// textGenerator sends a prompt to a language model and returns its raw text response.
+// When schema is set, the model is asked to answer with JSON matching it.
+type textGenerator interface {
+	Generate(ctx context.Context, prompt string, schema *JSONSchema) (string, error)
+}
 
-	"google.golang.org/genai"
+// Response schemas derived from the result types
+var (
+	parseResultSchema     = SchemaFor(reflect.TypeOf(ParseResult{}))
+	reminderPayloadSchema = SchemaFor(reflect.TypeOf(ReminderPayload{}))
 )
 
-// ParseReminder takes a user message and returns a structured ReminderPayload
-func ParseReminder(ctx context.Context, client *genai.Client, message string, userTimezone string) (*ReminderPayload, error) {
+// maxParseAttempts bounds how often the model is asked again after an invalid response
+const maxParseAttempts = 3
+
+// LLMParser is a ReminderParser backed by a language model. The prompts are shared;
+// only the model API behind the textGenerator differs between providers.
+type LLMParser struct {
+	generator textGenerator
+	clock     Clock // the current time in the prompts, and the reference for validation
+}
+
+// NewReminderParser creates the ReminderParser selected by the configuration, combined
+// with the rule-based parser according to RULE_PARSER. Every parser tells the time by clock.
+func NewReminderParser(ctx context.Context, config *Config, clock Clock) (ReminderParser, error) {
+	var parser ReminderParser
+	switch config.LLMProvider {
+	case LLMProviderGemini:
+		generator, err := newGeminiGenerator(ctx, config.GeminiAPIKey, config.LLMModel)
+		if err != nil {
+			return nil, err
+		}
+		parser = &LLMParser{generator: generator, clock: clock}
+	case LLMProviderOpenAI:
+		parser = &LLMParser{generator: newOpenAIGenerator(config.OpenAIBaseURL, config.OpenAIAPIKey, config.LLMModel), clock: clock}
+	case LLMProviderFake:
+		fake, err := LoadFakeParser(config.FakeLLMScript, clock)
+		if err != nil {
+			return nil, err
+		}
+		parser = fake
+	case LLMProviderRules:
+		return NewRuleParser(clock), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", config.LLMProvider)
+	}
+
+	if config.RuleParserMode == RuleParserOff {
+		return parser, nil
+	}
+	return &fallbackParser{
+		rules:      NewRuleParser(clock),
+		llm:        parser,
+		rulesFirst: config.RuleParserMode == RuleParserFirst,
+	}, nil
+}
+
+// ParseReminder takes a user message and returns every reminder it contains
+func (p *LLMParser) ParseReminder(ctx context.Context, message string, userTimezone string) (*ParseResult, error) {
 	// Get current time in user's timezone
-	now := time.Now().UTC()
+	now := p.clock.Now().UTC()
 	userTime, err := ConvertToUserTimezone(now, userTimezone)
 	if err != nil {
 		// Fall back to UTC if timezone conversion fails
@@ -27,24 +92,59 @@ func ParseReminder(ctx context.Context, client *genai.Client, message string, us
 		User timezone: %s
 
 		Rules:
-		- If the message contains a task/reminder, return JSON strictly as:
+		- If the message contains one or more tasks/reminders, return JSON strictly as:
 		{
 			"type": "task",
-			"title": string,
-			"description": string,
-			"datetime": string,
-			"timezone": string,
-			"recurrence": string|null,
-			"source_text": string,
+			"tasks": [
+				{
+					"type": "task",
+					"title": string,
+					"description": string,
+					"datetime": string,
+					"timezone": string,
+					"recurrence": string|null,
+					"alerts": [string],
+					"nag_every": string,
+					"nag_repeats": number,
+					"urgent": boolean,
+					"source_text": string
+				}
+			],
 			"llm_message": string
 		}
+		- Put every separate reminder in the message into its own entry of "tasks", e.g. "call the bank at 10 and pick up the kids at 3:30" is two tasks.
 		- If the message does NOT contain a task/reminder, return:
 		{
 			"type": "not_task",
 			"llm_message": "I don't see any task or reminder in your message. If you have any task or reminder, please let me know."
 		}
+		- If a date or time is genuinely ambiguous and you would have to guess, e.g. "call John at 7" (7 AM or 7 PM?)
+		  or "next week" (which day and time?), do not guess. Return:
+		{
+			"type": "needs_clarification",
+			"question": string,
+			"options": [string],
+			"llm_message": ""
+		}
+		  with a short question and up to 4 short candidate answers. Don't ask when the context makes the meaning clear,
+		  e.g. "call the bank at 10" is in the morning.
+		- Lines after the message starting with "Q:" and "A:" are questions you asked earlier and the user's answers.
+		  Use the answers and don't ask the same question again.
 		- Resolve relative dates like "tomorrow", "next Friday", or "in 3 hours" using the current date/time above.
-		- The "llm_message" field should be a friendly confirmation, e.g., "Sure, I'll remind you to buy medicine tomorrow at 9 AM"
+		- For repeating reminders, "datetime" is the first occurrence and "recurrence" is an RFC 5545 RRULE without DTSTART,
+		  using only FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL.
+		  Examples: "every day" -> "FREQ=DAILY", "every other Monday and Wednesday" -> "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE",
+		  "last Friday of every month" -> "FREQ=MONTHLY;BYDAY=-1FR", "every day for 5 days" -> "FREQ=DAILY;COUNT=5".
+		- If the user asks to also be alerted ahead of time, e.g. "remind me 30 minutes before" or "a day and an hour before",
+		  put those offsets in "alerts" as durations like "30m", "2h", "1d" or "1w". "datetime" stays the time of the event itself.
+		  Leave "alerts" empty if the user doesn't ask for an early alert.
+		- If the user asks to keep being reminded until they confirm, e.g. "keep reminding me every 10 minutes until I'm done"
+		  or "nag me every 5 minutes, up to 3 times", put the interval in "nag_every" as a duration like "5m" or "1h" and the
+		  number of repeats, if given, in "nag_repeats". Set "nag_every" to "off" if they ask not to be reminded again, and
+		  leave both empty otherwise.
+		- Set "urgent" to true only if the user says the reminder is urgent or must reach them even during their quiet hours,
+		  e.g. "urgent: call the hospital at 2 AM" or "wake me up even if I'm on do not disturb". Leave it out otherwise.
+		- The "llm_message" field should be a friendly confirmation covering all tasks, e.g., "Sure, I'll remind you to buy medicine tomorrow at 9 AM"
 		- IMPORTANT: Return ONLY valid JSON. Do not wrap in markdown code blocks or add any extra text.
 
 		Examples:
@@ -53,12 +153,17 @@ func ParseReminder(ctx context.Context, client *genai.Client, message string, us
 		Response:
 		{
 			"type": "task",
-			"title": "Buy medicine",
-			"description": "Reminder to buy medicine",
-			"datetime": "2025-10-23T09:00:00",
-			"timezone": "UTC",
-			"recurrence": null,
-			"source_text": "Remind me to buy medicine tomorrow at 9 AM",
+			"tasks": [
+				{
+					"type": "task",
+					"title": "Buy medicine",
+					"description": "Reminder to buy medicine",
+					"datetime": "2025-10-23T09:00:00",
+					"timezone": "UTC",
+					"recurrence": null,
+					"source_text": "Remind me to buy medicine tomorrow at 9 AM"
+				}
+			],
 			"llm_message": "Sure, I'll remind you to buy medicine tomorrow at 9 AM"
 		}
 
@@ -69,40 +174,213 @@ func ParseReminder(ctx context.Context, client *genai.Client, message string, us
 			"llm_message": "I don't see any task or reminder in your message. If you have any task or reminder, please let me know."
 		}
 
-		3) Message: "Submit the report by 5 PM today"
+		3) Message: "Remind me to call the bank at 10 and pick up the kids at 3:30 PM"
 		Response:
 		{
 			"type": "task",
-			"title": "Submit the report",
-			"description": "Submit the report by 5 PM today",
-			"datetime": "2025-10-22T17:00:00",
-			"timezone": "UTC",
-			"recurrence": null,
-			"source_text": "Submit the report by 5 PM today",
-			"llm_message": "Got it! I will remind you to submit the report by 5 PM today"
+			"tasks": [
+				{
+					"type": "task",
+					"title": "Call the bank",
+					"description": "Call the bank at 10 AM",
+					"datetime": "2025-10-22T10:00:00",
+					"timezone": "UTC",
+					"recurrence": null,
+					"source_text": "Remind me to call the bank at 10 and pick up the kids at 3:30 PM"
+				},
+				{
+					"type": "task",
+					"title": "Pick up the kids",
+					"description": "Pick up the kids at 3:30 PM",
+					"datetime": "2025-10-22T15:30:00",
+					"timezone": "UTC",
+					"recurrence": null,
+					"source_text": "Remind me to call the bank at 10 and pick up the kids at 3:30 PM"
+				}
+			],
+			"llm_message": "Got it! I'll remind you to call the bank at 10 AM and to pick up the kids at 3:30 PM"
+		}
+
+		4) Message: "Take medicine every day at 9 AM"
+		Response:
+		{
+			"type": "task",
+			"tasks": [
+				{
+					"type": "task",
+					"title": "Take medicine",
+					"description": "Daily reminder to take medicine",
+					"datetime": "2025-10-23T09:00:00",
+					"timezone": "UTC",
+					"recurrence": "FREQ=DAILY",
+					"source_text": "Take medicine every day at 9 AM"
+				}
+			],
+			"llm_message": "Sure, I'll remind you to take your medicine every day at 9 AM"
+		}
+
+		5) Message: "Dentist appointment on Friday at 4 PM, remind me a day before and 30 minutes before"
+		Response:
+		{
+			"type": "task",
+			"tasks": [
+				{
+					"type": "task",
+					"title": "Dentist appointment",
+					"description": "Dentist appointment at 4 PM",
+					"datetime": "2025-10-24T16:00:00",
+					"timezone": "UTC",
+					"recurrence": null,
+					"alerts": ["1d", "30m"],
+					"source_text": "Dentist appointment on Friday at 4 PM, remind me a day before and 30 minutes before"
+				}
+			],
+			"llm_message": "Got it! Your dentist appointment is on Friday at 4 PM, and I'll remind you a day and 30 minutes before"
+		}
+
+		6) Message: "Take out the trash at 8 PM and keep reminding me every 15 minutes until I do it"
+		Response:
+		{
+			"type": "task",
+			"tasks": [
+				{
+					"type": "task",
+					"title": "Take out the trash",
+					"description": "Take out the trash at 8 PM",
+					"datetime": "2025-10-22T20:00:00",
+					"timezone": "UTC",
+					"recurrence": null,
+					"nag_every": "15m",
+					"source_text": "Take out the trash at 8 PM and keep reminding me every 15 minutes until I do it"
+				}
+			],
+			"llm_message": "Sure, I'll remind you to take out the trash at 8 PM and keep reminding you every 15 minutes until it's done"
+		}
+
+		7) Message: "Remind me to call John at 7"
+		Response:
+		{
+			"type": "needs_clarification",
+			"question": "Should I remind you to call John at 7 AM or 7 PM?",
+			"options": ["7 AM", "7 PM"],
+			"llm_message": ""
 		}
 
 		Now analyze this user message and respond:
 		Message: "%s"
 	`, nowStr, userTimezone, userTimezone, message)
 
-	result, err := client.Models.GenerateContent(
-		ctx,
-		"gemini-2.5-flash-lite",
-		genai.Text(prompt),
-		nil,
-	)
+	return generateJSON(ctx, p.generator, prompt, parseResultSchema, func(result *ParseResult) error {
+		return ValidateParseResult(result, p.clock.Now())
+	})
+}
+
+// ParseTaskEdit applies a natural language change such as "make it 6pm instead" to an existing task
+// and returns the complete updated task as a ReminderPayload
+func (p *LLMParser) ParseTaskEdit(ctx context.Context, task *Task, change string, userTimezone string) (*ReminderPayload, error) {
+	// Get current time in user's timezone
+	now := p.clock.Now().UTC()
+	userTime, err := ConvertToUserTimezone(now, userTimezone)
 	if err != nil {
-		return nil, err
+		userTime = now
 	}
+	nowStr := userTime.Format("2006-01-02T15:04:05")
+
+	// Describe the task as the LLM would have returned it
+	current := ReminderPayload{
+		Type:        "task",
+		Title:       task.Title,
+		Description: task.Description,
+		Timezone:    task.Timezone,
+		SourceText:  task.SourceText,
+		Alerts:      alertList(task.AlertOffsets),
+		NagEvery:    formatNagEvery(task.NagEveryMinutes),
+		NagRepeats:  task.NagRepeats,
+		Urgent:      task.Urgent,
+	}
+	if due, err := ConvertToUserTimezone(task.DueDateTime, task.Timezone); err == nil {
+		current.Datetime = due.Format("2006-01-02T15:04:05")
+	}
+	if rule, err := TaskRecurrence(task); err == nil && rule != nil {
+		rrule := rule.RRule()
+		current.Recurrence = &rrule
+	}
+	currentJSON, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode task: %v", err)
+	}
+
+	prompt := fmt.Sprintf(`
+		You are an AI that edits an existing reminder based on a change requested by the user.
+		Current date and time: %s %s
+		User timezone: %s
+
+		This is the existing reminder:
+		%s
+
+		Rules:
+		- Apply ONLY the requested change and keep every other field as it is.
+		- Return the complete updated reminder as JSON with exactly the same fields:
+		  "type" (always "task"), "title", "description", "datetime", "timezone", "recurrence", "alerts", "nag_every",
+		  "nag_repeats", "urgent", "source_text", "llm_message".
+		- "datetime" is the local date and time in the reminder's timezone, formatted as 2006-01-02T15:04:05.
+		- Resolve relative dates like "Friday" or "an hour later" using the current date/time above and the existing reminder.
+		- "recurrence" is an RFC 5545 RRULE without DTSTART (e.g. "FREQ=WEEKLY;BYDAY=MO") or null if the reminder does not repeat.
+		- "alerts" lists the early alerts ahead of "datetime" as durations like "30m", "2h" or "1d", e.g. "also remind me an hour before"
+		  adds "1h" and "no early alerts" makes it empty.
+		- "nag_every" is how often the reminder is repeated until it's marked done, as a duration like "10m", and "nag_repeats"
+		  how many times at most; "keep reminding me every 5 minutes" sets "nag_every" to "5m" and "stop nagging me" sets it to "off".
+		- "urgent" is true if the reminder comes through even during the user's quiet hours, e.g. "mark it urgent" sets it and
+		  "it's not urgent" clears it.
+		- The "llm_message" field should briefly confirm the change, e.g. "Moved to Friday at 6 PM".
+		- IMPORTANT: Return ONLY valid JSON. Do not wrap in markdown code blocks or add any extra text.
+
+		Requested change: "%s"
+	`, nowStr, userTimezone, userTimezone, currentJSON, change)
+
+	return generateJSON(ctx, p.generator, prompt, reminderPayloadSchema, func(payload *ReminderPayload) error {
+		// Edits that don't touch the due time may keep one that has already passed
+		return validatePayload(payload, p.clock.Now(), payload.Datetime != current.Datetime)
+	})
+}
+
+// generateJSON asks the model for a JSON response matching schema and validates it.
+// Invalid responses are sent back to the model together with the validation errors, up to
+// maxParseAttempts times in total.
+func generateJSON[T any](ctx context.Context, generator textGenerator, prompt string, schema *JSONSchema, validate func(*T) error) (*T, error) {
+	request := prompt
+	var lastErr error
+	for attempt := 1; attempt <= maxParseAttempts; attempt++ {
+		response, err := generator.Generate(ctx, request, schema)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := decodeJSON[T](response)
+		if err == nil {
+			err = validate(result)
+		}
+		if err == nil {
+			return result, nil
+		}
+
+		lastErr = err
+		log.Printf("Rejected LLM response (attempt %d/%d): %v", attempt, maxParseAttempts, err)
+		request = fmt.Sprintf("%s\n\nYour previous response was:\n%s\n\nIt was rejected because:\n%v\n\nReturn a corrected response that fixes these problems.",
+			prompt, response, err)
+	}
+	return nil, fmt.Errorf("invalid LLM response after %d attempts: %v", maxParseAttempts, lastErr)
+}
 
+// decodeJSON unmarshals a model response into a T
+func decodeJSON[T any](response string) (*T, error) {
 	// Clean the response to remove markdown formatting
-	cleanedResponse := cleanJSONResponse(result.Text())
+	cleanedResponse := cleanJSONResponse(response)
 
-	var payload ReminderPayload
-	if err := json.Unmarshal([]byte(cleanedResponse), &payload); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON: %v, raw response: %s", err, result.Text())
+	var result T
+	if err := json.Unmarshal([]byte(cleanedResponse), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %v, raw response: %s", err, response)
 	}
 
-	return &payload, nil
+	return &result, nil
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeRule scripts one FakeParser response. The first rule whose Match appears in the
+// message (case-insensitively) wins; an empty Match matches everything. A reminder rule
+// answers with either a single Response, several Tasks, or a clarification Question.
+type FakeRule struct {
+	Match    string            `json:"match"`
+	Response *ReminderPayload  `json:"response,omitempty"`
+	Tasks    []ReminderPayload `json:"tasks,omitempty"`
+	Question string            `json:"question,omitempty"`
+	Options  []string          `json:"options,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// FakeScript is the format of the FAKE_LLM_SCRIPT file
+type FakeScript struct {
+	Reminders []FakeRule `json:"reminders"`
+	Edits     []FakeRule `json:"edits"`
+}
+
+// FakeParser is a deterministic, offline ReminderParser that answers from a script.
+// A scripted "datetime" may be relative to the current time, e.g. "+30m", which is
+// resolved in the user's timezone. Every input is recorded for later inspection.
+type FakeParser struct {
+	mu     sync.Mutex
+	script FakeScript
+	clock  Clock
+	calls  []string
+}
+
+// NewFakeParser creates a FakeParser from a script, resolving relative times against clock
+func NewFakeParser(script FakeScript, clock Clock) *FakeParser {
+	return &FakeParser{script: script, clock: clock}
+}
+
+// LoadFakeParser creates a FakeParser from a JSON script file. With no path, every
+// message is answered as "not_task".
+func LoadFakeParser(path string, clock Clock) (*FakeParser, error) {
+	var script FakeScript
+	if path == "" {
+		return NewFakeParser(script, clock), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fake LLM script: %v", err)
+	}
+	if err := json.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("failed to parse fake LLM script: %v", err)
+	}
+	return NewFakeParser(script, clock), nil
+}
+
+// Calls returns every message and change the parser was asked about, in order
+func (f *FakeParser) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// ParseReminder answers with the first matching reminder rule, or "not_task"
+func (f *FakeParser) ParseReminder(ctx context.Context, message string, userTimezone string) (*ParseResult, error) {
+	rule := f.match(f.script.Reminders, message)
+	if rule == nil {
+		return &ParseResult{
+			Type:       "not_task",
+			LLMMessage: "I don't see any task or reminder in your message. If you have any task or reminder, please let me know.",
+		}, nil
+	}
+	if rule.Error != "" {
+		return nil, fmt.Errorf("%s", rule.Error)
+	}
+	if rule.Question != "" {
+		return &ParseResult{Type: "needs_clarification", Question: rule.Question, Options: rule.Options}, nil
+	}
+	if rule.Response != nil && rule.Response.Type == "not_task" {
+		return &ParseResult{Type: "not_task", LLMMessage: rule.Response.LLMMessage}, nil
+	}
+
+	scripted := rule.Tasks
+	if rule.Response != nil {
+		scripted = append([]ReminderPayload{*rule.Response}, scripted...)
+	}
+	if len(scripted) == 0 {
+		return nil, fmt.Errorf("fake rule %q has no response", rule.Match)
+	}
+
+	result := &ParseResult{Type: "task"}
+	var messages []string
+	for i := range scripted {
+		payload, err := f.respond(&FakeRule{Match: rule.Match, Response: &scripted[i]}, message, userTimezone)
+		if err != nil {
+			return nil, err
+		}
+		result.Tasks = append(result.Tasks, *payload)
+		if payload.LLMMessage != "" {
+			messages = append(messages, payload.LLMMessage)
+		}
+	}
+	result.LLMMessage = strings.Join(messages, "\n")
+	return result, nil
+}
+
+// ParseTaskEdit answers with the first matching edit rule
+func (f *FakeParser) ParseTaskEdit(ctx context.Context, task *Task, change string, userTimezone string) (*ReminderPayload, error) {
+	rule := f.match(f.script.Edits, change)
+	if rule == nil {
+		return nil, fmt.Errorf("no scripted edit matches %q", change)
+	}
+	return f.respond(rule, task.SourceText, userTimezone)
+}
+
+func (f *FakeParser) match(rules []FakeRule, text string) *FakeRule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, text)
+
+	for i := range rules {
+		if strings.Contains(strings.ToLower(text), strings.ToLower(rules[i].Match)) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// respond returns a copy of the scripted payload with defaults and relative times filled in
+func (f *FakeParser) respond(rule *FakeRule, sourceText, userTimezone string) (*ReminderPayload, error) {
+	if rule.Error != "" {
+		return nil, fmt.Errorf("%s", rule.Error)
+	}
+	if rule.Response == nil {
+		return nil, fmt.Errorf("fake rule %q has no response", rule.Match)
+	}
+
+	payload := *rule.Response
+	if payload.SourceText == "" {
+		payload.SourceText = sourceText
+	}
+	if payload.Timezone == "" {
+		payload.Timezone = userTimezone
+	}
+	if offset, ok := strings.CutPrefix(payload.Datetime, "+"); ok {
+		d, err := time.ParseDuration(offset)
+		if err != nil {
+			return nil, fmt.Errorf("invalid relative datetime %q in fake script: %v", payload.Datetime, err)
+		}
+		due := f.clock.Now().Add(d).In(LoadTimezone(payload.Timezone))
+		payload.Datetime = due.Format("2006-01-02T15:04:05")
+	}
+	return &payload, nil
+}
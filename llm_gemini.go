@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/genai"
+)
+
+// geminiGenerator generates text with the Google Gemini API
+type geminiGenerator struct {
+	client *genai.Client
+	model  string
+}
+
+// newGeminiGenerator creates a Gemini client for the given API key and model
+func newGeminiGenerator(ctx context.Context, apiKey, model string) (*geminiGenerator, error) {
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey: apiKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Google AI client: %v", err)
+	}
+	return &geminiGenerator{client: client, model: model}, nil
+}
+
+// Generate sends the prompt to Gemini and returns the response text, using Gemini's
+// JSON response mode when a schema is given
+func (g *geminiGenerator) Generate(ctx context.Context, prompt string, schema *JSONSchema) (string, error) {
+	var config *genai.GenerateContentConfig
+	if schema != nil {
+		config = &genai.GenerateContentConfig{
+			ResponseMIMEType: "application/json",
+			ResponseSchema:   schema.genaiSchema(),
+		}
+	}
+
+	result, err := g.client.Models.GenerateContent(
+		ctx,
+		g.model,
+		genai.Text(prompt),
+		config,
+	)
+	if err != nil {
+		return "", err
+	}
+	return result.Text(), nil
+}
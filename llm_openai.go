@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// openAIGenerator generates text with an OpenAI-compatible chat completions API.
+// This covers OpenAI itself as well as local servers such as Ollama (http://localhost:11434/v1).
+type openAIGenerator struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+type openAIChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChatRequest struct {
+	Model          string              `json:"model"`
+	Messages       []openAIChatMessage `json:"messages"`
+	ResponseFormat *openAIFormat       `json:"response_format,omitempty"`
+}
+
+type openAIFormat struct {
+	Type       string                `json:"type"`
+	JSONSchema *openAIJSONSchemaSpec `json:"json_schema,omitempty"`
+}
+
+type openAIJSONSchemaSpec struct {
+	Name   string         `json:"name"`
+	Schema map[string]any `json:"schema"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message openAIChatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// newOpenAIGenerator creates a client for the chat completions API at baseURL
+func newOpenAIGenerator(baseURL, apiKey, model string) *openAIGenerator {
+	return &openAIGenerator{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Generate sends the prompt as a single user message and returns the first choice.
+// A schema is passed as a json_schema response format.
+func (g *openAIGenerator) Generate(ctx context.Context, prompt string, schema *JSONSchema) (string, error) {
+	request := openAIChatRequest{
+		Model:    g.model,
+		Messages: []openAIChatMessage{{Role: "user", Content: prompt}},
+	}
+	if schema != nil {
+		request.ResponseFormat = &openAIFormat{
+			Type:       "json_schema",
+			JSONSchema: &openAIJSONSchemaSpec{Name: "reminder", Schema: schema.openAIMap()},
+		}
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode chat request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create chat request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.apiKey)
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("chat request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read chat response: %v", err)
+	}
+
+	var chat openAIChatResponse
+	if err := json.Unmarshal(data, &chat); err != nil {
+		return "", fmt.Errorf("failed to decode chat response (status %d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if chat.Error != nil {
+			return "", fmt.Errorf("chat request failed with status %d: %s", resp.StatusCode, chat.Error.Message)
+		}
+		return "", fmt.Errorf("chat request failed with status %d", resp.StatusCode)
+	}
+	if len(chat.Choices) == 0 {
+		return "", fmt.Errorf("chat response has no choices")
+	}
+
+	return chat.Choices[0].Message.Content, nil
+}
@@ -2,48 +2,162 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"google.golang.org/genai"
 )
 
-// processUserReminder handles LLM parsing and task creation in a goroutine
-func processUserReminder(ctx context.Context, bot *tgbotapi.BotAPI, aiClient *genai.Client, user *User, messageText string, chatID int64) {
-	// Add a small delay to ensure the immediate response is sent first, if needed, though 'go' keyword handles this
-	time.Sleep(50 * time.Millisecond)
-
-	payload, err := ParseReminder(ctx, aiClient, messageText, user.Timezone)
+// processUserReminder handles LLM parsing and task creation in a goroutine.
+// placeholderMessageID is the bot's "working on it" reply, which is edited in place with the
+// outcome and linked to the created tasks so replies to it can edit them. An ambiguous message
+// turns the placeholder into a follow-up question, see Dispatcher.askClarification.
+func (d *Dispatcher) processUserReminder(ctx context.Context, user *User, draft *reminderDraft, chatID int64, placeholderMessageID int) {
+	result, err := d.parser.ParseReminder(ctx, draft.Message(), user.Timezone)
 	if err != nil {
 		log.Printf("Error parsing reminder for user %d: %v", user.TelegramID, err)
-		// Optionally, send a follow-up error message if LLM completely failed
-		// sendErrorMessage(bot, chatID, "Sorry, I had trouble understanding your message. Please try again.", nil)
+		editOrSendMessage(d.bot, chatID, placeholderMessageID,
+			"❌ Sorry, I couldn't understand that. Please try rephrasing it, e.g. \"Remind me to call mom tomorrow at 6 PM\".", nil)
 		return
 	}
 
-	log.Printf("Parsed reminder payload for user %d: %+v", user.TelegramID, payload)
+	log.Printf("Parsed reminder result for user %d: %+v", user.TelegramID, result)
+
+	if result.Type == "needs_clarification" {
+		log.Printf("Asking user %d to clarify: %s", user.TelegramID, result.Question)
+		d.askClarification(chatID, placeholderMessageID, draft, result)
+		return
+	}
 
-	if payload.Type == "task" {
-		task, err := CreateTask(user.ID, payload)
-		if err != nil {
-			log.Printf("Error creating task for user %d: %v", user.TelegramID, err)
-			// Optionally, send a follow-up error message if DB saving failed
-			// sendErrorMessage(bot, chatID, "I understood your reminder, but had trouble saving it. Please try again.", nil)
-			return
+	if result.Type != "task" || len(result.Tasks) == 0 {
+		log.Printf("LLM determined message for user %d was not a task: %s", user.TelegramID, result.LLMMessage)
+		response := result.LLMMessage
+		if response == "" {
+			response = "I don't see any task or reminder in your message. If you have any task or reminder, please let me know."
 		}
+		editOrSendMessage(d.bot, chatID, placeholderMessageID, "🤷 "+response, nil)
+		return
+	}
 
-		// At this point, the task is scheduled. The immediate response already told the user.
-		// We could send a more detailed confirmation, or rely on the /mytasks command.
-		// For now, we'll just log and not send an additional message to avoid spamming the user
-		// after the immediate confirmation.
+	// Keep the user's own words as the source, not the follow-up questions and answers
+	for i := range result.Tasks {
+		result.Tasks[i].SourceText = draft.Original
+	}
+	applyDefaultAlerts(result.Tasks, user)
+	applyDefaultNag(result.Tasks, user)
+
+	tasks, err := d.store.CreateTasks(user.ID, result.Tasks)
+	if err != nil {
+		log.Printf("Error creating tasks for user %d: %v", user.TelegramID, err)
+		editOrSendMessage(d.bot, chatID, placeholderMessageID,
+			"❌ I understood your reminder, but had trouble saving it. Please try again.", nil)
+		return
+	}
+
+	for _, task := range tasks {
 		log.Printf("Task '%s' created for user %d. Due: %s", task.Title, user.TelegramID, task.DueDateTime.Format(time.RFC3339))
+	}
+
+	// Show what was actually scheduled, in the user's timezone
+	response, keyboard := reminderConfirmation(result.LLMMessage, tasks, user.Timezone)
+	messageID := editOrSendMessage(d.bot, chatID, placeholderMessageID, response, keyboard)
+
+	// Link the confirmation to the tasks so replies to it can edit them
+	if messageID != 0 {
+		for _, task := range tasks {
+			if err := d.store.RecordTaskMessage(task.ID, chatID, messageID, "confirmation"); err != nil {
+				log.Printf("Error recording confirmation for task %d: %v", task.ID, err)
+			}
+		}
+	}
+}
+
+// reminderConfirmation renders the confirmation for newly created tasks, with an undo button per task
+func reminderConfirmation(llmMessage string, tasks []Task, timezone string) (string, *tgbotapi.InlineKeyboardMarkup) {
+	if len(tasks) == 0 {
+		return "↩️ Undone, nothing is scheduled from this message.", nil
+	}
+
+	response := "✅ " + llmMessage
+	if llmMessage == "" {
+		response = fmt.Sprintf("✅ Scheduled %d %s", len(tasks), pluralize(len(tasks), "reminder", "reminders"))
+	}
 
-	} else {
-		// If it's not a task, the LLM usually provides a conversational response.
-		// Since we sent an immediate generic message, this LLM conversational response
-		// will currently be lost. If you want to send it, you'd need to edit the previous message
-		// or send a follow-up. For a simple "Task Scheduled" response, we ignore it.
-		log.Printf("LLM determined message for user %d was not a task: %s", user.TelegramID, payload.LLMMessage)
+	if len(tasks) == 1 {
+		task := &tasks[0]
+		response += fmt.Sprintf("\n\n📅 Scheduled for: %s (%s)", FormatTaskDateTime(task.DueDateTime, timezone), timezone)
+		if rule, err := TaskRecurrence(task); err == nil && rule != nil {
+			response += fmt.Sprintf("\n🔁 Repeats %s", rule.Describe())
+		}
+		if alerts := describeAlerts(task.AlertOffsets); alerts != "" {
+			response += fmt.Sprintf("\n🔔 Alerts: %s", alerts)
+		}
+		if nag := describeNag(task.NagEveryMinutes, task.NagRepeats); nag != "" {
+			response += fmt.Sprintf("\n📣 Nagging %s until it's done", nag)
+		}
+		if task.Urgent {
+			response += "\n🚨 Urgent: comes through even during quiet hours"
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("↩️ Undo", NewCallbackData("task", task.ID, "undo"))))
+		return response, &keyboard
+	}
+
+	response += fmt.Sprintf("\n\n📅 Scheduled (%s):\n", timezone)
+	var buttons []tgbotapi.InlineKeyboardButton
+	for i := range tasks {
+		task := &tasks[i]
+		response += fmt.Sprintf("%d. %s - %s\n", i+1, task.Title, FormatTaskDateTime(task.DueDateTime, timezone))
+		if rule, err := TaskRecurrence(task); err == nil && rule != nil {
+			response += fmt.Sprintf("   🔁 Repeats %s\n", rule.Describe())
+		}
+		if alerts := describeAlerts(task.AlertOffsets); alerts != "" {
+			response += fmt.Sprintf("   🔔 Alerts: %s\n", alerts)
+		}
+		if nag := describeNag(task.NagEveryMinutes, task.NagRepeats); nag != "" {
+			response += fmt.Sprintf("   📣 Nagging %s\n", nag)
+		}
+		if task.Urgent {
+			response += "   🚨 Urgent\n"
+		}
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("↩️ Undo %d", i+1), NewCallbackData("task", task.ID, "undo")))
+	}
+
+	// Five undo buttons per row
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for len(buttons) > 0 {
+		n := min(5, len(buttons))
+		rows = append(rows, buttons[:n])
+		buttons = buttons[n:]
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return response, &keyboard
+}
+
+// editOrSendMessage replaces the text of a message the bot sent earlier, or sends a new
+// message if there is none (messageID is 0) or editing fails. keyboard may be nil. It returns
+// the ID of the message that now shows the text, or 0 if nothing could be sent.
+func editOrSendMessage(bot Messenger, chatID int64, messageID int, text string, keyboard *tgbotapi.InlineKeyboardMarkup) int {
+	if messageID != 0 {
+		edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+		edit.ReplyMarkup = keyboard
+		_, err := bot.Send(edit)
+		if err == nil {
+			return messageID
+		}
+		log.Printf("Error editing message %d, sending a new one: %v", messageID, err)
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+	sent, err := bot.Send(msg)
+	if err != nil {
+		log.Printf("Error sending message: %v", err)
+		return 0
 	}
+	return sent.MessageID
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestProcessUserReminder(t *testing.T) {
+	script := FakeScript{Reminders: []FakeRule{
+		{Match: "call mom", Response: &ReminderPayload{Type: "task", Title: "Call mom", Datetime: "+30m", LLMMessage: "I'll remind you to call mom"}},
+		{Match: "sometime", Question: "When should I remind you?", Options: []string{"Today", "Tomorrow"}},
+		{Match: "broken", Error: "model unavailable"},
+	}}
+	due := time.Date(2026, 10, 17, 8, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		text  string
+		reply string
+		tasks int
+	}{
+		{
+			name:  "reminder",
+			text:  "remind me to call mom in 30 minutes",
+			reply: "✅ I'll remind you to call mom\n\n📅 Scheduled for: " + FormatTaskDateTime(due, "Asia/Kolkata") + " (Asia/Kolkata)",
+			tasks: 1,
+		},
+		{
+			name:  "not a task",
+			text:  "hello there",
+			reply: "🤷 I don't see any task or reminder in your message. If you have any task or reminder, please let me know.",
+		},
+		{
+			name:  "needs clarification",
+			text:  "water the plants sometime",
+			reply: "❓ When should I remind you?\n\nTap an answer or reply with your own.",
+		},
+		{
+			name:  "parser error",
+			text:  "this is broken",
+			reply: "❌ Sorry, I couldn't understand that. Please try rephrasing it, e.g. \"Remind me to call mom tomorrow at 6 PM\".",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parser *FakeParser
+			d, fake, store, _ := newTestDispatcherWith(t, func(clock Clock) ReminderParser {
+				parser = NewFakeParser(script, clock)
+				return parser
+			})
+
+			message := fake.SendText(testUserID, tt.text)
+			d.Dispatch(tgbotapi.Update{Message: &message})
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := d.Shutdown(ctx); err != nil {
+				t.Fatalf("reminder was not processed: %v", err)
+			}
+
+			if calls := parser.Calls(); len(calls) != 1 || calls[0] != tt.text {
+				t.Errorf("parser calls = %q, want [%q]", calls, tt.text)
+			}
+			messages := fake.Messages(testUserID)
+			if len(messages) != 1 {
+				t.Fatalf("bot sent %d messages, want the placeholder edited into the reply", len(messages))
+			}
+			if messages[0].Text != tt.reply {
+				t.Errorf("reply = %q, want %q", messages[0].Text, tt.reply)
+			}
+
+			user, err := store.GetUserByTelegramID(testUserID)
+			if err != nil {
+				t.Fatalf("user was not created: %v", err)
+			}
+			tasks, err := store.GetUserTasks(user.ID)
+			if err != nil {
+				t.Fatalf("failed to load tasks: %v", err)
+			}
+			if len(tasks) != tt.tasks {
+				t.Fatalf("created %d tasks, want %d", len(tasks), tt.tasks)
+			}
+			if tt.tasks == 0 {
+				return
+			}
+			task := tasks[0]
+			if task.Title != "Call mom" || !task.DueDateTime.Equal(due) || task.SourceText != tt.text || task.Status != "pending" {
+				t.Errorf("task = %q due %v from %q (%s)", task.Title, task.DueDateTime, task.SourceText, task.Status)
+			}
+		})
+	}
+}
@@ -2,169 +2,211 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"strings"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"google.golang.org/genai"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		case "deliveries":
+			os.Exit(runDeliveries(os.Args[2:]))
+		}
+	}
+	os.Exit(run())
+}
+
+// runMigrate implements the migrate subcommand:
+//
+//	goremindbot migrate status          show applied and pending migrations
+//	goremindbot migrate up [VERSION]    migrate up to VERSION, or to the latest
+//	goremindbot migrate down [VERSION]  roll back to VERSION, or by one migration
+func runMigrate(args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		log.Printf("Usage: goremindbot migrate status | up [VERSION] | down [VERSION]")
+		return 2
+	}
+
+	db, err := openDatabase(getEnv("DATABASE_URL", DefaultDatabaseURL))
+	if err != nil {
+		log.Printf("Failed to open database: %v", err)
+		return 1
+	}
+	store := NewGormStore(db, SystemClock)
+	defer store.Close()
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		log.Printf("%v", err)
+		return 1
+	}
+
+	var target int
+	switch args[0] {
+	case "status":
+		if len(args) != 1 {
+			log.Printf("Usage: goremindbot migrate status")
+			return 2
+		}
+		fmt.Printf("Schema version %d, latest known %d\n", current, LatestSchemaVersion())
+		for _, m := range migrations {
+			state := "pending"
+			if m.Version <= current {
+				state = "applied"
+			}
+			fmt.Printf("  %3d  %-8s %s\n", m.Version, state, m.Name)
+		}
+		if current > LatestSchemaVersion() {
+			fmt.Printf("The database is ahead of this binary; the bot will refuse to start\n")
+		}
+		return 0
+	case "up":
+		target = LatestSchemaVersion()
+	case "down":
+		target = max(current-1, 0)
+	default:
+		log.Printf("Unknown migrate command %q, expected status, up or down", args[0])
+		return 2
+	}
+
+	if len(args) == 2 {
+		target, err = strconv.Atoi(args[1])
+		if err != nil {
+			log.Printf("Invalid version %q: %v", args[1], err)
+			return 2
+		}
+		if args[0] == "up" && target < current || args[0] == "down" && target > current {
+			log.Printf("Version %d is not %s from the current version %d", target, args[0], current)
+			return 2
+		}
+	}
+
+	if err := MigrateTo(db, target, SystemClock); err != nil {
+		log.Printf("%v", err)
+		return 1
+	}
+	log.Printf("Schema is at version %d", target)
+	return 0
+}
+
+// run starts the bot and blocks until SIGINT/SIGTERM. It returns the process exit code: 0 after a
+// clean shutdown, 1 if startup failed or shutting down ran into errors.
+func run() (code int) {
+	config, err := LoadConfig()
+	if err != nil {
+		log.Printf("Invalid configuration: %v", err)
+		return 1
+	}
+
+	// Everything tells the time by the same clock
+	clock := SystemClock
+
 	// Initialize database
-	err := InitDatabase()
+	store, err := InitDatabase(config.DatabaseURL, clock)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to initialize database: %v", err))
+		log.Printf("Failed to initialize database: %v", err)
+		return 1
 	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			log.Printf("Error closing database: %v", err)
+			code = 1
+		}
+	}()
 
-	bot, err := tgbotapi.NewBotAPI(os.Getenv("TELEGRAM_APITOKEN"))
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(config.TelegramToken, config.TelegramAPIEndpoint)
 	if err != nil {
-		panic(err)
+		log.Printf("Failed to connect to Telegram: %v", err)
+		return 1
 	}
 
-	// Initialize Google AI client
-	aiClient, err := genai.NewClient(context.Background(), &genai.ClientConfig{
-		APIKey: os.Getenv("GEMINI_API_KEY"),
-	})
+	// Initialize the LLM provider that parses reminders
+	parser, err := NewReminderParser(context.Background(), config, clock)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to initialize Google AI client: %v", err))
+		log.Printf("Failed to initialize reminder parser: %v", err)
+		return 1
 	}
 
 	bot.Debug = true
 
-	// Create a new UpdateConfig struct with an offset of 0. Offsets are used
-	// to make sure Telegram knows we've handled previous values and we don't
-	// need them repeated.
-	updateConfig := tgbotapi.NewUpdate(0)
+	// ctx is cancelled on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Tell Telegram we should wait up to 30 seconds on each request for an
-	// update. This way we can get information just as quickly as making many
-	// frequent requests without having to send nearly as many.
-	updateConfig.Timeout = 30
+	// Start the reminder scheduler. Handlers use its store, so new, edited and snoozed tasks wake it up.
+	scheduler := NewScheduler(bot, store, clock, config)
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		scheduler.Run(ctx)
+	}()
 
-	// Start the background task checker
-	go TaskChecker(bot)
+	dispatcher := NewDispatcher(bot, bot.Self.ID, parser, scheduler.Store(), clock)
 
-	// Start polling Telegram for updates.
-	updates := bot.GetUpdatesChan(updateConfig)
+	// Receive updates with long polling or a webhook, depending on UPDATE_MODE
+	source := NewUpdateSource(bot, config)
+	updates, err := source.Start()
+	if err != nil {
+		log.Printf("Failed to start receiving updates: %v", err)
+		stop()
+		<-schedulerDone
+		return 1
+	}
+
+	// Stop accepting updates on shutdown, which deregisters the webhook and ends the loop below.
+	// All shutdown steps share one deadline, counted from the signal.
+	var shutdownDeadline time.Time
+	sourceStopped := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down, waiting up to %s for in-flight work", config.ShutdownTimeout)
+		shutdownDeadline = time.Now().Add(config.ShutdownTimeout)
+		stopCtx, cancel := context.WithDeadline(context.Background(), shutdownDeadline)
+		defer cancel()
+		sourceStopped <- source.Stop(stopCtx)
+	}()
 
 	// Let's go through each update that we're getting from Telegram.
 	for update := range updates {
-		// Telegram can send many types of updates depending on what your Bot
-		// is up to. We only want to look at messages for now, so we can
-		// discard any other updates.
-		if update.Message == nil {
-			continue
-		}
-
-		// Get or create user in database
-		var username, languageCode *string
-		if update.Message.From.UserName != "" {
-			username = &update.Message.From.UserName
-		}
-		if update.Message.From.LanguageCode != "" {
-			languageCode = &update.Message.From.LanguageCode
-		}
-
-		user, err := GetOrCreateUser(
-			int64(update.Message.From.ID),
-			username,
-			&update.Message.From.FirstName,
-			&update.Message.From.LastName,
-			languageCode,
-		)
-		if err != nil {
-			log.Printf("Error handling user: %v", err)
-			continue
-		}
+		dispatcher.Dispatch(update)
+	}
 
-		// Handle different types of messages
-		var responseText string
-
-		if update.Message.Text != "" {
-			// Check for special commands
-			text := strings.TrimSpace(update.Message.Text)
-
-			if strings.HasPrefix(text, "/settimezone") {
-				responseText = handleSetTimezoneCommand(text, user)
-			} else if strings.HasPrefix(text, "/mytasks") {
-				responseText = handleMyTasksCommand(user)
-			} else if strings.HasPrefix(text, "/start") {
-				responseText = "Welcome to GoRemindBot! I'm here to help you create and manage reminders. Use /help to get started or /mytasks to view your tasks."
-			} else if strings.HasPrefix(text, "/help") {
-				responseText = handleHelpCommand()
-			} else if strings.ToLower(strings.TrimSpace(text)) == "done" {
-				responseText = handleDoneCommand(user)
-			} else {
-				// // Regular text message - parse with LLM
-				// ctx := context.Background()
-				// payload, err := ParseReminder(ctx, aiClient, update.Message.Text, user.Timezone)
-				// if err != nil {
-				// 	log.Printf("Error parsing reminder: %v", err)
-				// 	responseText = "Sorry, I had trouble understanding your message. Please try again."
-				// } else {
-				// 	// Log the parsed payload
-				// 	log.Printf("Parsed reminder payload: %+v", payload)
-
-				// 	if payload.Type == "task" {
-				// 		// Create task in database
-				// 		task, err := CreateTask(user.ID, payload)
-				// 		if err != nil {
-				// 			log.Printf("Error creating task: %v", err)
-				// 			responseText = "I understood your reminder, but had trouble saving it. Please try again."
-				// 		} else {
-				// 			// Format the response with timezone information
-				// 			formattedTime := FormatTaskDateTime(task.DueDateTime, user.Timezone)
-				// 			responseText = fmt.Sprintf("%s\n\n📅 Scheduled for: %s (%s)",
-				// 				payload.LLMMessage, formattedTime, user.Timezone)
-				// 		}
-				// 	} else {
-				// 		responseText = payload.LLMMessage
-				// 	}
-				// }
-				// Immediate generic response for tasks
-				initialResponse := fmt.Sprintf("Task Scheduled: \"%s\" (processing in background...)", update.Message.Text)
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, initialResponse)
-				msg.ReplyToMessageID = update.Message.MessageID
-				if _, err := bot.Send(msg); err != nil {
-					log.Printf("Error sending immediate response: %v", err)
-				}
-
-				// Process the reminder in a separate goroutine
-				go processUserReminder(context.Background(), bot, aiClient, user, update.Message.Text, update.Message.Chat.ID)
-				continue // Skip the rest of the loop for this message
-			}
-		} else if update.Message.Voice != nil {
-			// Audio/voice message
-			responseText = "🎵 I received your audio message! I can only process text messages for now."
-		} else if update.Message.Audio != nil {
-			// Audio file
-			responseText = "🎶 I received your audio file! I can only process text messages for now."
-		} else if update.Message.Photo != nil {
-			// Photo message
-			responseText = "📸 I received your photo! I can only process text messages for now."
-		} else if update.Message.Video != nil {
-			// Video message
-			responseText = "🎥 I received your video! I can only process text messages for now."
-		} else if update.Message.Document != nil {
-			// Document message
-			responseText = "📄 I received your document! I can only process text messages for now."
-		} else {
-			// Other message types
-			responseText = "I received your message, but I can only process text messages for now."
-		}
+	var errs []error
+	if ctx.Err() == nil {
+		// The update source gave up on its own
+		errs = append(errs, errors.New("update source closed unexpectedly"))
+		stop()
+	}
+	if err := <-sourceStopped; err != nil {
+		errs = append(errs, err)
+	}
 
-		// Create a reply message
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, responseText)
-		msg.ReplyToMessageID = update.Message.MessageID
+	// Drain in-flight LLM jobs and let the scheduler finish the reminders it is sending, both within the deadline
+	shutdownCtx, cancel := context.WithDeadline(context.Background(), shutdownDeadline)
+	defer cancel()
+	if err := dispatcher.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, err)
+	}
+	select {
+	case <-schedulerDone:
+	case <-shutdownCtx.Done():
+		errs = append(errs, errors.New("scheduler did not stop before the shutdown deadline"))
+	}
 
-		// Send the message
-		if _, err := bot.Send(msg); err != nil {
-			// Note that panics are a bad way to handle errors. Telegram can
-			// have service outages or network errors, you should retry sending
-			// messages or more gracefully handle failures.
-			log.Printf("Error sending message: %v", err)
-		}
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("Shutdown finished with errors: %v", err)
+		return 1
 	}
+	log.Printf("Shutdown complete")
+	return 0
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// waitForMessage waits until the bot's messages to the test user include one containing text,
+// as last edited, and returns it
+func waitForMessage(t *testing.T, fake *FakeTelegram, text string) tgbotapi.Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		calls := len(fake.Calls(""))
+		for _, message := range fake.Messages(testUserID) {
+			if strings.Contains(message.Text, text) {
+				return message
+			}
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			t.Fatalf("the bot never sent %q", text)
+		}
+		fake.WaitForCalls("", calls+1, remaining)
+	}
+}
+
+// TestEndToEnd runs the bot the way run does, against a fake Telegram server and a fake clock
+func TestEndToEnd(t *testing.T) {
+	scheduler, fake, store, clock := newTestScheduler(t)
+	bot := scheduler.bot.(*tgbotapi.BotAPI)
+	dispatcher := NewDispatcher(bot, fake.Bot.ID, NewRuleParser(clock), store, clock)
+	runScheduler(t, scheduler)
+
+	source := NewUpdateSource(bot, scheduler.config)
+	updates, err := source.Start()
+	if err != nil {
+		t.Fatalf("failed to start receiving updates: %v", err)
+	}
+	loopDone := make(chan struct{})
+	go func() {
+		defer close(loopDone)
+		for update := range updates {
+			dispatcher.Dispatch(update)
+		}
+	}()
+	t.Cleanup(func() {
+		source.Stop(t.Context())
+		<-loopDone
+		dispatcher.Shutdown(t.Context())
+	})
+
+	// The user asks for a reminder and the bot confirms it
+	fake.SendText(testUserID, "remind me to call mom in 30 minutes")
+	waitForMessage(t, fake, "Call mom")
+	if reminders := fake.Messages(testUserID); strings.Contains(reminders[len(reminders)-1].Text, "Reminder:") {
+		t.Fatalf("the reminder went out before it was due")
+	}
+
+	// It goes out once the clock reaches the due time
+	clock.Advance(30 * time.Minute)
+	reminder := waitForMessage(t, fake, "Reminder: Call mom")
+
+	// Pressing Done completes the task
+	user, err := store.GetUserByTelegramID(testUserID)
+	if err != nil {
+		t.Fatalf("GetUserByTelegramID() error = %v", err)
+	}
+	tasks, err := store.GetUserTasks(user.ID)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("GetUserTasks() = %v, %v, want the reminder's task", taskIDs(tasks), err)
+	}
+	if want := testStart.Add(30 * time.Minute); !tasks[0].DueDateTime.Equal(want) {
+		t.Errorf("task is due %v, want %v", tasks[0].DueDateTime, want)
+	}
+	fake.Press(testUserID, reminder.MessageID, NewCallbackData("task", tasks[0].ID, "done"))
+	if _, err := fake.WaitForCalls("answerCallbackQuery", 1, 5*time.Second); err != nil {
+		t.Fatalf("the press wasn't answered: %v", err)
+	}
+	task, err := store.GetUserTask(user.ID, tasks[0].ID)
+	if err != nil || task.Status != "completed" {
+		t.Errorf("GetUserTask() = %+v, %v, want the task completed", task, err)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Messenger is the part of the Telegram Bot API the bot talks through: sending and editing
+// messages, answering callback queries and long polling for updates. *tgbotapi.BotAPI implements
+// it; pointed at a FakeTelegram server, so does a bot that never reaches Telegram.
+type Messenger interface {
+	// Send sends or edits a message and returns the message as Telegram stored it
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	// Request makes a call that doesn't return a message, such as answering a callback query
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	// GetUpdatesChan starts long polling and delivers the updates on the returned channel
+	GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel
+	// StopReceivingUpdates stops the polling started by GetUpdatesChan
+	StopReceivingUpdates()
+}
+
+// Messenger is satisfied by the real client
+var _ Messenger = (*tgbotapi.BotAPI)(nil)
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Migration is one versioned change to the database schema or data. Up applies it and Down
+// reverts it; both run inside a transaction together with the schema_migrations bookkeeping.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration in the schema_migrations table
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// migrations is the ordered list of every migration this binary knows about.
+// Append new migrations at the end with the next version number; never edit released ones.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create users, tasks, task_snoozes and task_messages",
+		Up: func(tx *gorm.DB) error {
+			// Databases created before versioned migrations already have these tables;
+			// AutoMigrate leaves them as they are
+			return tx.AutoMigrate(&v1User{}, &v1Task{}, &v1TaskSnooze{}, &v1TaskMessage{})
+		},
+		Down: sqlStep(
+			"DROP TABLE IF EXISTS task_messages",
+			"DROP TABLE IF EXISTS task_snoozes",
+			"DROP TABLE IF EXISTS tasks",
+			"DROP TABLE IF EXISTS users",
+		),
+	},
+	{
+		Version: 2,
+		Name:    "convert free-text recurrence to DTSTART/RRULE",
+		Up:      migrateRecurrenceToRRule,
+		// The canonical form is valid input for every version, so there is nothing to undo
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+	{
+		Version: 3,
+		Name:    "add reminder delivery claims to tasks",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range []string{"ClaimedBy", "ClaimExpiresAt"} {
+				if !tx.Migrator().HasColumn(&v3Task{}, column) {
+					if err := tx.Migrator().AddColumn(&v3Task{}, column); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range []string{"ClaimedBy", "ClaimExpiresAt"} {
+				if err := dropColumn(tx, &v3Task{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add delivery attempts and retry state",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range []string{"DeliveryAttempts", "NextRetryAt"} {
+				if !tx.Migrator().HasColumn(&v4Task{}, column) {
+					if err := tx.Migrator().AddColumn(&v4Task{}, column); err != nil {
+						return err
+					}
+				}
+			}
+			return tx.AutoMigrate(&v4DeliveryAttempt{})
+		},
+		Down: func(tx *gorm.DB) error {
+			// Older versions don't know the failed status; treat those reminders as missed
+			if err := sqlStep(
+				"UPDATE tasks SET status = 'missed' WHERE status = 'failed'",
+				"DROP TABLE IF EXISTS delivery_attempts",
+			)(tx); err != nil {
+				return err
+			}
+			for _, column := range []string{"DeliveryAttempts", "NextRetryAt"} {
+				if err := dropColumn(tx, &v4Task{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add task alerts and default alerts",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn(&v5Task{}, "AlertOffsets") {
+				if err := tx.Migrator().AddColumn(&v5Task{}, "AlertOffsets"); err != nil {
+					return err
+				}
+			}
+			if !tx.Migrator().HasColumn(&v5User{}, "DefaultAlerts") {
+				if err := tx.Migrator().AddColumn(&v5User{}, "DefaultAlerts"); err != nil {
+					return err
+				}
+			}
+			return tx.AutoMigrate(&v5TaskAlert{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := sqlStep("DROP TABLE IF EXISTS task_alerts")(tx); err != nil {
+				return err
+			}
+			if err := dropColumn(tx, &v5User{}, "DefaultAlerts"); err != nil {
+				return err
+			}
+			return dropColumn(tx, &v5Task{}, "AlertOffsets")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add nag policies to tasks and users",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range []string{"NagEveryMinutes", "NagRepeats", "NagCount", "NextNagAt"} {
+				if !tx.Migrator().HasColumn(&v6Task{}, column) {
+					if err := tx.Migrator().AddColumn(&v6Task{}, column); err != nil {
+						return err
+					}
+				}
+			}
+			if !tx.Migrator().HasIndex(&v6Task{}, "NextNagAt") {
+				if err := tx.Migrator().CreateIndex(&v6Task{}, "NextNagAt"); err != nil {
+					return err
+				}
+			}
+			for _, column := range []string{"NagEveryMinutes", "NagRepeats"} {
+				if !tx.Migrator().HasColumn(&v6User{}, column) {
+					if err := tx.Migrator().AddColumn(&v6User{}, column); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&v6Task{}, "NextNagAt"); err != nil {
+				return err
+			}
+			for _, column := range []string{"NagEveryMinutes", "NagRepeats", "NagCount", "NextNagAt"} {
+				if err := dropColumn(tx, &v6Task{}, column); err != nil {
+					return err
+				}
+			}
+			for _, column := range []string{"NagEveryMinutes", "NagRepeats"} {
+				if err := dropColumn(tx, &v6User{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add quiet hours, do not disturb and urgent tasks",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range []string{"QuietHoursStart", "QuietHoursEnd", "QuietMode", "DNDUntil"} {
+				if !tx.Migrator().HasColumn(&v7User{}, column) {
+					if err := tx.Migrator().AddColumn(&v7User{}, column); err != nil {
+						return err
+					}
+				}
+			}
+			if !tx.Migrator().HasColumn(&v7Task{}, "Urgent") {
+				return tx.Migrator().AddColumn(&v7Task{}, "Urgent")
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range []string{"QuietHoursStart", "QuietHoursEnd", "QuietMode", "DNDUntil"} {
+				if err := dropColumn(tx, &v7User{}, column); err != nil {
+					return err
+				}
+			}
+			return dropColumn(tx, &v7Task{}, "Urgent")
+		},
+	},
+}
+
+// dropColumn drops the column of a model field. GORM's SQLite migrator drops a column by rebuilding
+// the table, which loses its indexes, so SQLite gets a plain ALTER TABLE (SQLite 3.35 and later).
+func dropColumn(tx *gorm.DB, model interface{}, field string) error {
+	if tx.Dialector.Name() != DatabaseSQLite {
+		return tx.Migrator().DropColumn(model, field)
+	}
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	column := field
+	if f := stmt.Schema.LookUpField(field); f != nil {
+		column = f.DBName
+	}
+	return tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: stmt.Schema.Table}, clause.Column{Name: column}).Error
+}
+
+// sqlStep returns a migration step that executes plain SQL statements in order
+func sqlStep(statements ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf("%s: %v", statement, err)
+			}
+		}
+		return nil
+	}
+}
+
+// LatestSchemaVersion is the schema version this binary expects
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the highest migration version applied to the database, or 0 for an empty one
+func SchemaVersion(db *gorm.DB) (int, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return 0, fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	var version int
+	if err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %v", err)
+	}
+	return version, nil
+}
+
+// CheckSchemaVersion refuses to run against a database that was migrated by a newer binary
+func CheckSchemaVersion(db *gorm.DB) error {
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if latest := LatestSchemaVersion(); version > latest {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d); run a newer build, or roll back with its `migrate down` command", version, latest)
+	}
+	return nil
+}
+
+// MigrateTo applies or reverts migrations until the database is at the target version, recording
+// when each one was applied by clock
+func MigrateTo(db *gorm.DB, target int, clock Clock) error {
+	if target < 0 || target > LatestSchemaVersion() {
+		return fmt.Errorf("unknown schema version %d, expected 0 to %d", target, LatestSchemaVersion())
+	}
+	if err := CheckSchemaVersion(db); err != nil {
+		return err
+	}
+
+	var applied []SchemaMigration
+	if err := db.Order("version").Find(&applied).Error; err != nil {
+		return fmt.Errorf("failed to read applied migrations: %v", err)
+	}
+	isApplied := func(version int) bool {
+		return slices.ContainsFunc(applied, func(m SchemaMigration) bool { return m.Version == version })
+	}
+
+	// Apply missing migrations up to the target, oldest first
+	for _, m := range migrations {
+		if m.Version > target || isApplied(m.Version) {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: clock.Now().UTC()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		log.Printf("Applied migration %d: %s", m.Version, m.Name)
+	}
+
+	// Revert migrations above the target, newest first
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= target || !isApplied(m.Version) {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		log.Printf("Reverted migration %d: %s", m.Version, m.Name)
+	}
+	return nil
+}
+
+// migrateRecurrenceToRRule rewrites recurrences stored as free text (e.g. "daily" or a bare RRULE)
+// into the canonical DTSTART/RRULE form anchored at the task's due time. Values that can't be
+// parsed are cleared so the task fires once instead of failing on every reminder.
+func migrateRecurrenceToRRule(tx *gorm.DB) error {
+	type row struct {
+		ID          uint
+		DueDateTime time.Time
+		Timezone    string
+		Recurrence  *string
+	}
+	var rows []row
+	if err := tx.Table("tasks").Where("recurrence IS NOT NULL").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		canonical, err := canonicalRecurrence(r.Recurrence, r.DueDateTime, r.Timezone)
+		if err != nil {
+			log.Printf("Clearing unparseable recurrence %q of task %d: %v", *r.Recurrence, r.ID, err)
+			canonical = nil
+		}
+		if canonical != nil && *canonical == *r.Recurrence {
+			continue
+		}
+		if err := tx.Table("tasks").Where("id = ?", r.ID).Update("recurrence", canonical).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Schema of version 1, frozen here so later changes to the models don't change what
+// migration 1 creates
+
+type v1User struct {
+	ID           uint    `gorm:"primaryKey"`
+	TelegramID   int64   `gorm:"uniqueIndex;not null"`
+	Username     *string `gorm:"index"`
+	FirstName    *string
+	LastName     *string
+	LanguageCode *string
+	Timezone     string `gorm:"default:'Asia/Kolkata'"`
+	IsActive     bool   `gorm:"default:true"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	Tasks        []v1Task       `gorm:"foreignKey:UserID"`
+}
+
+func (v1User) TableName() string { return "users" }
+
+type v1Task struct {
+	ID             uint   `gorm:"primaryKey"`
+	UserID         uint   `gorm:"not null;index"`
+	Title          string `gorm:"not null"`
+	Description    string
+	DueDateTime    time.Time `gorm:"not null;index"`
+	Timezone       string    `gorm:"not null"`
+	Recurrence     *string
+	SeriesID       *uint `gorm:"index"`
+	SourceText     string
+	Status         string `gorm:"default:'pending'"`
+	IsActive       bool   `gorm:"default:true"`
+	ReminderSentAt *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+	User           v1User         `gorm:"foreignKey:UserID"`
+	Snoozes        []v1TaskSnooze `gorm:"foreignKey:TaskID"`
+}
+
+func (v1Task) TableName() string { return "tasks" }
+
+type v1TaskSnooze struct {
+	ID              uint      `gorm:"primaryKey"`
+	TaskID          uint      `gorm:"not null;index"`
+	FromDueDateTime time.Time `gorm:"not null"`
+	ToDueDateTime   time.Time `gorm:"not null"`
+	CreatedAt       time.Time
+}
+
+func (v1TaskSnooze) TableName() string { return "task_snoozes" }
+
+type v1TaskMessage struct {
+	ID        uint   `gorm:"primaryKey"`
+	TaskID    uint   `gorm:"not null;index"`
+	ChatID    int64  `gorm:"not null;index:idx_task_messages_chat_message"`
+	MessageID int    `gorm:"not null;index:idx_task_messages_chat_message"`
+	Kind      string `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+func (v1TaskMessage) TableName() string { return "task_messages" }
+
+// Columns added to tasks by version 3
+
+type v3Task struct {
+	ClaimedBy      *string
+	ClaimExpiresAt *time.Time
+}
+
+func (v3Task) TableName() string { return "tasks" }
+
+// Columns and table added by version 4
+
+type v4Task struct {
+	DeliveryAttempts int `gorm:"not null;default:0"`
+	NextRetryAt      *time.Time
+}
+
+func (v4Task) TableName() string { return "tasks" }
+
+type v4DeliveryAttempt struct {
+	ID          uint `gorm:"primaryKey"`
+	TaskID      uint `gorm:"not null;index"`
+	Attempt     int  `gorm:"not null"`
+	WorkerID    string
+	ErrorClass  string
+	Error       string
+	NextRetryAt *time.Time
+	CreatedAt   time.Time
+}
+
+func (v4DeliveryAttempt) TableName() string { return "delivery_attempts" }
+
+// Columns and table added by version 5
+
+type v5Task struct {
+	AlertOffsets string `gorm:"not null;default:''"`
+}
+
+func (v5Task) TableName() string { return "tasks" }
+
+type v5User struct {
+	DefaultAlerts string `gorm:"not null;default:''"`
+}
+
+func (v5User) TableName() string { return "users" }
+
+type v5TaskAlert struct {
+	ID             uint      `gorm:"primaryKey"`
+	TaskID         uint      `gorm:"not null;index"`
+	OffsetMinutes  int       `gorm:"not null"`
+	AlertAt        time.Time `gorm:"not null;index"`
+	SentAt         *time.Time
+	ClaimedBy      *string
+	ClaimExpiresAt *time.Time
+	Attempts       int `gorm:"not null;default:0"`
+	NextRetryAt    *time.Time
+	FailedAt       *time.Time
+	CreatedAt      time.Time
+}
+
+func (v5TaskAlert) TableName() string { return "task_alerts" }
+
+// Columns added by version 6
+
+type v6Task struct {
+	NagEveryMinutes int        `gorm:"not null;default:0"`
+	NagRepeats      int        `gorm:"not null;default:0"`
+	NagCount        int        `gorm:"not null;default:0"`
+	NextNagAt       *time.Time `gorm:"index"`
+}
+
+func (v6Task) TableName() string { return "tasks" }
+
+type v6User struct {
+	NagEveryMinutes int `gorm:"not null;default:0"`
+	NagRepeats      int `gorm:"not null;default:0"`
+}
+
+func (v6User) TableName() string { return "users" }
+
+// Columns added by version 7
+
+type v7User struct {
+	QuietHoursStart string `gorm:"not null;default:''"`
+	QuietHoursEnd   string `gorm:"not null;default:''"`
+	QuietMode       string `gorm:"not null;default:'defer'"`
+	DNDUntil        *time.Time
+}
+
+func (v7User) TableName() string { return "users" }
+
+type v7Task struct {
+	Urgent bool `gorm:"not null;default:false"`
+}
+
+func (v7Task) TableName() string { return "tasks" }
@@ -6,31 +6,53 @@ import (
 	"gorm.io/gorm"
 )
 
-// ReminderPayload represents the parsed reminder from LLM
+// ReminderPayload represents the parsed reminder from LLM. The desc and enum tags feed the
+// JSON schema the model must answer with, see SchemaFor.
 type ReminderPayload struct {
-	Type        string  `json:"type"` // "task" or "not_task"
-	Title       string  `json:"title,omitempty"`
-	Description string  `json:"description,omitempty"`
-	Datetime    string  `json:"datetime,omitempty"` // ISO 8601
-	Timezone    string  `json:"timezone,omitempty"`
-	Recurrence  *string `json:"recurrence,omitempty"` // null if not recurring
-	SourceText  string  `json:"source_text"`
-	LLMMessage  string  `json:"llm_message,omitempty"` // personal touch message from LLM
+	Type        string   `json:"type" enum:"task,not_task" desc:"task if the message asks for a reminder, otherwise not_task"`
+	Title       string   `json:"title,omitempty" desc:"short title of the task"`
+	Description string   `json:"description,omitempty" desc:"one sentence describing the task"`
+	Datetime    string   `json:"datetime,omitempty" desc:"local due date and time in the reminder timezone, formatted as 2006-01-02T15:04:05"`
+	Timezone    string   `json:"timezone,omitempty" desc:"IANA timezone name, e.g. Asia/Kolkata"`
+	Recurrence  *string  `json:"recurrence,omitempty" desc:"RFC 5545 RRULE without DTSTART, e.g. FREQ=WEEKLY;BYDAY=MO, or null if not recurring"`
+	SourceText  string   `json:"source_text" desc:"the original user message"`
+	Alerts      []string `json:"alerts,omitempty" desc:"extra alerts before the due time the user asked for, as durations like 1d, 1h or 30m; empty if none"`
+	NagEvery    string   `json:"nag_every,omitempty" desc:"how often to repeat the reminder until the user marks it done, as a duration like 10m; off if the user asked not to repeat it; empty if they didn't say"`
+	NagRepeats  int      `json:"nag_repeats,omitempty" desc:"how many times to repeat the reminder at most; 0 for the default"`
+	Urgent      bool     `json:"urgent,omitempty" desc:"true if the user says the reminder is urgent and must come through even during their quiet hours"`
+	LLMMessage  string   `json:"llm_message,omitempty" desc:"friendly confirmation message for the user"`
+}
+
+// ParseResult is everything the parser extracted from one message, which may contain several
+// reminders. An ambiguous message yields a question with candidate answers instead of tasks.
+type ParseResult struct {
+	Type       string            `json:"type" enum:"task,not_task,needs_clarification" desc:"task if the message asks for at least one reminder, needs_clarification if a date or time is ambiguous, otherwise not_task"`
+	Tasks      []ReminderPayload `json:"tasks,omitempty" desc:"one entry per reminder in the message"`
+	Question   string            `json:"question,omitempty" desc:"follow-up question for the user when type is needs_clarification"`
+	Options    []string          `json:"options,omitempty" desc:"short candidate answers to the question, e.g. 7 AM and 7 PM"`
+	LLMMessage string            `json:"llm_message,omitempty" desc:"friendly confirmation message for the user covering all tasks"`
 }
 
 // User represents a Telegram user in the database
 type User struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	TelegramID   int64          `gorm:"uniqueIndex;not null" json:"telegram_id"`
-	Username     *string        `gorm:"index" json:"username,omitempty"`
-	FirstName    *string        `json:"first_name,omitempty"`
-	LastName     *string        `json:"last_name,omitempty"`
-	LanguageCode *string        `json:"language_code,omitempty"`
-	Timezone     string         `gorm:"default:'Asia/Kolkata'" json:"timezone"`
-	IsActive     bool           `gorm:"default:true" json:"is_active"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	TelegramID      int64          `gorm:"uniqueIndex;not null" json:"telegram_id"`
+	Username        *string        `gorm:"index" json:"username,omitempty"`
+	FirstName       *string        `json:"first_name,omitempty"`
+	LastName        *string        `json:"last_name,omitempty"`
+	LanguageCode    *string        `json:"language_code,omitempty"`
+	Timezone        string         `gorm:"default:'Asia/Kolkata'" json:"timezone"`
+	DefaultAlerts   string         `gorm:"not null;default:''" json:"default_alerts,omitempty"` // alerts for new tasks that don't ask for their own, e.g. "1h"
+	NagEveryMinutes int            `gorm:"not null;default:0" json:"nag_every_minutes"`         // nag policy for new tasks that don't set their own; 0 if off
+	NagRepeats      int            `gorm:"not null;default:0" json:"nag_repeats"`
+	QuietHoursStart string         `gorm:"not null;default:''" json:"quiet_hours_start,omitempty"` // daily quiet hours in the user's timezone, e.g. "22:00"; empty if off
+	QuietHoursEnd   string         `gorm:"not null;default:''" json:"quiet_hours_end,omitempty"`   // e.g. "07:00"
+	QuietMode       string         `gorm:"not null;default:'defer'" json:"quiet_mode"`             // defer or silent, see QuietModeDefer
+	DNDUntil        *time.Time     `json:"dnd_until,omitempty"`                                    // do not disturb until then, see /dnd
+	IsActive        bool           `gorm:"default:true" json:"is_active"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 
 	// Relationships
 	Tasks []Task `gorm:"foreignKey:UserID" json:"tasks,omitempty"`
@@ -38,21 +60,111 @@ type User struct {
 
 // Task represents a reminder/task in the database
 type Task struct {
-	ID             uint           `gorm:"primaryKey" json:"id"`
-	UserID         uint           `gorm:"not null;index" json:"user_id"`
-	Title          string         `gorm:"not null" json:"title"`
-	Description    string         `json:"description"`
-	DueDateTime    time.Time      `gorm:"not null;index" json:"due_date_time"`
-	Timezone       string         `gorm:"not null" json:"timezone"`
-	Recurrence     *string        `json:"recurrence,omitempty"`            // null if not recurring
-	SourceText     string         `json:"source_text"`                     // original message from user
-	Status         string         `gorm:"default:'pending'" json:"status"` // pending, completed, cancelled
-	IsActive       bool           `gorm:"default:true" json:"is_active"`
-	ReminderSentAt *time.Time     `json:"reminder_sent_at,omitempty"` // when reminder was sent
-	CreatedAt      time.Time      `json:"created_at"`
-	UpdatedAt      time.Time      `json:"updated_at"`
-	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	UserID           uint           `gorm:"not null;index" json:"user_id"`
+	Title            string         `gorm:"not null" json:"title"`
+	Description      string         `json:"description"`
+	DueDateTime      time.Time      `gorm:"not null;index" json:"due_date_time"`
+	Timezone         string         `gorm:"not null" json:"timezone"`
+	Recurrence       *string        `json:"recurrence,omitempty"`             // DTSTART + RRULE, see RecurrenceRule; null if not recurring
+	SeriesID         *uint          `gorm:"index" json:"series_id,omitempty"` // ID of the first task of a recurring series
+	SourceText       string         `json:"source_text"`                      // original message from user
+	Status           string         `gorm:"default:'pending'" json:"status"`  // pending, completed, cancelled, missed, failed
+	IsActive         bool           `gorm:"default:true" json:"is_active"`
+	ReminderSentAt   *time.Time     `json:"reminder_sent_at,omitempty"`                         // when reminder was sent
+	ClaimedBy        *string        `json:"claimed_by,omitempty"`                               // worker currently delivering the reminder
+	ClaimExpiresAt   *time.Time     `json:"claim_expires_at,omitempty"`                         // when another worker may take the claim over
+	DeliveryAttempts int            `gorm:"not null;default:0" json:"delivery_attempts"`        // failed attempts to send the reminder for the current due time
+	NextRetryAt      *time.Time     `json:"next_retry_at,omitempty"`                            // when to try again after a failed attempt or quiet hours
+	AlertOffsets     string         `gorm:"not null;default:''" json:"alert_offsets,omitempty"` // alerts before the due time, e.g. "1d,1h"; see TaskAlert
+	NagEveryMinutes  int            `gorm:"not null;default:0" json:"nag_every_minutes"`        // resend the reminder this often until it's done; 0 if off
+	NagRepeats       int            `gorm:"not null;default:0" json:"nag_repeats"`              // how many times to resend it at most
+	NagCount         int            `gorm:"not null;default:0" json:"nag_count"`                // how many times it was resent since the reminder
+	NextNagAt        *time.Time     `gorm:"index" json:"next_nag_at,omitempty"`                 // when to resend it next; null if not nagging
+	Urgent           bool           `gorm:"not null;default:false" json:"urgent"`               // sent even during the user's quiet hours
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	// Relationships
+	User    User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Snoozes []TaskSnooze `gorm:"foreignKey:TaskID" json:"snoozes,omitempty"`
+	Alerts  []TaskAlert  `gorm:"foreignKey:TaskID" json:"alerts,omitempty"`
+}
+
+// NextAttemptAt returns when the reminder should next be sent: the due time, or the scheduled
+// retry after a failed attempt
+func (t *Task) NextAttemptAt() time.Time {
+	if t.NextRetryAt != nil && t.NextRetryAt.After(t.DueDateTime) {
+		return *t.NextRetryAt
+	}
+	return t.DueDateTime
+}
+
+// SeriesKey returns the ID shared by all tasks of a recurring series
+func (t *Task) SeriesKey() uint {
+	if t.SeriesID != nil {
+		return *t.SeriesID
+	}
+	return t.ID
+}
+
+// TaskSnooze records one postponement of a delivered reminder
+type TaskSnooze struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	TaskID          uint      `gorm:"not null;index" json:"task_id"`
+	FromDueDateTime time.Time `gorm:"not null" json:"from_due_date_time"` // due time before the snooze (UTC)
+	ToDueDateTime   time.Time `gorm:"not null" json:"to_due_date_time"`   // due time after the snooze (UTC)
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// TaskMessage links a Telegram message the bot sent (a confirmation, reminder, alert or nag) to a task,
+// so replies to that message can refer to the task
+type TaskMessage struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TaskID    uint      `gorm:"not null;index" json:"task_id"`
+	ChatID    int64     `gorm:"not null;index:idx_task_messages_chat_message" json:"chat_id"`
+	MessageID int       `gorm:"not null;index:idx_task_messages_chat_message" json:"message_id"`
+	Kind      string    `gorm:"not null" json:"kind"` // confirmation, reminder, alert, nag
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DeliveryAttempt records one attempt to send a task's reminder
+type DeliveryAttempt struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	TaskID      uint       `gorm:"not null;index" json:"task_id"`
+	Attempt     int        `gorm:"not null" json:"attempt"` // 1 for the first attempt at the current due time
+	WorkerID    string     `json:"worker_id"`
+	ErrorClass  string     `json:"error_class,omitempty"` // empty if the reminder was sent, see DeliveryError constants
+	Error       string     `json:"error,omitempty"`
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty"` // null if sent or given up
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// TaskAlert is one alert sent ahead of a task's due time, e.g. a day or an hour before, for each
+// entry of Task.AlertOffsets. Every alert is claimed, sent and retried on its own; the reminder at
+// the due time itself is tracked on the task. Alerts are only sent while the task is still ahead.
+type TaskAlert struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	TaskID         uint       `gorm:"not null;index" json:"task_id"`
+	OffsetMinutes  int        `gorm:"not null" json:"offset_minutes"` // how long before the due time
+	AlertAt        time.Time  `gorm:"not null;index" json:"alert_at"` // due time minus the offset (UTC)
+	SentAt         *time.Time `json:"sent_at,omitempty"`
+	ClaimedBy      *string    `json:"claimed_by,omitempty"`
+	ClaimExpiresAt *time.Time `json:"claim_expires_at,omitempty"`
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"` // failed attempts to send the alert
+	NextRetryAt    *time.Time `json:"next_retry_at,omitempty"`
+	FailedAt       *time.Time `json:"failed_at,omitempty"` // when sending the alert was given up
+	CreatedAt      time.Time  `json:"created_at"`
 
 	// Relationships
-	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Task Task `gorm:"foreignKey:TaskID" json:"task,omitempty"`
+}
+
+// NextAttemptAt returns when the alert should next be sent
+func (a *TaskAlert) NextAttemptAt() time.Time {
+	if a.NextRetryAt != nil && a.NextRetryAt.After(a.AlertAt) {
+		return *a.NextRetryAt
+	}
+	return a.AlertAt
 }
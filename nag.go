@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Limits on nagging: how often and how many times an unacknowledged reminder is sent again
+const (
+	defaultNagRepeats = 5
+	maxNagRepeats     = 20
+	minNagInterval    = time.Minute
+	maxNagInterval    = 24 * time.Hour
+)
+
+// ParseNagInterval parses how often a reminder is sent again until it's done, e.g. "10m" or "1h"
+func ParseNagInterval(text string) (time.Duration, error) {
+	interval, err := parseSnoozeDuration(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid nag interval %q, expected a duration like 10m or 1h", text)
+	}
+	if interval < minNagInterval || interval > maxNagInterval {
+		return 0, fmt.Errorf("nag interval %q must be between %s and %s", text,
+			describeDuration(minNagInterval), describeDuration(maxNagInterval))
+	}
+	return interval.Truncate(time.Minute), nil
+}
+
+// nagPolicy resolves the nag fields of a parsed reminder into an interval in minutes and a repeat
+// limit. An empty or "off" interval turns nagging off; zero repeats means defaultNagRepeats.
+func nagPolicy(every string, repeats int) (int, int, error) {
+	every = strings.TrimSpace(every)
+	if every == "" || strings.EqualFold(every, "off") {
+		return 0, 0, nil
+	}
+	interval, err := ParseNagInterval(every)
+	if err != nil {
+		return 0, 0, err
+	}
+	if repeats == 0 {
+		repeats = defaultNagRepeats
+	}
+	if repeats < 0 || repeats > maxNagRepeats {
+		return 0, 0, fmt.Errorf("a reminder can be repeated 1 to %d times, got %d", maxNagRepeats, repeats)
+	}
+	return int(interval / time.Minute), repeats, nil
+}
+
+// formatNagEvery returns the nag interval of a task or user as a parsed reminder would give it
+func formatNagEvery(minutes int) string {
+	if minutes == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// describeNag renders a nag policy for people, e.g. "every 10 minutes, up to 5 times"
+func describeNag(minutes, repeats int) string {
+	if minutes == 0 {
+		return ""
+	}
+	return fmt.Sprintf("every %s, up to %d %s", describeDuration(time.Duration(minutes)*time.Minute),
+		repeats, pluralize(repeats, "time", "times"))
+}
+
+// nextNagAt returns when a task that was just reminded at now should be sent again, given how many
+// times it was already repeated, or nil once it has been repeated often enough
+func nextNagAt(task *Task, repeated int, now time.Time) *time.Time {
+	if task.NagEveryMinutes <= 0 || repeated >= task.NagRepeats {
+		return nil
+	}
+	next := now.Add(time.Duration(task.NagEveryMinutes) * time.Minute).UTC()
+	return &next
+}
+
+// applyDefaultNag gives parsed reminders that don't say whether to nag the user's default policy
+func applyDefaultNag(payloads []ReminderPayload, user *User) {
+	if user.NagEveryMinutes == 0 {
+		return
+	}
+	for i := range payloads {
+		if payloads[i].NagEvery == "" {
+			payloads[i].NagEvery = formatNagEvery(user.NagEveryMinutes)
+			payloads[i].NagRepeats = user.NagRepeats
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// expiringMap is a small concurrency-safe map whose entries expire after a fixed TTL.
+// It holds short-lived conversation state, such as a pending custom snooze prompt.
+type expiringMap[K comparable, V any] struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	clock Clock
+	items map[K]expiringEntry[V]
+}
+
+type expiringEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// newExpiringMap creates an expiringMap whose entries live for ttl as told by clock
+func newExpiringMap[K comparable, V any](ttl time.Duration, clock Clock) *expiringMap[K, V] {
+	return &expiringMap[K, V]{ttl: ttl, clock: clock, items: make(map[K]expiringEntry[V])}
+}
+
+// Set stores a value, replacing any existing entry and restarting its TTL
+func (m *expiringMap[K, V]) Set(key K, value V) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = expiringEntry[V]{value: value, expiresAt: m.clock.Now().Add(m.ttl)}
+}
+
+// Get returns the value for key if it exists and has not expired
+func (m *expiringMap[K, V]) Get(key K) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.get(key)
+}
+
+// Take returns the value for key and removes it
+func (m *expiringMap[K, V]) Take(key K) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.get(key)
+	delete(m.items, key)
+	return value, ok
+}
+
+// Delete removes the entry for key
+func (m *expiringMap[K, V]) Delete(key K) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, key)
+}
+
+func (m *expiringMap[K, V]) get(key K) (V, bool) {
+	entry, ok := m.items[key]
+	if !ok || m.clock.Now().After(entry.expiresAt) {
+		delete(m.items, key)
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
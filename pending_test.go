@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiringMap(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	m := newExpiringMap[int64, string](10*time.Minute, clock)
+
+	m.Set(1, "snooze")
+	clock.Advance(10 * time.Minute)
+	if got, ok := m.Get(1); !ok || got != "snooze" {
+		t.Fatalf("Get() at the TTL = %q, %v, want the entry", got, ok)
+	}
+	clock.Advance(time.Nanosecond)
+	if got, ok := m.Get(1); ok {
+		t.Fatalf("Get() after the TTL = %q, want it expired", got)
+	}
+
+	// Setting an entry again restarts its TTL
+	m.Set(2, "first")
+	clock.Advance(8 * time.Minute)
+	m.Set(2, "second")
+	clock.Advance(8 * time.Minute)
+	if got, ok := m.Get(2); !ok || got != "second" {
+		t.Errorf("Get() of a renewed entry = %q, %v, want %q", got, ok, "second")
+	}
+
+	// Take hands out a live entry once, and an expired one never
+	m.Set(3, "clarify")
+	if got, ok := m.Take(3); !ok || got != "clarify" {
+		t.Errorf("Take() = %q, %v, want the entry", got, ok)
+	}
+	if _, ok := m.Take(3); ok {
+		t.Errorf("Take() returned the entry twice")
+	}
+	m.Set(4, "edit")
+	clock.Advance(11 * time.Minute)
+	if got, ok := m.Take(4); ok {
+		t.Errorf("Take() after the TTL = %q, want it expired", got)
+	}
+}
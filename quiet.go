@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What happens to reminders that come up during quiet hours or do not disturb, see User.QuietMode
+const (
+	QuietModeDefer  = "defer"  // hold them back until the quiet period ends
+	QuietModeSilent = "silent" // send them right away without a notification sound
+)
+
+// maxDND is the longest do not disturb period /dnd accepts
+const maxDND = 7 * 24 * time.Hour
+
+// reQuietHours matches a daily quiet period such as "22:00-07:00", "22-7" or "10pm to 7am"
+var reQuietHours = regexp.MustCompile(`(?i)^(\d{1,2})(?::(\d{2}))?\s*(am|pm)?\s*(?:-|–|to)\s*(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+
+// ParseQuietHours parses daily quiet hours like "22:00-07:00" or "10pm-7am" and returns their start
+// and end in their stored form, e.g. "22:00" and "07:00"
+func ParseQuietHours(text string) (string, string, error) {
+	m := reQuietHours.FindStringSubmatch(strings.TrimSpace(text))
+	if m == nil {
+		return "", "", fmt.Errorf("invalid quiet hours %q, expected a range like 22:00-07:00", text)
+	}
+	start, err := parseClock(m[1], m[2], m[3])
+	if err != nil {
+		return "", "", err
+	}
+	end, err := parseClock(m[4], m[5], m[6])
+	if err != nil {
+		return "", "", err
+	}
+	if start == end {
+		return "", "", fmt.Errorf("quiet hours %q start and end at the same time", text)
+	}
+	return start, end, nil
+}
+
+// parseClock turns the hour, minute and optional am/pm of a time of day into "15:04" form
+func parseClock(hour, minute, meridiem string) (string, error) {
+	h, _ := strconv.Atoi(hour)
+	m := 0
+	if minute != "" {
+		m, _ = strconv.Atoi(minute)
+	}
+	switch strings.ToLower(meridiem) {
+	case "am", "pm":
+		if h < 1 || h > 12 {
+			return "", fmt.Errorf("invalid time %s%s", hour, meridiem)
+		}
+		h %= 12
+		if strings.EqualFold(meridiem, "pm") {
+			h += 12
+		}
+	}
+	if h > 23 || m > 59 {
+		return "", fmt.Errorf("invalid time %s:%02d", hour, m)
+	}
+	return fmt.Sprintf("%02d:%02d", h, m), nil
+}
+
+// minuteOfDay returns the minutes since midnight of a stored time of day like "22:30"
+func minuteOfDay(clock string) (int, bool) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// quietHoursEnd returns when the user's daily quiet hours that t falls in end, if it falls in them
+func quietHoursEnd(user *User, t time.Time) (time.Time, bool) {
+	start, ok := minuteOfDay(user.QuietHoursStart)
+	if !ok {
+		return time.Time{}, false
+	}
+	end, ok := minuteOfDay(user.QuietHoursEnd)
+	if !ok || start == end {
+		return time.Time{}, false
+	}
+
+	local := t.In(LoadTimezone(user.Timezone))
+	minute := local.Hour()*60 + local.Minute()
+	endOn := func(days int) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day()+days, end/60, end%60, 0, 0, local.Location())
+	}
+	switch {
+	case start < end && minute >= start && minute < end:
+		return endOn(0), true
+	case start > end && minute >= start:
+		// Overnight quiet hours, e.g. 22:00-07:00, end the next morning
+		return endOn(1), true
+	case start > end && minute < end:
+		return endOn(0), true
+	}
+	return time.Time{}, false
+}
+
+// quietUntil returns when the user's current quiet period, from do not disturb or quiet hours, ends.
+// It reports false if the user can be disturbed at now.
+func quietUntil(user *User, now time.Time) (time.Time, bool) {
+	until := now
+	if user.DNDUntil != nil && user.DNDUntil.After(until) {
+		until = *user.DNDUntil
+	}
+	// Do not disturb that runs into quiet hours lasts until they end too
+	if end, ok := quietHoursEnd(user, until); ok {
+		until = end
+	}
+	return until, until.After(now)
+}
+
+// quietDelivery decides how a task's reminder goes out at now, given its user's quiet hours and do not
+// disturb: right away, silently, or held back until the returned time. Urgent tasks always go out.
+func quietDelivery(task *Task, now time.Time) (*time.Time, bool) {
+	until, quiet := quietUntil(&task.User, now)
+	switch {
+	case !quiet || task.Urgent:
+		return nil, false
+	case task.User.QuietMode == QuietModeSilent:
+		return nil, true
+	default:
+		return &until, false
+	}
+}
+
+// quietNote marks messages sent without a sound during the user's quiet period
+const quietNote = "🌙 _Quiet hours - sent without sound_\n\n"
+
+// describeQuietHours renders the user's quiet hours and what happens during them, e.g.
+// "22:00-07:00 (Asia/Kolkata), reminders wait until the quiet period ends"
+func describeQuietHours(user *User) string {
+	if user.QuietHoursStart == "" {
+		return "off"
+	}
+	return fmt.Sprintf("%s-%s (%s), %s", user.QuietHoursStart, user.QuietHoursEnd, user.Timezone, describeQuietMode(user.QuietMode))
+}
+
+// describeQuietMode says what happens to reminders during a quiet period
+func describeQuietMode(mode string) string {
+	if mode == QuietModeSilent {
+		return "reminders arrive silently"
+	}
+	return "reminders wait until the quiet period ends"
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuietHoursEnd(t *testing.T) {
+	kolkata := mustLocation(t, "Asia/Kolkata")
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 0, 0, kolkata) }
+	overnight := &User{Timezone: "Asia/Kolkata", QuietHoursStart: "22:00", QuietHoursEnd: "07:00"}
+	lunch := &User{Timezone: "Asia/Kolkata", QuietHoursStart: "13:00", QuietHoursEnd: "14:00"}
+
+	tests := []struct {
+		name string
+		user *User
+		t    time.Time
+		want time.Time // zero if t isn't in quiet hours
+	}{
+		{"before overnight hours", overnight, at(17, 21, 59), time.Time{}},
+		{"start of overnight hours", overnight, at(17, 22, 0), at(18, 7, 0)},
+		{"before midnight", overnight, at(17, 23, 30), at(18, 7, 0)},
+		{"after midnight", overnight, at(18, 0, 30), at(18, 7, 0)},
+		{"last minute", overnight, at(18, 6, 59), at(18, 7, 0)},
+		{"end of overnight hours", overnight, at(18, 7, 0), time.Time{}},
+		{"in the daytime", overnight, at(18, 12, 0), time.Time{}},
+		{"same day hours", lunch, at(17, 13, 15), at(17, 14, 0)},
+		{"outside same day hours", lunch, at(17, 14, 0), time.Time{}},
+		{"in another timezone", overnight, time.Date(2026, 10, 17, 17, 0, 0, 0, time.UTC), at(18, 7, 0)},
+		{"no quiet hours", &User{Timezone: "Asia/Kolkata"}, at(17, 23, 0), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := quietHoursEnd(tt.user, tt.t)
+			if ok != !tt.want.IsZero() || ok && !got.Equal(tt.want) {
+				t.Errorf("quietHoursEnd() = %v, %v, want %v", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuietUntil(t *testing.T) {
+	now := time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+	dnd := func(d time.Duration) *time.Time {
+		until := now.Add(d)
+		return &until
+	}
+
+	tests := []struct {
+		name string
+		user User
+		want time.Time // zero if the user can be disturbed
+	}{
+		{"nothing set", User{Timezone: "UTC"}, time.Time{}},
+		{"do not disturb", User{Timezone: "UTC", DNDUntil: dnd(2 * time.Hour)}, now.Add(2 * time.Hour)},
+		{"do not disturb that expired", User{Timezone: "UTC", DNDUntil: dnd(-time.Minute)}, time.Time{}},
+		{"do not disturb ending now", User{Timezone: "UTC", DNDUntil: dnd(0)}, time.Time{}},
+		{
+			"do not disturb running into quiet hours",
+			User{Timezone: "UTC", DNDUntil: dnd(15 * time.Hour), QuietHoursStart: "22:00", QuietHoursEnd: "07:00"},
+			time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			"do not disturb ending before quiet hours",
+			User{Timezone: "UTC", DNDUntil: dnd(time.Hour), QuietHoursStart: "22:00", QuietHoursEnd: "07:00"},
+			now.Add(time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, quiet := quietUntil(&tt.user, now)
+			if quiet != !tt.want.IsZero() || quiet && !got.Equal(tt.want) {
+				t.Errorf("quietUntil() = %v, %v, want %v", got, quiet, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDueTasksQuietHours(t *testing.T) {
+	// Quiet from 22:00 to 07:00 UTC; the clock starts at 23:00
+	night := time.Date(2026, 10, 17, 23, 0, 0, 0, time.UTC)
+	morning := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		mode   string
+		urgent bool
+		sentAt time.Time // when the reminder goes out
+		silent bool
+	}{
+		{"deferred until the morning", QuietModeDefer, false, morning, false},
+		{"sent silently", QuietModeSilent, false, night, true},
+		{"urgent goes through", QuietModeDefer, true, night, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler, fake, store, clock := newTestScheduler(t)
+			clock.Set(night)
+			task := newStoreTask(t, store, ReminderPayload{Title: "Call mom", Datetime: "2026-10-17T23:00:00", Urgent: tt.urgent})
+			if err := store.UpdateUserTimezone(task.UserID, "UTC"); err != nil {
+				t.Fatalf("UpdateUserTimezone() error = %v", err)
+			}
+			if err := store.UpdateUserQuietHours(task.UserID, "22:00", "07:00", tt.mode); err != nil {
+				t.Fatalf("UpdateUserQuietHours() error = %v", err)
+			}
+			check := func() { checkDueTasks(scheduler.bot, store, clock, scheduler.config) }
+
+			check()
+			if !tt.sentAt.Equal(night) {
+				if calls := fake.Calls("sendMessage"); len(calls) != 0 {
+					t.Fatalf("sent %d messages during quiet hours", len(calls))
+				}
+				got, err := store.GetUserTask(task.UserID, task.ID)
+				if err != nil || got.NextRetryAt == nil || !got.NextRetryAt.Equal(tt.sentAt) || got.DeliveryAttempts != 0 {
+					t.Fatalf("deferred task = %+v, %v, want it held back until %v without an attempt", got, err, tt.sentAt)
+				}
+				clock.Set(tt.sentAt.Add(-time.Second))
+				check()
+				if calls := fake.Calls("sendMessage"); len(calls) != 0 {
+					t.Fatalf("sent %d messages before the quiet hours ended", len(calls))
+				}
+				clock.Set(tt.sentAt)
+				check()
+			}
+
+			calls := fake.Calls("sendMessage")
+			if len(calls) != 1 {
+				t.Fatalf("sent %d messages at %v, want the reminder", len(calls), tt.sentAt)
+			}
+			silent := calls[0].Params["disable_notification"] == "true"
+			noted := strings.HasPrefix(calls[0].Params["text"], quietNote)
+			if silent != tt.silent || noted != tt.silent {
+				t.Errorf("reminder sent without sound: %v, with the quiet note: %v, want %v", silent, noted, tt.silent)
+			}
+			if got, err := store.GetUserTask(task.UserID, task.ID); err != nil || got.ReminderSentAt == nil {
+				t.Errorf("task = %+v, %v, want its reminder sent", got, err)
+			}
+		})
+	}
+}
+
+func TestCheckDueTasksDoNotDisturb(t *testing.T) {
+	scheduler, fake, store, clock := newTestScheduler(t)
+	task := newStoreTask(t, store, ReminderPayload{Title: "Call mom", Datetime: "2026-10-17T08:00:00"})
+	until := clock.Now().Add(90 * time.Minute)
+	if err := store.UpdateUserDND(task.UserID, &until); err != nil {
+		t.Fatalf("UpdateUserDND() error = %v", err)
+	}
+	check := func() { checkDueTasks(scheduler.bot, store, clock, scheduler.config) }
+
+	// Held back while do not disturb lasts, and sent once it expires
+	check()
+	clock.Set(until.Add(-time.Second))
+	check()
+	if calls := fake.Calls("sendMessage"); len(calls) != 0 {
+		t.Fatalf("sent %d messages during do not disturb", len(calls))
+	}
+	clock.Set(until)
+	check()
+	if calls := fake.Calls("sendMessage"); len(calls) != 1 || calls[0].Params["disable_notification"] == "true" {
+		t.Fatalf("sent %d messages when do not disturb expired, want the reminder with sound", len(calls))
+	}
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the FREQ part of a recurrence rule
+type Frequency string
+
+const (
+	FrequencyDaily   Frequency = "DAILY"
+	FrequencyWeekly  Frequency = "WEEKLY"
+	FrequencyMonthly Frequency = "MONTHLY"
+	FrequencyYearly  Frequency = "YEARLY"
+)
+
+// maxRecurrencePeriods bounds how many periods a NextOccurrence call walks before giving up,
+// so rules that can never match (e.g. BYMONTHDAY=31 every 12 months from February) terminate
+const maxRecurrencePeriods = 100000
+
+// WeekdayRule is a BYDAY entry, e.g. "MO" or "-1FR" (last Friday of the month)
+type WeekdayRule struct {
+	Weekday time.Weekday
+	Ordinal int // 0 means every matching weekday in the period
+}
+
+// RecurrenceRule is the supported subset of an RFC 5545 RRULE plus its DTSTART
+type RecurrenceRule struct {
+	Freq       Frequency
+	Interval   int
+	ByDay      []WeekdayRule
+	ByMonthDay []int     // 1..31, or -1..-31 counting from the end of the month
+	Count      int       // 0 means unlimited
+	Until      time.Time // zero means no end date
+	Start      time.Time // DTSTART in the task's own location; the first occurrence
+}
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// recurrenceAliases maps the plain words older LLM responses used to an equivalent RRULE
+var recurrenceAliases = map[string]string{
+	"daily":       "FREQ=DAILY",
+	"every day":   "FREQ=DAILY",
+	"weekly":      "FREQ=WEEKLY",
+	"every week":  "FREQ=WEEKLY",
+	"monthly":     "FREQ=MONTHLY",
+	"every month": "FREQ=MONTHLY",
+	"yearly":      "FREQ=YEARLY",
+	"annually":    "FREQ=YEARLY",
+	"every year":  "FREQ=YEARLY",
+}
+
+// ParseRecurrence parses a stored recurrence. It accepts a bare RRULE ("FREQ=DAILY;INTERVAL=2"),
+// an "RRULE:" prefixed line, the two-line DTSTART/RRULE form produced by String, or a plain alias
+// like "daily". loc is used for DTSTART and UNTIL values that carry no zone of their own.
+func ParseRecurrence(text string, loc *time.Location) (*RecurrenceRule, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	text = strings.TrimSpace(text)
+	if alias, ok := recurrenceAliases[strings.ToLower(text)]; ok {
+		text = alias
+	}
+	if text == "" {
+		return nil, fmt.Errorf("empty recurrence rule")
+	}
+
+	rule := &RecurrenceRule{Interval: 1}
+	var rrule string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(strings.ToUpper(line), "DTSTART"):
+			start, err := parseDTStart(line, loc)
+			if err != nil {
+				return nil, err
+			}
+			rule.Start = start
+		case strings.HasPrefix(strings.ToUpper(line), "RRULE:"):
+			rrule = line[len("RRULE:"):]
+		default:
+			rrule = line
+		}
+	}
+	if rrule == "" {
+		return nil, fmt.Errorf("missing RRULE in recurrence %q", text)
+	}
+
+	startLoc := loc
+	if !rule.Start.IsZero() {
+		startLoc = rule.Start.Location()
+	}
+
+	for _, part := range strings.Split(rrule, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid RRULE part %q", part)
+		}
+		key = strings.ToUpper(strings.TrimSpace(key))
+		value = strings.ToUpper(strings.TrimSpace(value))
+
+		switch key {
+		case "FREQ":
+			switch Frequency(value) {
+			case FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyYearly:
+				rule.Freq = Frequency(value)
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", value)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseICalTime(value, startLoc, true)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL %q: %v", value, err)
+			}
+			rule.Until = until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wd, err := parseWeekdayRule(day)
+				if err != nil {
+					return nil, err
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %q", day)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		case "WKST":
+			if value != "MO" {
+				return nil, fmt.Errorf("unsupported WKST %q, only MO is supported", value)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part %q", key)
+		}
+	}
+
+	if err := rule.validate(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// validate checks combinations of parts that the engine does not support
+func (r *RecurrenceRule) validate() error {
+	if r.Freq == "" {
+		return fmt.Errorf("RRULE is missing FREQ")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return fmt.Errorf("COUNT and UNTIL cannot be used together")
+	}
+	for _, wd := range r.ByDay {
+		if wd.Ordinal != 0 && r.Freq != FrequencyMonthly {
+			return fmt.Errorf("ordinal BYDAY values are only supported with FREQ=MONTHLY")
+		}
+	}
+	if r.Freq == FrequencyWeekly && len(r.ByMonthDay) > 0 {
+		return fmt.Errorf("BYMONTHDAY cannot be used with FREQ=WEEKLY")
+	}
+	if r.Freq == FrequencyYearly && len(r.ByDay) > 0 {
+		return fmt.Errorf("BYDAY is not supported with FREQ=YEARLY")
+	}
+	return nil
+}
+
+func parseWeekdayRule(text string) (WeekdayRule, error) {
+	text = strings.TrimSpace(text)
+	if len(text) < 2 {
+		return WeekdayRule{}, fmt.Errorf("invalid BYDAY %q", text)
+	}
+	code := text[len(text)-2:]
+	wd, ok := weekdayCodes[code]
+	if !ok {
+		return WeekdayRule{}, fmt.Errorf("invalid BYDAY %q", text)
+	}
+	rule := WeekdayRule{Weekday: wd}
+	if prefix := text[:len(text)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return WeekdayRule{}, fmt.Errorf("invalid BYDAY %q", text)
+		}
+		rule.Ordinal = n
+	}
+	return rule, nil
+}
+
+// parseDTStart parses "DTSTART:20251022T090000Z" or "DTSTART;TZID=Asia/Kolkata:20251022T090000"
+func parseDTStart(line string, loc *time.Location) (time.Time, error) {
+	head, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid DTSTART %q", line)
+	}
+	for _, param := range strings.Split(head, ";")[1:] {
+		key, tzid, _ := strings.Cut(param, "=")
+		if strings.EqualFold(key, "TZID") {
+			tz, err := time.LoadLocation(tzid)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid DTSTART TZID %q: %v", tzid, err)
+			}
+			loc = tz
+		}
+	}
+	start, err := parseICalTime(value, loc, false)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid DTSTART %q: %v", line, err)
+	}
+	return start.In(loc), nil
+}
+
+// parseICalTime parses an RFC 5545 DATE or DATE-TIME value; a trailing Z means UTC.
+// With endOfDay set, a DATE value resolves to the last second of that day (used for UNTIL).
+func parseICalTime(value string, loc *time.Location, endOfDay bool) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse("20060102T150405Z", value)
+	}
+	if len(value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		if err != nil || !endOfDay {
+			return t, err
+		}
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.ParseInLocation("20060102T150405", value, loc)
+}
+
+// RRule returns the rule without its DTSTART, e.g. "FREQ=WEEKLY;BYDAY=MO,WE"
+func (r *RecurrenceRule) RRule() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = weekdayNames[wd.Weekday]
+			if wd.Ordinal != 0 {
+				days[i] = strconv.Itoa(wd.Ordinal) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// String returns the canonical stored form: a DTSTART line (when known) followed by the RRULE
+func (r *RecurrenceRule) String() string {
+	if r.Start.IsZero() {
+		return "RRULE:" + r.RRule()
+	}
+	return fmt.Sprintf("DTSTART;TZID=%s:%s\nRRULE:%s",
+		r.Start.Location().String(), r.Start.Format("20060102T150405"), r.RRule())
+}
+
+// Describe returns a short human readable summary such as "every 2 weeks on Mon, Wed"
+func (r *RecurrenceRule) Describe() string {
+	units := map[Frequency]string{
+		FrequencyDaily:   "day",
+		FrequencyWeekly:  "week",
+		FrequencyMonthly: "month",
+		FrequencyYearly:  "year",
+	}
+	desc := "every " + units[r.Freq]
+	if r.Interval > 1 {
+		desc = fmt.Sprintf("every %d %ss", r.Interval, units[r.Freq])
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = wd.Weekday.String()[:3]
+			if wd.Ordinal != 0 {
+				days[i] = ordinalName(wd.Ordinal) + " " + days[i]
+			}
+		}
+		desc += " on " + strings.Join(days, ", ")
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = ordinalName(d)
+			if d < 0 {
+				days[i] += " day"
+			}
+		}
+		desc += " on the " + strings.Join(days, ", ")
+	}
+	if r.Count > 0 {
+		desc += fmt.Sprintf(", %d times", r.Count)
+	}
+	if !r.Until.IsZero() {
+		desc += " until " + r.Until.In(r.location()).Format("2006-01-02")
+	}
+	return desc
+}
+
+func ordinalName(n int) string {
+	if n == -1 {
+		return "last"
+	}
+	if n < 0 {
+		return fmt.Sprintf("%s last", ordinalName(-n))
+	}
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+func (r *RecurrenceRule) location() *time.Location {
+	if r.Start.IsZero() {
+		return time.UTC
+	}
+	return r.Start.Location()
+}
+
+// NextOccurrence returns the first occurrence strictly after the given instant.
+// Occurrences keep DTSTART's wall clock time in its location, so a 09:00 rule stays at 09:00
+// across DST changes. Dates that do not exist in a month (e.g. the 31st) are skipped as RFC 5545
+// requires, and the COUNT limit includes DTSTART itself. ok is false when the rule is exhausted.
+func (r *RecurrenceRule) NextOccurrence(after time.Time) (next time.Time, ok bool) {
+	if r.Start.IsZero() {
+		return time.Time{}, false
+	}
+
+	// DTSTART is always the first occurrence, whether or not it matches the rule
+	seen := 1
+	if r.Start.After(after) {
+		return r.Start, true
+	}
+
+	// Without COUNT nothing needs the occurrences before after, so the walk starts at the period
+	// holding it, usually the previous occurrence, instead of at DTSTART
+	first := 0
+	if r.Count == 0 {
+		first = r.periodOf(after)
+	}
+	for period := first; period < first+maxRecurrencePeriods; period++ {
+		for _, candidate := range r.periodOccurrences(period) {
+			if !candidate.After(r.Start) {
+				continue
+			}
+			if !r.Until.IsZero() && candidate.After(r.Until) {
+				return time.Time{}, false
+			}
+			seen++
+			if r.Count > 0 && seen > r.Count {
+				return time.Time{}, false
+			}
+			if candidate.After(after) {
+				return candidate, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// periodOf returns the index of the FREQ/INTERVAL period after DTSTART that contains t
+func (r *RecurrenceRule) periodOf(t time.Time) int {
+	start := r.Start
+	local := t.In(start.Location())
+	var elapsed int
+	switch r.Freq {
+	case FrequencyDaily:
+		elapsed = daysBetween(start, local)
+	case FrequencyWeekly:
+		// Weeks start on Monday (WKST=MO)
+		elapsed = (daysBetween(start, local) + (int(start.Weekday())+6)%7) / 7
+	case FrequencyMonthly:
+		elapsed = (local.Year()-start.Year())*12 + int(local.Month()) - int(start.Month())
+	case FrequencyYearly:
+		elapsed = local.Year() - start.Year()
+	}
+	if elapsed < 0 {
+		return 0
+	}
+	return elapsed / r.Interval
+}
+
+// daysBetween counts the calendar days from a's date to b's date
+func daysBetween(a, b time.Time) int {
+	from := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	to := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// periodOccurrences expands the n-th FREQ/INTERVAL period after DTSTART into sorted occurrences
+func (r *RecurrenceRule) periodOccurrences(n int) []time.Time {
+	start := r.Start
+	loc := start.Location()
+	step := n * r.Interval
+
+	var dates []time.Time // midnight of each candidate day, in loc
+	switch r.Freq {
+	case FrequencyDaily:
+		day := time.Date(start.Year(), start.Month(), start.Day()+step, 0, 0, 0, 0, loc)
+		if r.matchesDay(day) {
+			dates = append(dates, day)
+		}
+	case FrequencyWeekly:
+		// Weeks start on Monday (WKST=MO)
+		offset := (int(start.Weekday()) + 6) % 7
+		monday := time.Date(start.Year(), start.Month(), start.Day()-offset+7*step, 0, 0, 0, 0, loc)
+		if len(r.ByDay) == 0 {
+			dates = append(dates, monday.AddDate(0, 0, offset))
+			break
+		}
+		for i := 0; i < 7; i++ {
+			day := monday.AddDate(0, 0, i)
+			if r.matchesWeekday(day) {
+				dates = append(dates, day)
+			}
+		}
+	case FrequencyMonthly:
+		first := time.Date(start.Year(), start.Month()+time.Month(step), 1, 0, 0, 0, 0, loc)
+		dates = r.monthDates(first, len(r.ByDay) > 0)
+	case FrequencyYearly:
+		first := time.Date(start.Year()+step, start.Month(), 1, 0, 0, 0, 0, loc)
+		dates = r.monthDates(first, false)
+	}
+
+	occurrences := make([]time.Time, 0, len(dates))
+	for _, day := range dates {
+		occurrences = append(occurrences, wallClockTime(day, start))
+	}
+	sort.Slice(occurrences, func(i, j int) bool { return occurrences[i].Before(occurrences[j]) })
+	return occurrences
+}
+
+// wallClockTime combines a day with the clock time of start in start's location.
+// A time that falls in a DST gap is moved forward by the length of the gap (02:30 becomes 03:30),
+// and an ambiguous time resolves to its first instance, as RFC 5545 requires.
+func wallClockTime(day, start time.Time) time.Time {
+	t := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	if t.Hour() == start.Hour() && t.Minute() == start.Minute() {
+		return t
+	}
+	// Go resolves gap times with the offset after the transition; RFC 5545 uses the one before it
+	_, offset := t.Zone()
+	before := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), start.Second(), 0, time.FixedZone("", offset))
+	return before.In(start.Location())
+}
+
+// monthDates expands a single month (given its first day) using BYMONTHDAY and BYDAY,
+// falling back to DTSTART's day of month when neither is set
+func (r *RecurrenceRule) monthDates(first time.Time, useByDay bool) []time.Time {
+	daysInMonth := first.AddDate(0, 1, -1).Day()
+
+	var dates []time.Time
+	if len(r.ByMonthDay) == 0 && !useByDay {
+		if r.Start.Day() <= daysInMonth {
+			dates = append(dates, first.AddDate(0, 0, r.Start.Day()-1))
+		}
+		return dates
+	}
+
+	for d := 1; d <= daysInMonth; d++ {
+		day := first.AddDate(0, 0, d-1)
+		if len(r.ByMonthDay) > 0 && !r.matchesMonthDay(day) {
+			continue
+		}
+		if useByDay && !r.matchesMonthWeekday(day, daysInMonth) {
+			continue
+		}
+		dates = append(dates, day)
+	}
+	return dates
+}
+
+// matchesDay applies BYDAY and BYMONTHDAY as filters, which is how DAILY rules use them
+func (r *RecurrenceRule) matchesDay(day time.Time) bool {
+	if len(r.ByDay) > 0 && !r.matchesWeekday(day) {
+		return false
+	}
+	if len(r.ByMonthDay) > 0 && !r.matchesMonthDay(day) {
+		return false
+	}
+	return true
+}
+
+func (r *RecurrenceRule) matchesWeekday(day time.Time) bool {
+	for _, wd := range r.ByDay {
+		if wd.Weekday == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthWeekday handles ordinal BYDAY values such as 2TU or -1FR within a month
+func (r *RecurrenceRule) matchesMonthWeekday(day time.Time, daysInMonth int) bool {
+	for _, wd := range r.ByDay {
+		if wd.Weekday != day.Weekday() {
+			continue
+		}
+		switch {
+		case wd.Ordinal == 0:
+			return true
+		case wd.Ordinal > 0 && (day.Day()-1)/7+1 == wd.Ordinal:
+			return true
+		case wd.Ordinal < 0 && (daysInMonth-day.Day())/7+1 == -wd.Ordinal:
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RecurrenceRule) matchesMonthDay(day time.Time) bool {
+	daysInMonth := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+	for _, d := range r.ByMonthDay {
+		if d > 0 && day.Day() == d {
+			return true
+		}
+		if d < 0 && day.Day() == daysInMonth+d+1 {
+			return true
+		}
+	}
+	return false
+}
+
+// TaskRecurrence returns the parsed recurrence of a task, or nil if it does not repeat.
+// Rules stored without a DTSTART are anchored at the task's own due time.
+func TaskRecurrence(task *Task) (*RecurrenceRule, error) {
+	if task.Recurrence == nil || strings.TrimSpace(*task.Recurrence) == "" {
+		return nil, nil
+	}
+	loc := LoadTimezone(task.Timezone)
+	rule, err := ParseRecurrence(*task.Recurrence, loc)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Start.IsZero() {
+		rule.Start = task.DueDateTime.In(loc)
+	}
+	return rule, nil
+}
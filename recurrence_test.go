@@ -0,0 +1,237 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestWallClockTime(t *testing.T) {
+	ny := mustLocation(t, "America/New_York")
+	kolkata := mustLocation(t, "Asia/Kolkata")
+
+	tests := []struct {
+		name  string
+		day   time.Time
+		start time.Time
+		want  time.Time
+	}{
+		{
+			name:  "ordinary day",
+			day:   time.Date(2025, 6, 10, 0, 0, 0, 0, kolkata),
+			start: time.Date(2025, 1, 1, 9, 0, 0, 0, kolkata),
+			want:  time.Date(2025, 6, 10, 3, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "keeps wall clock time across DST",
+			day:   time.Date(2025, 7, 1, 0, 0, 0, 0, ny),
+			start: time.Date(2025, 1, 1, 9, 0, 0, 0, ny),
+			want:  time.Date(2025, 7, 1, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			// 02:30 does not exist on 2025-03-09, it moves forward by the hour long gap
+			name:  "spring forward gap",
+			day:   time.Date(2025, 3, 9, 0, 0, 0, 0, ny),
+			start: time.Date(2025, 1, 1, 2, 30, 0, 0, ny),
+			want:  time.Date(2025, 3, 9, 7, 30, 0, 0, time.UTC),
+		},
+		{
+			// 01:30 happens twice on 2025-11-02, the first (EDT) instance wins
+			name:  "fall back overlap",
+			day:   time.Date(2025, 11, 2, 0, 0, 0, 0, ny),
+			start: time.Date(2025, 1, 1, 1, 30, 0, 0, ny),
+			want:  time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wallClockTime(tt.day, tt.start)
+			if !got.Equal(tt.want) {
+				t.Errorf("wallClockTime() = %v, want %v", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	ny := mustLocation(t, "America/New_York")
+	utc := time.UTC
+
+	tests := []struct {
+		name  string
+		rule  string
+		loc   *time.Location
+		after time.Time
+		want  []time.Time // successive occurrences, each found after the previous one
+		done  bool        // whether the rule is exhausted after want
+	}{
+		{
+			name:  "daily across spring forward",
+			rule:  "DTSTART;TZID=America/New_York:20250307T023000\nRRULE:FREQ=DAILY",
+			loc:   ny,
+			after: time.Date(2025, 3, 7, 7, 30, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2025, 3, 8, 2, 30, 0, 0, ny),
+				time.Date(2025, 3, 9, 3, 30, 0, 0, ny),
+				time.Date(2025, 3, 10, 2, 30, 0, 0, ny),
+			},
+		},
+		{
+			name:  "daily across fall back",
+			rule:  "DTSTART;TZID=America/New_York:20251101T013000\nRRULE:FREQ=DAILY",
+			loc:   ny,
+			after: time.Date(2025, 11, 1, 5, 30, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2025, 11, 2, 5, 30, 0, 0, utc),
+				time.Date(2025, 11, 3, 6, 30, 0, 0, utc),
+			},
+		},
+		{
+			name:  "monthly on the 31st skips short months",
+			rule:  "DTSTART:20250131T090000Z\nRRULE:FREQ=MONTHLY;BYMONTHDAY=31",
+			loc:   utc,
+			after: time.Date(2025, 1, 31, 9, 0, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2025, 3, 31, 9, 0, 0, 0, utc),
+				time.Date(2025, 5, 31, 9, 0, 0, 0, utc),
+				time.Date(2025, 7, 31, 9, 0, 0, 0, utc),
+				time.Date(2025, 8, 31, 9, 0, 0, 0, utc),
+			},
+		},
+		{
+			name:  "monthly from the 31st without BYMONTHDAY",
+			rule:  "DTSTART:20250131T090000Z\nRRULE:FREQ=MONTHLY",
+			loc:   utc,
+			after: time.Date(2025, 1, 31, 9, 0, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2025, 3, 31, 9, 0, 0, 0, utc),
+				time.Date(2025, 5, 31, 9, 0, 0, 0, utc),
+			},
+		},
+		{
+			name:  "yearly on Feb 29 only in leap years",
+			rule:  "DTSTART:20240229T080000Z\nRRULE:FREQ=YEARLY",
+			loc:   utc,
+			after: time.Date(2024, 2, 29, 8, 0, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2028, 2, 29, 8, 0, 0, 0, utc),
+				time.Date(2032, 2, 29, 8, 0, 0, 0, utc),
+			},
+		},
+		{
+			name:  "yearly on Feb 29 skips 2100",
+			rule:  "DTSTART:20960229T080000Z\nRRULE:FREQ=YEARLY",
+			loc:   utc,
+			after: time.Date(2096, 2, 29, 8, 0, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2104, 2, 29, 8, 0, 0, 0, utc),
+			},
+		},
+		{
+			name:  "COUNT includes DTSTART",
+			rule:  "DTSTART:20250101T090000Z\nRRULE:FREQ=DAILY;COUNT=3",
+			loc:   utc,
+			after: time.Date(2024, 12, 31, 0, 0, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2025, 1, 1, 9, 0, 0, 0, utc),
+				time.Date(2025, 1, 2, 9, 0, 0, 0, utc),
+				time.Date(2025, 1, 3, 9, 0, 0, 0, utc),
+			},
+			done: true,
+		},
+		{
+			name:  "COUNT counts from DTSTART when starting late",
+			rule:  "DTSTART:20250101T090000Z\nRRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4",
+			loc:   utc,
+			after: time.Date(2025, 1, 8, 9, 0, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2025, 1, 13, 9, 0, 0, 0, utc),
+			},
+			done: true,
+		},
+		{
+			name:  "UNTIL is inclusive",
+			rule:  "DTSTART:20250101T090000Z\nRRULE:FREQ=DAILY;UNTIL=20250103T090000Z",
+			loc:   utc,
+			after: time.Date(2025, 1, 1, 9, 0, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2025, 1, 2, 9, 0, 0, 0, utc),
+				time.Date(2025, 1, 3, 9, 0, 0, 0, utc),
+			},
+			done: true,
+		},
+		{
+			name:  "UNTIL as a date covers that whole day",
+			rule:  "DTSTART;TZID=America/New_York:20250101T210000\nRRULE:FREQ=DAILY;UNTIL=20250102",
+			loc:   ny,
+			after: time.Date(2025, 1, 1, 21, 0, 0, 0, ny),
+			want: []time.Time{
+				time.Date(2025, 1, 2, 21, 0, 0, 0, ny),
+			},
+			done: true,
+		},
+		{
+			name:  "every 2 weeks resumes in the right week",
+			rule:  "DTSTART:20250106T090000Z\nRRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			loc:   utc,
+			after: time.Date(2026, 3, 4, 0, 0, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2026, 3, 6, 9, 0, 0, 0, utc),
+				time.Date(2026, 3, 16, 9, 0, 0, 0, utc),
+				time.Date(2026, 3, 20, 9, 0, 0, 0, utc),
+			},
+		},
+		{
+			name:  "far past DTSTART",
+			rule:  "DTSTART:19700101T120000Z\nRRULE:FREQ=DAILY",
+			loc:   utc,
+			after: time.Date(2026, 10, 17, 13, 0, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2026, 10, 18, 12, 0, 0, 0, utc),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRecurrence(tt.rule, tt.loc)
+			if err != nil {
+				t.Fatalf("ParseRecurrence() error = %v", err)
+			}
+			after := tt.after
+			for i, want := range tt.want {
+				got, ok := rule.NextOccurrence(after)
+				if !ok {
+					t.Fatalf("occurrence %d: rule exhausted, want %v", i, want)
+				}
+				if !got.Equal(want) {
+					t.Fatalf("occurrence %d = %v, want %v", i, got, want)
+				}
+				after = got
+			}
+			if got, ok := rule.NextOccurrence(after); ok == tt.done {
+				t.Errorf("after the last occurrence got %v, ok=%v, want exhausted=%v", got, ok, tt.done)
+			}
+		})
+	}
+}
+
+func TestNextOccurrenceNeverMatches(t *testing.T) {
+	// February never has a 31st, so this rule has no occurrence after DTSTART
+	rule, err := ParseRecurrence("DTSTART:20250228T090000Z\nRRULE:FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=31", time.UTC)
+	if err != nil {
+		t.Fatalf("ParseRecurrence() error = %v", err)
+	}
+	if got, ok := rule.NextOccurrence(rule.Start); ok {
+		t.Errorf("NextOccurrence() = %v, want no occurrence", got)
+	}
+}
@@ -0,0 +1,682 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errNoRuleMatch is returned when the rule-based parser finds no time expression in a message
+var errNoRuleMatch = fmt.Errorf("no recognisable date or time in message")
+
+// Default clock times for phrases that name a day or part of the day but no exact time
+var partOfDayHours = map[string]int{
+	"morning":   9,
+	"afternoon": 15,
+	"evening":   18,
+	"night":     20,
+	"tonight":   20,
+}
+
+const defaultReminderHour = 9
+
+var monthNames = map[string]time.Month{
+	"january": time.January, "jan": time.January,
+	"february": time.February, "feb": time.February,
+	"march": time.March, "mar": time.March,
+	"april": time.April, "apr": time.April,
+	"may":  time.May,
+	"june": time.June, "jun": time.June,
+	"july": time.July, "jul": time.July,
+	"august": time.August, "aug": time.August,
+	"september": time.September, "sep": time.September, "sept": time.September,
+	"october": time.October, "oct": time.October,
+	"november": time.November, "nov": time.November,
+	"december": time.December, "dec": time.December,
+}
+
+var weekdayByName = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+const (
+	weekdayPattern = `(?:monday|tuesday|wednesday|thursday|friday|saturday|sunday)`
+	monthPattern   = `(?:january|february|march|april|may|june|july|august|september|october|november|december|jan|feb|mar|apr|jun|jul|aug|sept|sep|oct|nov|dec)`
+)
+
+var (
+	reRelative   = regexp.MustCompile(`(?i)\bin\s+(\d+|an?|half\s+an?)\s*(minutes|minute|mins|min|m|hours|hour|hrs|hr|h|days|day|d|weeks|week|w)\b`)
+	reEvery      = regexp.MustCompile(`(?i)\bevery\s+(?:(other|\d+)\s+)?(days?|weeks?|months?|years?|weekdays?|morning|afternoon|evening|night|` + weekdayPattern + `s?(?:\s*(?:,|and|&)\s*` + weekdayPattern + `s?)*)\b`)
+	reEveryWord  = regexp.MustCompile(`(?i)\b(daily|weekly|monthly|yearly|annually)\b`)
+	reDayMonth   = regexp.MustCompile(`(?i)\b(?:on\s+)?(?:the\s+)?(\d{1,2})(?:st|nd|rd|th)?\s+(?:of\s+)?(` + monthPattern + `)(?:\s+(\d{4}))?\b`)
+	reMonthDay   = regexp.MustCompile(`(?i)\b(?:on\s+)?(` + monthPattern + `)\s+(\d{1,2})(?:st|nd|rd|th)?(?:,?\s+(\d{4}))?\b`)
+	reOrdinalDay = regexp.MustCompile(`(?i)\b(?:on\s+)?(?:the\s+)?(\d{1,2})(?:st|nd|rd|th)\b(?:\s+of\b)?`)
+	reRelDay     = regexp.MustCompile(`(?i)\b(day\s+after\s+tomorrow|tomorrow|today|tonight)\b`)
+	reWeekday    = regexp.MustCompile(`(?i)\b(?:(next|this|on)\s+)?(` + weekdayPattern + `)\b`)
+	reWeekdays   = regexp.MustCompile(weekdayPattern)
+	reAtTime     = regexp.MustCompile(`(?i)\b(?:at|by|@)\s*(\d{1,2})(?::(\d{2}))?\s*(am|pm|a\.m\.|p\.m\.)?(?:\s|$|[.,!?])`)
+	reClockTime  = regexp.MustCompile(`(?i)\b(\d{1,2}):(\d{2})\s*(am|pm|a\.m\.|p\.m\.)?`)
+	reMeridiem   = regexp.MustCompile(`(?i)\b(\d{1,2})\s*(am|pm|a\.m\.|p\.m\.)(?:\s|$|[.,!?])`)
+	reNamedTime  = regexp.MustCompile(`(?i)\b(?:at\s+)?(noon|midday|midnight)\b`)
+	rePartOfDay  = regexp.MustCompile(`(?i)\b(?:in\s+the\s+|this\s+)?(morning|afternoon|evening|night)\b`)
+	reLeadIn     = regexp.MustCompile(`(?i)^(?:hey\s+|please\s+|can\s+you\s+|could\s+you\s+)*(?:remind\s+me\s+(?:to\s+|about\s+|that\s+|of\s+)?|set\s+a\s+reminder\s+(?:to\s+|for\s+)?|reminder\s*:?\s*|remember\s+to\s+|don'?t\s+forget\s+to\s+)`)
+	reDangling   = regexp.MustCompile(`(?i)(?:\s+(?:at|on|by|in|for|to|the|from|and))+$`)
+	reLeadingPre = regexp.MustCompile(`(?i)^(?:(?:at|on|by|in|for|and)\s+)+`)
+	reSpaces     = regexp.MustCompile(`\s+`)
+	reBareTime   = regexp.MustCompile(`(?i)^\s*\d{1,2}(?::\d{2})?\s*(?:am|pm|a\.m\.|p\.m\.)?[.!?]*\s*$`)
+	reAlertAhead = regexp.MustCompile(`(?i)[,;]?\s*(?:and\s+)?(?:(?:also\s+)?(?:remind|alert|notify|ping)\s+me\s+)?((?:(?:\d+|an?|half\s+an?)\s*(?:minutes|minute|mins|min|hours|hour|hrs|hr|days|day|weeks|week)\s*(?:,|and|&)?\s*)+)\s*(?:before(?:hand)?|ahead|in\s+advance)\b`)
+	reAlertPart  = regexp.MustCompile(`(?i)(\d+|an?|half\s+an?)\s*(minutes|minute|mins|min|hours|hour|hrs|hr|days|day|weeks|week)`)
+	reNag        = regexp.MustCompile(`(?i)[,;]?\s*(?:and\s+)?(?:keep\s+(?:on\s+)?reminding\s+me|nag\s+me|remind\s+me\s+again)\s+every\s+(\d+|an?|half\s+an?)?\s*(minutes|minute|mins|min|hours|hour|hrs|hr)\b(?:\s*,?\s*(?:up\s+to|at\s+most|max(?:imum)?)\s+(\d+)\s*(?:times|x)\b)?(?:\s+until\s+(?:i'?m\s+done|i\s+do\s+it|it'?s\s+done|done)\b)?`)
+	reNagOff     = regexp.MustCompile(`(?i)[,;]?\s*(?:and\s+)?(?:stop\s+nagging(?:\s+me)?|don'?t\s+nag\s+me|no\s+nagging)\b`)
+	reNotUrgent  = regexp.MustCompile(`(?i)[,;]?\s*\b(?:(?:it'?s|it\s+is|this\s+is)\s+)?(?:not|no\s+longer)\s+urgent(?:\s+any\s*more)?\b`)
+	reUrgent     = regexp.MustCompile(`(?i)[,;]?\s*\b(?:(?:it'?s|it\s+is|this\s+is|mark\s+(?:it|this)(?:\s+as)?)\s+)?urgent(?:ly)?\b\s*[:!]*`)
+	reSplitTasks = regexp.MustCompile(`(?i)\s*(?:;|,?\s+and\s+(?:then\s+)?|,?\s+then\s+)\s*`)
+)
+
+// RuleParser is a deterministic, offline ReminderParser for common English phrasings such as
+// "in 20 minutes", "tomorrow at 9", "next Friday 6pm", "every Monday at 8" and "on 3 March".
+// It needs no API key and returns errNoRuleMatch for messages it does not understand. Its results
+// are validated like the LLM's, so a date in the past is an error rather than an overdue task.
+// Relative phrases are resolved against the time on clock.
+type RuleParser struct {
+	clock Clock
+}
+
+// NewRuleParser creates a RuleParser that tells the time by clock
+func NewRuleParser(clock Clock) *RuleParser {
+	return &RuleParser{clock: clock}
+}
+
+// whenExpression collects the date and time phrases found in a message
+type whenExpression struct {
+	offset     time.Duration // "in 20 minutes"
+	hasDate    bool
+	year       int // 0 means the next matching date
+	month      time.Month
+	day        int
+	dayOffset  int // today/tomorrow
+	hasDayRel  bool
+	monthDay   int // "on the 1st", any month
+	weekday    time.Weekday
+	hasWeekday bool
+	nextWeek   bool // "next Friday" means the Friday of next week, not the coming one
+	hour       int
+	minute     int
+	hasTime    bool
+	recurrence string
+	byDay      []time.Weekday
+}
+
+func (w *whenExpression) found() bool {
+	return w.offset > 0 || w.hasDate || w.monthDay > 0 || w.hasDayRel || w.hasWeekday || w.hasTime || w.recurrence != ""
+}
+
+// ParseReminder extracts the reminders in the message. A message like "call the bank at 10 and
+// pick up the kids at 3:30" is split into one reminder per part when every part has its own
+// title and time.
+func (p *RuleParser) ParseReminder(ctx context.Context, message string, userTimezone string) (*ParseResult, error) {
+	loc := LoadTimezone(userTimezone)
+	now := p.clock.Now().In(loc)
+
+	// Early alerts like "remind me an hour before", nagging like "keep reminding me every
+	// 10 minutes" and urgency belong to every reminder in the message
+	alerts, message := extractAlerts(message)
+	nagEvery, nagRepeats, message := extractNag(message)
+	_, urgent, message := extractUrgent(message)
+
+	var tasks []ReminderPayload
+	for _, part := range reSplitTasks.Split(message, -1) {
+		// "buy milk at 5 and 6" is two reminders to buy milk, the second at 6
+		bareTime := len(tasks) > 0 && reBareTime.MatchString(part)
+		if bareTime {
+			part = "at " + part
+		}
+		payload, ok := parseRuleReminder(part, message, userTimezone, now)
+		if ok && bareTime {
+			payload.Title = tasks[len(tasks)-1].Title
+		}
+		if !ok || payload.Title == "" {
+			tasks = nil
+			break
+		}
+		tasks = append(tasks, *payload)
+	}
+
+	if len(tasks) < 2 {
+		payload, ok := parseRuleReminder(message, message, userTimezone, now)
+		if !ok {
+			return nil, errNoRuleMatch
+		}
+		if payload.Title == "" {
+			payload.Title = "Reminder"
+		}
+		tasks = []ReminderPayload{*payload}
+	}
+
+	confirmations := make([]string, len(tasks))
+	for i := range tasks {
+		tasks[i].Alerts = alerts
+		tasks[i].NagEvery = nagEvery
+		tasks[i].NagRepeats = nagRepeats
+		tasks[i].Urgent = urgent
+		due, _ := time.ParseInLocation("2006-01-02T15:04:05", tasks[i].Datetime, loc)
+		confirmations[i] = fmt.Sprintf("%s on %s", tasks[i].Title, due.Format("Mon 2 Jan at 15:04"))
+		tasks[i].LLMMessage = "Sure, I'll remind you: " + confirmations[i]
+	}
+
+	result := &ParseResult{
+		Type:       "task",
+		Tasks:      tasks,
+		LLMMessage: "Sure, I'll remind you: " + strings.Join(confirmations, "; "),
+	}
+	if err := ValidateParseResult(result, p.clock.Now()); err != nil {
+		return nil, fmt.Errorf("invalid reminder: %v", err)
+	}
+	return result, nil
+}
+
+// parseRuleReminder builds a reminder from one part of a message. The title is empty if the
+// part has nothing besides the date and time.
+func parseRuleReminder(text, sourceText, userTimezone string, now time.Time) (*ReminderPayload, bool) {
+	when, rest := extractWhen(text)
+	if !when.found() {
+		return nil, false
+	}
+
+	due := when.resolve(now, time.Time{})
+	payload := &ReminderPayload{
+		Type:        "task",
+		Title:       cleanTitle(rest),
+		Description: strings.TrimSpace(text),
+		Datetime:    due.Format("2006-01-02T15:04:05"),
+		Timezone:    userTimezone,
+		SourceText:  sourceText,
+	}
+	if when.recurrence != "" {
+		recurrence := when.recurrence
+		payload.Recurrence = &recurrence
+	}
+	return payload, true
+}
+
+// ParseTaskEdit applies the date and time phrases of a change like "move to Friday" or "make it 6pm"
+// to an existing task, keeping the parts of the due time the change does not mention. Early alerts
+// in the change, e.g. "also remind me an hour before", are added to the task's alerts, and nagging
+// like "keep reminding me every 10 minutes" or "stop nagging me" and urgency replace the task's.
+func (p *RuleParser) ParseTaskEdit(ctx context.Context, task *Task, change string, userTimezone string) (*ReminderPayload, error) {
+	alerts, change := extractAlerts(change)
+	nagEvery, nagRepeats, change := extractNag(change)
+	urgencyFound, urgent, change := extractUrgent(change)
+	when, _ := extractWhen(change)
+	if !when.found() && len(alerts) == 0 && nagEvery == "" && !urgencyFound {
+		return nil, errNoRuleMatch
+	}
+
+	loc := LoadTimezone(task.Timezone)
+	now := p.clock.Now().In(loc)
+	due := task.DueDateTime.In(loc)
+	current := due.Format("2006-01-02T15:04:05")
+	var message string
+	switch {
+	case len(alerts) > 0:
+		message = "Alerts updated"
+	case nagEvery != "":
+		message = "Nagging updated"
+	case urgent:
+		message = "Marked as urgent"
+	default:
+		message = "No longer urgent"
+	}
+	if nagEvery == "" {
+		nagEvery, nagRepeats = formatNagEvery(task.NagEveryMinutes), task.NagRepeats
+	}
+	if !urgencyFound {
+		urgent = task.Urgent
+	}
+	if when.found() {
+		due = when.resolve(now, due)
+		message = fmt.Sprintf("Moved to %s", due.Format("Mon 2 Jan at 15:04"))
+	}
+
+	payload := &ReminderPayload{
+		Type:        "task",
+		Title:       task.Title,
+		Description: task.Description,
+		Datetime:    due.Format("2006-01-02T15:04:05"),
+		Timezone:    task.Timezone,
+		SourceText:  task.SourceText,
+		Alerts:      append(alertList(task.AlertOffsets), alerts...),
+		NagEvery:    nagEvery,
+		NagRepeats:  nagRepeats,
+		Urgent:      urgent,
+		LLMMessage:  message,
+	}
+	switch {
+	case when.recurrence != "":
+		recurrence := when.recurrence
+		payload.Recurrence = &recurrence
+	case task.Recurrence != nil:
+		if rule, err := TaskRecurrence(task); err == nil && rule != nil {
+			rrule := rule.RRule()
+			payload.Recurrence = &rrule
+		}
+	}
+	// Like the LLM's edits, a task may keep a due time that has passed but not move to one
+	if err := validatePayload(payload, p.clock.Now(), payload.Datetime != current); err != nil {
+		return nil, fmt.Errorf("invalid edit: %v", err)
+	}
+	return payload, nil
+}
+
+// extractAlerts finds phrases asking for early alerts, such as "remind me 30 minutes before" or
+// "a day and an hour before", and returns the offsets with the rest of the text
+func extractAlerts(text string) ([]string, string) {
+	var offsets []time.Duration
+	for _, m := range reAlertAhead.FindAllStringSubmatch(text, -1) {
+		for _, part := range reAlertPart.FindAllStringSubmatch(m[1], -1) {
+			if d := relativeDuration(strings.ToLower(part[1]), strings.ToLower(part[2])); d >= time.Minute {
+				offsets = append(offsets, d)
+			}
+		}
+	}
+	if len(offsets) == 0 {
+		return nil, text
+	}
+	return alertList(FormatAlertOffsets(offsets)), reAlertAhead.ReplaceAllString(text, " ")
+}
+
+// extractNag finds a phrase asking to repeat the reminder until it's done, such as "keep reminding me
+// every 10 minutes" or "nag me every hour up to 3 times", or not to, such as "stop nagging me". It
+// returns the interval, "off" or "" if there is no such phrase, the number of repeats and the rest
+// of the text.
+func extractNag(text string) (string, int, string) {
+	if reNagOff.MatchString(text) {
+		return "off", 0, reNagOff.ReplaceAllString(text, " ")
+	}
+	m := reNag.FindStringSubmatch(text)
+	if m == nil {
+		return "", 0, text
+	}
+	amount := strings.ToLower(m[1])
+	if amount == "" {
+		amount = "1"
+	}
+	every := relativeDuration(amount, strings.ToLower(m[2]))
+	if every < time.Minute {
+		return "", 0, text
+	}
+	repeats, _ := strconv.Atoi(m[3])
+	return formatNagEvery(int(every / time.Minute)), repeats, reNag.ReplaceAllString(text, " ")
+}
+
+// extractUrgent finds a phrase marking the reminder as urgent, such as "urgent:" or "it's urgent", or
+// as not urgent. It reports whether there was one, whether it marks the reminder urgent and the rest
+// of the text.
+func extractUrgent(text string) (bool, bool, string) {
+	if reNotUrgent.MatchString(text) {
+		return true, false, reNotUrgent.ReplaceAllString(text, " ")
+	}
+	if reUrgent.MatchString(text) {
+		return true, true, reUrgent.ReplaceAllString(text, " ")
+	}
+	return false, false, text
+}
+
+// extractWhen finds date, time and recurrence phrases and returns them with the rest of the text
+func extractWhen(text string) (whenExpression, string) {
+	var when whenExpression
+
+	// take removes the first match of re from text and returns its submatches
+	take := func(re *regexp.Regexp) []string {
+		loc := re.FindStringSubmatchIndex(text)
+		if loc == nil {
+			return nil
+		}
+		groups := make([]string, len(loc)/2)
+		for i := range groups {
+			if loc[2*i] >= 0 {
+				groups[i] = strings.ToLower(text[loc[2*i]:loc[2*i+1]])
+			}
+		}
+		text = text[:loc[0]] + " " + text[loc[1]:]
+		return groups
+	}
+
+	if m := take(reEvery); m != nil {
+		when.parseEvery(m[1], m[2])
+	} else if m := take(reEveryWord); m != nil {
+		when.recurrence = map[string]string{
+			"daily":    "FREQ=DAILY",
+			"weekly":   "FREQ=WEEKLY",
+			"monthly":  "FREQ=MONTHLY",
+			"yearly":   "FREQ=YEARLY",
+			"annually": "FREQ=YEARLY",
+		}[m[1]]
+	}
+
+	if m := take(reRelative); m != nil {
+		when.offset = relativeDuration(m[1], m[2])
+	}
+
+	if m := take(reDayMonth); m != nil {
+		when.setDate(m[1], m[2], m[3])
+	} else if m := take(reMonthDay); m != nil {
+		when.setDate(m[2], m[1], m[3])
+	} else if m := take(reOrdinalDay); m != nil {
+		if d, err := strconv.Atoi(m[1]); err == nil && d >= 1 && d <= 31 {
+			when.monthDay = d
+		}
+	}
+
+	if m := take(reRelDay); m != nil {
+		when.hasDayRel = true
+		switch {
+		case strings.HasPrefix(m[1], "day"):
+			when.dayOffset = 2
+		case m[1] == "tomorrow":
+			when.dayOffset = 1
+		case m[1] == "tonight":
+			when.hour, when.hasTime = partOfDayHours["tonight"], true
+		}
+	}
+
+	if m := take(reWeekday); m != nil {
+		when.weekday, when.hasWeekday = weekdayByName[m[2]], true
+		when.nextWeek = m[1] == "next"
+	}
+	when.completeRecurrence(func() []string { return take(reWeekday) })
+
+	if m := take(reAtTime); m != nil {
+		when.setTime(m[1], m[2], m[3])
+	} else if m := take(reClockTime); m != nil {
+		when.setTime(m[1], m[2], m[3])
+	} else if m := take(reMeridiem); m != nil {
+		when.setTime(m[1], "", m[2])
+	} else if m := take(reNamedTime); m != nil {
+		when.hour, when.hasTime = 12, true
+		if m[1] == "midnight" {
+			when.hour = 0
+		}
+	}
+
+	if m := take(rePartOfDay); m != nil && !when.hasTime {
+		when.hour, when.hasTime = partOfDayHours[m[1]], true
+	}
+
+	return when, text
+}
+
+// parseEvery turns "every [other|N] <unit or weekdays>" into an RRULE
+func (w *whenExpression) parseEvery(interval, unit string) {
+	rule := []string{}
+	switch {
+	case strings.HasPrefix(unit, "day"):
+		rule = append(rule, "FREQ=DAILY")
+	case strings.HasPrefix(unit, "weekday"):
+		rule = append(rule, "FREQ=WEEKLY", "BYDAY=MO,TU,WE,TH,FR")
+		w.byDay = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	case strings.HasPrefix(unit, "week"):
+		rule = append(rule, "FREQ=WEEKLY")
+	case strings.HasPrefix(unit, "month"):
+		rule = append(rule, "FREQ=MONTHLY")
+	case strings.HasPrefix(unit, "year"):
+		rule = append(rule, "FREQ=YEARLY")
+	case partOfDayHours[unit] != 0:
+		rule = append(rule, "FREQ=DAILY")
+		w.hour, w.hasTime = partOfDayHours[unit], true
+	default:
+		// One or more weekdays, e.g. "monday and wednesday"
+		var codes []string
+		for _, name := range reWeekdays.FindAllString(unit, -1) {
+			wd := weekdayByName[name]
+			w.byDay = append(w.byDay, wd)
+			codes = append(codes, weekdayNames[wd])
+		}
+		rule = append(rule, "FREQ=WEEKLY", "BYDAY="+strings.Join(codes, ","))
+	}
+
+	switch {
+	case interval == "other":
+		rule = append(rule[:1], append([]string{"INTERVAL=2"}, rule[1:]...)...)
+	case interval != "":
+		if n, err := strconv.Atoi(interval); err == nil && n > 1 {
+			rule = append(rule[:1], append([]string{"INTERVAL=" + interval}, rule[1:]...)...)
+		}
+	}
+	w.recurrence = strings.Join(rule, ";")
+}
+
+// completeRecurrence adds the days mentioned next to "every N weeks" or "every month" to the rule,
+// as in "every 2 weeks on friday" or "on the 1st of every month". nextWeekday takes the next
+// weekday phrase from the text.
+func (w *whenExpression) completeRecurrence(nextWeekday func() []string) {
+	switch {
+	case strings.HasPrefix(w.recurrence, "FREQ=WEEKLY") && !strings.Contains(w.recurrence, "BYDAY") && w.hasWeekday:
+		w.byDay = []time.Weekday{w.weekday}
+		for m := nextWeekday(); m != nil; m = nextWeekday() {
+			w.byDay = append(w.byDay, weekdayByName[m[2]])
+		}
+		codes := make([]string, len(w.byDay))
+		for i, wd := range w.byDay {
+			codes[i] = weekdayNames[wd]
+		}
+		w.recurrence += ";BYDAY=" + strings.Join(codes, ",")
+		w.hasWeekday, w.nextWeek = false, false
+	case strings.HasPrefix(w.recurrence, "FREQ=MONTHLY") && w.monthDay > 0:
+		w.recurrence += ";BYMONTHDAY=" + strconv.Itoa(w.monthDay)
+	}
+}
+
+func (w *whenExpression) setDate(day, month, year string) {
+	d, err := strconv.Atoi(day)
+	if err != nil || d < 1 || d > 31 {
+		return
+	}
+	w.hasDate = true
+	w.day = d
+	w.month = monthNames[month]
+	if y, err := strconv.Atoi(year); err == nil {
+		w.year = y
+	}
+}
+
+// setTime sets the clock time. Without am/pm, hours 1-6 are read as afternoon times,
+// since "at 5" rarely means 5 AM.
+func (w *whenExpression) setTime(hour, minute, meridiem string) {
+	h, err := strconv.Atoi(hour)
+	if err != nil || h > 23 {
+		return
+	}
+	m, _ := strconv.Atoi(minute)
+	if m > 59 {
+		return
+	}
+
+	switch strings.ReplaceAll(meridiem, ".", "") {
+	case "am":
+		if h == 12 {
+			h = 0
+		}
+	case "pm":
+		if h < 12 {
+			h += 12
+		}
+	default:
+		if h >= 1 && h <= 6 {
+			h += 12
+		}
+	}
+	w.hour, w.minute, w.hasTime = h, m, true
+}
+
+// resolve computes the due time relative to now (in the user's location). base, if set, is
+// the existing due time of a task being edited, whose date or time is kept when not mentioned.
+func (w *whenExpression) resolve(now, base time.Time) time.Time {
+	loc := now.Location()
+	if w.offset > 0 {
+		return now.Add(w.offset).Truncate(time.Minute)
+	}
+
+	hour, minute := defaultReminderHour, 0
+	if !base.IsZero() {
+		hour, minute = base.Hour(), base.Minute()
+	}
+	if w.hasTime {
+		hour, minute = w.hour, w.minute
+	}
+	at := func(day time.Time) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	switch {
+	case w.hasDate:
+		year := w.year
+		if year == 0 {
+			year = now.Year()
+		}
+		due := at(time.Date(year, w.month, w.day, 0, 0, 0, 0, loc))
+		if w.year == 0 && !due.After(now) {
+			due = at(time.Date(year+1, w.month, w.day, 0, 0, 0, 0, loc))
+		}
+		return due
+	case w.monthDay > 0:
+		// The first such day that is still ahead of now, skipping months without it
+		for i := 0; i <= 12; i++ {
+			first := time.Date(now.Year(), now.Month()+time.Month(i), 1, 0, 0, 0, 0, loc)
+			day := first.AddDate(0, 0, w.monthDay-1)
+			if day.Month() == first.Month() && at(day).After(now) {
+				return at(day)
+			}
+		}
+	case w.hasDayRel:
+		return at(today.AddDate(0, 0, w.dayOffset))
+	case w.hasWeekday || len(w.byDay) > 0:
+		days := w.byDay
+		if w.hasWeekday {
+			days = []time.Weekday{w.weekday}
+		}
+		from := today
+		if w.nextWeek {
+			// Weeks start on Monday, as in recurrence rules
+			from = today.AddDate(0, 0, 7-(int(today.Weekday())+6)%7)
+		}
+		// The first matching day that is still ahead of now
+		for i := 0; i <= 7; i++ {
+			day := from.AddDate(0, 0, i)
+			for _, wd := range days {
+				if day.Weekday() == wd && at(day).After(now) {
+					return at(day)
+				}
+			}
+		}
+	case !base.IsZero() && w.hasTime:
+		// Only the time changes, the task keeps its day
+		return at(base)
+	}
+
+	// A time on its own means the next time the clock shows it
+	due := at(today)
+	if !due.After(now) {
+		due = at(today.AddDate(0, 0, 1))
+	}
+	return due
+}
+
+// relativeDuration converts "20"/"an"/"half an" and a unit into a duration
+func relativeDuration(amount, unit string) time.Duration {
+	var n float64 = 1
+	switch {
+	case strings.HasPrefix(amount, "half"):
+		n = 0.5
+	case amount != "a" && amount != "an":
+		v, err := strconv.Atoi(amount)
+		if err != nil {
+			return 0
+		}
+		n = float64(v)
+	}
+
+	var d time.Duration
+	switch unit[0] {
+	case 'm':
+		d = time.Minute
+	case 'h':
+		d = time.Hour
+	case 'd':
+		d = 24 * time.Hour
+	case 'w':
+		d = 7 * 24 * time.Hour
+	}
+	return time.Duration(n * float64(d))
+}
+
+// cleanTitle strips reminder lead-ins and leftover prepositions from what remains of a message
+func cleanTitle(text string) string {
+	text = reSpaces.ReplaceAllString(text, " ")
+	text = strings.Trim(text, " .,!?;:-")
+	text = reLeadIn.ReplaceAllString(text, "")
+	for {
+		trimmed := strings.Trim(reLeadingPre.ReplaceAllString(reDangling.ReplaceAllString(text, ""), ""), " .,!?;:-")
+		if trimmed == text {
+			break
+		}
+		text = trimmed
+	}
+	if text == "" {
+		return ""
+	}
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+// fallbackParser combines the rule-based parser with an LLM-backed one. With rulesFirst, simple
+// messages are handled locally and only the rest go to the LLM; otherwise the LLM is asked first
+// and the rules are used when it fails (outage, quota, bad JSON).
+type fallbackParser struct {
+	rules      *RuleParser
+	llm        ReminderParser
+	rulesFirst bool
+}
+
+// ParseReminder parses a message with both parsers in the configured order
+func (p *fallbackParser) ParseReminder(ctx context.Context, message string, userTimezone string) (*ParseResult, error) {
+	if p.rulesFirst {
+		if result, err := p.rules.ParseReminder(ctx, message, userTimezone); err == nil {
+			return result, nil
+		}
+		return p.llm.ParseReminder(ctx, message, userTimezone)
+	}
+
+	result, err := p.llm.ParseReminder(ctx, message, userTimezone)
+	if err == nil {
+		return result, nil
+	}
+	log.Printf("LLM failed to parse reminder, trying rules: %v", err)
+	if fallback, ruleErr := p.rules.ParseReminder(ctx, message, userTimezone); ruleErr == nil {
+		return fallback, nil
+	}
+	return nil, err
+}
+
+// ParseTaskEdit asks the LLM first, since edits are free-form, and falls back to the rules
+func (p *fallbackParser) ParseTaskEdit(ctx context.Context, task *Task, change string, userTimezone string) (*ReminderPayload, error) {
+	payload, err := p.llm.ParseTaskEdit(ctx, task, change, userTimezone)
+	if err == nil {
+		return payload, nil
+	}
+	log.Printf("LLM failed to parse edit, trying rules: %v", err)
+	if fallback, ruleErr := p.rules.ParseTaskEdit(ctx, task, change, userTimezone); ruleErr == nil {
+		return fallback, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// ruleReminder is the part of a parsed reminder the rule parser tests check
+type ruleReminder struct {
+	title      string
+	due        string // local time, 2006-01-02T15:04:05
+	recurrence string
+}
+
+func TestRuleParserParseReminder(t *testing.T) {
+	// Thursday 15 October 2026, 10:00 in the user's timezone
+	thursday := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		message string
+		want    []ruleReminder
+	}{
+		{"remind me to stretch in 20 minutes", []ruleReminder{{"Stretch", "2026-10-15T10:20:00", ""}}},
+		{"call mom tomorrow at 9", []ruleReminder{{"Call mom", "2026-10-16T09:00:00", ""}}},
+		{"dentist next Friday 6pm", []ruleReminder{{"Dentist", "2026-10-23T18:00:00", ""}}},
+		{"dentist this Friday 6pm", []ruleReminder{{"Dentist", "2026-10-16T18:00:00", ""}}},
+		{"dentist Friday 6pm", []ruleReminder{{"Dentist", "2026-10-16T18:00:00", ""}}},
+		{"standup next Monday at 9:30", []ruleReminder{{"Standup", "2026-10-19T09:30:00", ""}}},
+		{"team lunch next Thursday at noon", []ruleReminder{{"Team lunch", "2026-10-22T12:00:00", ""}}},
+		{"gym every Monday at 8", []ruleReminder{{"Gym", "2026-10-19T08:00:00", "FREQ=WEEKLY;BYDAY=MO"}}},
+		{"water plants every other day", []ruleReminder{{"Water plants", "2026-10-16T09:00:00", "FREQ=DAILY;INTERVAL=2"}}},
+		{"payday every 2 weeks on friday", []ruleReminder{{"Payday", "2026-10-16T09:00:00", "FREQ=WEEKLY;INTERVAL=2;BYDAY=FR"}}},
+		{"swim every week on monday and friday at 7am", []ruleReminder{{"Swim", "2026-10-16T07:00:00", "FREQ=WEEKLY;BYDAY=MO,FR"}}},
+		{"pay rent on the 1st of every month", []ruleReminder{{"Pay rent", "2026-11-01T09:00:00", "FREQ=MONTHLY;BYMONTHDAY=1"}}},
+		{"every month on the 31st check the meter", []ruleReminder{{"Check the meter", "2026-10-31T09:00:00", "FREQ=MONTHLY;BYMONTHDAY=31"}}},
+		{"renew passport on the 20th", []ruleReminder{{"Renew passport", "2026-10-20T09:00:00", ""}}},
+		{"renew passport on the 15th at 9", []ruleReminder{{"Renew passport", "2026-11-15T09:00:00", ""}}},
+		{"mum's birthday on 3 March", []ruleReminder{{"Mum's birthday", "2027-03-03T09:00:00", ""}}},
+		{"submit report on March 3rd 2027 at 5pm", []ruleReminder{{"Submit report", "2027-03-03T17:00:00", ""}}},
+		{"buy milk at 5 and 6", []ruleReminder{{"Buy milk", "2026-10-15T17:00:00", ""}, {"Buy milk", "2026-10-15T18:00:00", ""}}},
+		{"buy milk at 5 and 6pm.", []ruleReminder{{"Buy milk", "2026-10-15T17:00:00", ""}, {"Buy milk", "2026-10-15T18:00:00", ""}}},
+		{"call the bank at 10 and pick up the kids at 3:30", []ruleReminder{{"Call the bank", "2026-10-16T10:00:00", ""}, {"Pick up the kids", "2026-10-15T15:30:00", ""}}},
+		{"call mom and dad at 7", []ruleReminder{{"Call mom and dad", "2026-10-16T07:00:00", ""}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			parser := NewRuleParser(NewFakeClock(thursday))
+			result, err := parser.ParseReminder(context.Background(), tt.message, "UTC")
+			if err != nil {
+				t.Fatalf("ParseReminder() error = %v", err)
+			}
+			if len(result.Tasks) != len(tt.want) {
+				t.Fatalf("got %d reminders %+v, want %d", len(result.Tasks), result.Tasks, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := result.Tasks[i]
+				recurrence := ""
+				if got.Recurrence != nil {
+					recurrence = *got.Recurrence
+				}
+				if got.Title != want.title || got.Datetime != want.due || recurrence != want.recurrence {
+					t.Errorf("reminder %d = {%q %s %q}, want {%q %s %q}", i, got.Title, got.Datetime, recurrence, want.title, want.due, want.recurrence)
+				}
+			}
+		})
+	}
+}
+
+func TestRuleParserNoMatch(t *testing.T) {
+	parser := NewRuleParser(NewFakeClock(time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)))
+	if _, err := parser.ParseReminder(context.Background(), "what's the weather like", "UTC"); !errors.Is(err, errNoRuleMatch) {
+		t.Errorf("ParseReminder() error = %v, want errNoRuleMatch", err)
+	}
+}
+
+func TestRuleParserRejectsPastDates(t *testing.T) {
+	parser := NewRuleParser(NewFakeClock(time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)))
+	if _, err := parser.ParseReminder(context.Background(), "dentist on 3 March 2020", "UTC"); err == nil || errors.Is(err, errNoRuleMatch) {
+		t.Errorf("ParseReminder() error = %v, want the past date rejected", err)
+	}
+
+	task := &Task{Title: "Dentist", DueDateTime: time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC), Timezone: "UTC"}
+	if _, err := parser.ParseTaskEdit(context.Background(), task, "move to 3 March 2020", "UTC"); err == nil || errors.Is(err, errNoRuleMatch) {
+		t.Errorf("ParseTaskEdit() error = %v, want the past date rejected", err)
+	}
+}
+
+func TestRuleParserParseTaskEdit(t *testing.T) {
+	thursday := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	task := &Task{Title: "Dentist", DueDateTime: time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC), Timezone: "UTC"}
+
+	tests := []struct {
+		change string
+		due    string
+	}{
+		{"make it 7pm instead", "2026-10-16T19:00:00"},
+		{"move to next Friday", "2026-10-23T18:00:00"},
+		{"move to Monday", "2026-10-19T18:00:00"},
+		{"move to the 20th", "2026-10-20T18:00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.change, func(t *testing.T) {
+			parser := NewRuleParser(NewFakeClock(thursday))
+			payload, err := parser.ParseTaskEdit(context.Background(), task, tt.change, "UTC")
+			if err != nil {
+				t.Fatalf("ParseTaskEdit() error = %v", err)
+			}
+			if payload.Datetime != tt.due || payload.Title != "Dentist" {
+				t.Errorf("edit = %q at %s, want Dentist at %s", payload.Title, payload.Datetime, tt.due)
+			}
+		})
+	}
+}
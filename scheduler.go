@@ -0,0 +1,491 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Scheduler sends reminders at their due time, the alerts ahead of it and the nags after it. It keeps
+// the pending tasks, alerts and nags in an in-memory queue ordered by due time and sleeps until the earliest one,
+// instead of polling the database. The store returned by Store tells it about every task that is
+// created, edited, snoozed or finished; a periodic reconciliation reloads the queue from the
+// database to pick up anything it missed, such as tasks created by another replica.
+type Scheduler struct {
+	bot    Messenger
+	store  Store
+	clock  Clock
+	config *Config
+
+	mu      sync.Mutex
+	queue   dueQueue
+	entries map[queueKey]*scheduledTask
+	series  map[uint]uint // series ID of every queued task, to unschedule a whole series
+	wake    chan struct{}
+}
+
+// NewScheduler creates a scheduler for the tasks in store that tells the time by clock
+func NewScheduler(bot Messenger, store Store, clock Clock, config *Config) *Scheduler {
+	s := &Scheduler{
+		bot:     bot,
+		clock:   clock,
+		config:  config,
+		entries: make(map[queueKey]*scheduledTask),
+		series:  make(map[uint]uint),
+		wake:    make(chan struct{}, 1),
+	}
+	s.store = &schedulingStore{Store: store, scheduler: s}
+	return s
+}
+
+// Store returns the store that everything else should use, so task changes reach the scheduler
+func (s *Scheduler) Store() Store {
+	return s.store
+}
+
+// Run loads the pending tasks and sends reminders as they become due. Reminders that were missed
+// while the bot was down are sent right away and handled according to the configured missed
+// reminder policy. It returns once ctx is cancelled, after finishing the reminders being sent.
+func (s *Scheduler) Run(ctx context.Context) {
+	log.Printf("Scheduler %s started (missed reminder policy: %s, grace: %s, claim lease: %s, reconciling every %s)",
+		s.config.WorkerID, s.config.MissedReminderPolicy, s.config.MissedReminderGrace, s.config.ClaimLease, s.config.ReconcileInterval)
+
+	s.reconcile()
+	reconcile := s.clock.NewTimer(s.config.ReconcileInterval)
+	defer reconcile.Stop()
+
+	timer := s.clock.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		dueTasks, dueAlerts, dueNags := s.takeDue(s.clock.Now())
+		if dueTasks {
+			checkDueTasks(s.bot, s.store, s.clock, s.config)
+		}
+		if dueAlerts {
+			checkDueAlerts(s.bot, s.store, s.clock, s.config)
+		}
+		if dueNags {
+			checkDueNags(s.bot, s.store, s.clock, s.config)
+		}
+
+		// Sleep until the next task, alert or nag is due, or indefinitely if there is none
+		var due <-chan time.Time
+		if next, ok := s.next(); ok {
+			timer.Reset(next.Sub(s.clock.Now()))
+			due = timer.C()
+		} else {
+			timer.Stop()
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Scheduler stopped")
+			return
+		case <-due:
+		case <-s.wake:
+		case <-reconcile.C():
+			s.reconcile()
+			reconcile.Reset(s.config.ReconcileInterval)
+		}
+	}
+}
+
+// reconcile replaces the queue with the pending tasks, alerts and nags in the database
+func (s *Scheduler) reconcile() {
+	tasks, err := s.store.GetScheduledTasks()
+	if err != nil {
+		log.Printf("Error loading scheduled tasks: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	drift := 0
+	queue := make(dueQueue, 0, len(tasks))
+	scheduled := make(map[queueKey]*scheduledTask, len(tasks))
+	series := make(map[uint]uint, len(tasks))
+	add := func(key queueKey, due time.Time) {
+		if old, ok := s.entries[key]; !ok || !old.due.Equal(due) {
+			drift++
+		}
+		entry := &scheduledTask{queueKey: key, due: due, index: len(queue)}
+		queue = append(queue, entry)
+		scheduled[key] = entry
+	}
+	for _, task := range tasks {
+		series[task.ID] = task.SeriesKey()
+		if task.ReminderSentAt != nil {
+			add(queueKey{taskID: task.ID, nag: true}, *task.NextNagAt)
+			continue
+		}
+		add(queueKey{taskID: task.ID}, task.NextAttemptAt())
+		for _, alert := range task.Alerts {
+			if alert.SentAt == nil && alert.FailedAt == nil {
+				add(queueKey{taskID: task.ID, alertID: alert.ID}, alert.NextAttemptAt())
+			}
+		}
+	}
+	heap.Init(&queue)
+	s.queue, s.entries, s.series = queue, scheduled, series
+
+	if drift > 0 {
+		log.Printf("Scheduler reconciled %d pending %s, %d new or moved", len(tasks), pluralize(len(tasks), "task", "tasks"), drift)
+	}
+	s.notify()
+}
+
+// schedule queues a task at its due time or next retry together with its unsent alerts, which must
+// be loaded, or at its next nag once the reminder was sent. It removes the task if it no longer
+// needs a reminder.
+func (s *Scheduler) schedule(task *Task) {
+	if task.Status != "pending" || !task.IsActive || task.ReminderSentAt != nil && task.NextNagAt == nil {
+		s.unschedule(task.ID)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.series[task.ID] = task.SeriesKey()
+	keep := make(map[queueKey]bool)
+	if task.ReminderSentAt != nil {
+		key := queueKey{taskID: task.ID, nag: true}
+		keep[key] = true
+		s.put(key, *task.NextNagAt)
+	} else {
+		keep[queueKey{taskID: task.ID}] = true
+		s.put(queueKey{taskID: task.ID}, task.NextAttemptAt())
+		for _, alert := range task.Alerts {
+			if alert.SentAt == nil && alert.FailedAt == nil {
+				key := queueKey{taskID: task.ID, alertID: alert.ID}
+				keep[key] = true
+				s.put(key, alert.NextAttemptAt())
+			}
+		}
+	}
+	// Drop the alerts that were replaced by an edit or snooze, and the nag of a snoozed reminder
+	for key, entry := range s.entries {
+		if key.taskID == task.ID && !keep[key] {
+			heap.Remove(&s.queue, entry.index)
+			delete(s.entries, key)
+		}
+	}
+	s.notify()
+}
+
+// scheduleAt queues a task's reminder, one of its alerts or its next nag, or moves it in the queue, to be sent at due
+func (s *Scheduler) scheduleAt(key queueKey, due time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.put(key, due)
+	s.notify()
+}
+
+// put adds an entry to the queue or moves it; the caller holds s.mu
+func (s *Scheduler) put(key queueKey, due time.Time) {
+	if entry, ok := s.entries[key]; ok {
+		entry.due = due
+		heap.Fix(&s.queue, entry.index)
+	} else {
+		entry := &scheduledTask{queueKey: key, due: due}
+		heap.Push(&s.queue, entry)
+		s.entries[key] = entry
+	}
+}
+
+// unschedule removes a task with its alerts and nag from the queue
+func (s *Scheduler) unschedule(taskID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.remove(func(id uint) bool { return id == taskID }) {
+		s.notify()
+	}
+}
+
+// unscheduleSeries removes every task of a recurring series from the queue
+func (s *Scheduler) unscheduleSeries(seriesID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.remove(func(id uint) bool { return s.series[id] == seriesID }) {
+		s.notify()
+	}
+}
+
+// remove drops the entries of the tasks that match from the queue and reports whether there
+// were any; the caller holds s.mu
+func (s *Scheduler) remove(match func(taskID uint) bool) bool {
+	removed := false
+	for key, entry := range s.entries {
+		if match(key.taskID) {
+			heap.Remove(&s.queue, entry.index)
+			delete(s.entries, key)
+			removed = true
+		}
+	}
+	for taskID := range s.series {
+		if match(taskID) {
+			delete(s.series, taskID)
+		}
+	}
+	return removed
+}
+
+// takeDue removes the entries due by now from the queue and reports whether there were reminders,
+// alerts and nags among them. These are claimed from the database, which stays the source of
+// truth; one that can't be claimed right now, e.g. because another replica holds it, is picked up
+// again by the next reconciliation.
+func (s *Scheduler) takeDue(now time.Time) (tasks, alerts, nags bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.queue) > 0 && !s.queue[0].due.After(now) {
+		entry := heap.Pop(&s.queue).(*scheduledTask)
+		delete(s.entries, entry.queueKey)
+		switch {
+		case entry.alertID != 0:
+			alerts = true
+		case entry.nag:
+			nags = true
+		default:
+			tasks = true
+		}
+	}
+	return tasks, alerts, nags
+}
+
+// next returns the due time of the earliest queued entry
+func (s *Scheduler) next() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return time.Time{}, false
+	}
+	return s.queue[0].due, true
+}
+
+// notify wakes Run so it recomputes how long to sleep
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// queueKey identifies an entry of the scheduler's queue: a task's reminder, one of its alerts, or
+// the next time its reminder is sent again
+type queueKey struct {
+	taskID  uint
+	alertID uint // 0 for the reminder at the due time
+	nag     bool
+}
+
+// scheduledTask is a reminder, alert or nag waiting in the scheduler's queue
+type scheduledTask struct {
+	queueKey
+	due   time.Time
+	index int // position in the heap, maintained by dueQueue
+}
+
+// dueQueue is a min-heap of scheduled reminders, alerts and nags ordered by due time, for container/heap
+type dueQueue []*scheduledTask
+
+func (q dueQueue) Len() int { return len(q) }
+
+func (q dueQueue) Less(i, j int) bool {
+	if !q[i].due.Equal(q[j].due) {
+		return q[i].due.Before(q[j].due)
+	}
+	if q[i].taskID != q[j].taskID {
+		return q[i].taskID < q[j].taskID
+	}
+	if q[i].alertID != q[j].alertID {
+		return q[i].alertID < q[j].alertID
+	}
+	return !q[i].nag && q[j].nag
+}
+
+func (q dueQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *dueQueue) Push(x any) {
+	entry := x.(*scheduledTask)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *dueQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// schedulingStore is a Store that keeps the scheduler's queue in step with the database
+type schedulingStore struct {
+	Store
+	scheduler *Scheduler
+}
+
+func (s *schedulingStore) CreateTask(userID uint, payload *ReminderPayload) (*Task, error) {
+	task, err := s.Store.CreateTask(userID, payload)
+	if err == nil {
+		s.scheduler.schedule(task)
+	}
+	return task, err
+}
+
+func (s *schedulingStore) CreateTasks(userID uint, payloads []ReminderPayload) ([]Task, error) {
+	tasks, err := s.Store.CreateTasks(userID, payloads)
+	for i := range tasks {
+		s.scheduler.schedule(&tasks[i])
+	}
+	return tasks, err
+}
+
+func (s *schedulingStore) UpdateTaskFromPayload(task *Task, payload *ReminderPayload) error {
+	if err := s.Store.UpdateTaskFromPayload(task, payload); err != nil {
+		return err
+	}
+	if updated, err := s.Store.GetUserTask(task.UserID, task.ID); err == nil {
+		s.scheduler.schedule(updated)
+	} else {
+		log.Printf("Error reloading edited task %d for the scheduler: %v", task.ID, err)
+	}
+	return nil
+}
+
+func (s *schedulingStore) SnoozeTask(task *Task, until time.Time) error {
+	if err := s.Store.SnoozeTask(task, until); err != nil {
+		return err
+	}
+	if snoozed, err := s.Store.GetUserTask(task.UserID, task.ID); err == nil {
+		s.scheduler.schedule(snoozed)
+	} else {
+		log.Printf("Error reloading snoozed task %d for the scheduler: %v", task.ID, err)
+	}
+	return nil
+}
+
+func (s *schedulingStore) ScheduleNextOccurrence(task *Task) (*Task, error) {
+	next, err := s.Store.ScheduleNextOccurrence(task)
+	if err == nil && next != nil {
+		s.scheduler.schedule(next)
+	}
+	return next, err
+}
+
+func (s *schedulingStore) MarkTaskAsCompleted(taskID uint) error {
+	return s.unscheduleAfter(taskID, s.Store.MarkTaskAsCompleted(taskID))
+}
+
+func (s *schedulingStore) MarkTaskMissed(taskID uint) error {
+	return s.unscheduleAfter(taskID, s.Store.MarkTaskMissed(taskID))
+}
+
+func (s *schedulingStore) CancelTask(taskID uint) error {
+	return s.unscheduleAfter(taskID, s.Store.CancelTask(taskID))
+}
+
+func (s *schedulingStore) DeleteTask(taskID uint) error {
+	return s.unscheduleAfter(taskID, s.Store.DeleteTask(taskID))
+}
+
+func (s *schedulingStore) CancelTaskSeries(seriesID uint) (int64, error) {
+	count, err := s.Store.CancelTaskSeries(seriesID)
+	if err == nil {
+		s.scheduler.unscheduleSeries(seriesID)
+	}
+	return count, err
+}
+
+func (s *schedulingStore) DeleteTaskSeries(seriesID uint) (int64, error) {
+	count, err := s.Store.DeleteTaskSeries(seriesID)
+	if err == nil {
+		s.scheduler.unscheduleSeries(seriesID)
+	}
+	return count, err
+}
+
+func (s *schedulingStore) RecordDeliveryFailure(taskID uint, workerID string, attempt *DeliveryAttempt) error {
+	if err := s.Store.RecordDeliveryFailure(taskID, workerID, attempt); err != nil {
+		return err
+	}
+	if attempt.NextRetryAt != nil {
+		s.scheduler.scheduleAt(queueKey{taskID: taskID}, *attempt.NextRetryAt)
+	}
+	return nil
+}
+
+func (s *schedulingStore) MarkTaskReminderSent(taskID uint, workerID string, nextNagAt *time.Time) error {
+	if err := s.Store.MarkTaskReminderSent(taskID, workerID, nextNagAt); err != nil {
+		return err
+	}
+	if nextNagAt != nil {
+		s.scheduler.scheduleAt(queueKey{taskID: taskID, nag: true}, *nextNagAt)
+	}
+	return nil
+}
+
+func (s *schedulingStore) RecordTaskNag(taskID uint, workerID string, sent bool, nextNagAt *time.Time) error {
+	if err := s.Store.RecordTaskNag(taskID, workerID, sent, nextNagAt); err != nil {
+		return err
+	}
+	if nextNagAt != nil {
+		s.scheduler.scheduleAt(queueKey{taskID: taskID, nag: true}, *nextNagAt)
+	}
+	return nil
+}
+
+func (s *schedulingStore) DeferTaskReminder(task *Task, workerID string, until time.Time) error {
+	if err := s.Store.DeferTaskReminder(task, workerID, until); err != nil {
+		return err
+	}
+	s.scheduler.scheduleAt(queueKey{taskID: task.ID, nag: task.ReminderSentAt != nil}, until)
+	return nil
+}
+
+func (s *schedulingStore) ResumeDeferredReminders(userID uint) ([]uint, error) {
+	taskIDs, err := s.Store.ResumeDeferredReminders(userID)
+	for _, taskID := range taskIDs {
+		s.scheduler.scheduleAt(queueKey{taskID: taskID}, s.scheduler.clock.Now())
+	}
+	return taskIDs, err
+}
+
+func (s *schedulingStore) RecordAlertFailure(alert *TaskAlert, workerID string) error {
+	if err := s.Store.RecordAlertFailure(alert, workerID); err != nil {
+		return err
+	}
+	if alert.NextRetryAt != nil {
+		s.scheduler.scheduleAt(queueKey{taskID: alert.TaskID, alertID: alert.ID}, *alert.NextRetryAt)
+	}
+	return nil
+}
+
+func (s *schedulingStore) ReplayTask(taskID uint) error {
+	if err := s.Store.ReplayTask(taskID); err != nil {
+		return err
+	}
+	s.scheduler.scheduleAt(queueKey{taskID: taskID}, s.scheduler.clock.Now())
+	return nil
+}
+
+// unscheduleAfter removes a task from the queue if the store call that finished it succeeded
+func (s *schedulingStore) unscheduleAfter(taskID uint, err error) error {
+	if err == nil {
+		s.scheduler.unschedule(taskID)
+	}
+	return err
+}
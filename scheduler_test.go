@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestScheduler wires a scheduler to a fake Telegram server, a memory store and a fake clock
+// set to testStart. Reconciliation is left to the test, so the queue only changes through the
+// scheduler's store.
+func newTestScheduler(t *testing.T) (*Scheduler, *FakeTelegram, Store, *FakeClock) {
+	t.Helper()
+	clock := NewFakeClock(testStart)
+	fake := NewFakeTelegram(clock)
+	t.Cleanup(fake.Close)
+	bot, err := fake.NewBot()
+	if err != nil {
+		t.Fatalf("failed to create bot: %v", err)
+	}
+	config := &Config{
+		MissedReminderPolicy: MissedPolicyDeliver,
+		MissedReminderGrace:  time.Hour,
+		WorkerID:             testWorker,
+		ClaimLease:           2 * time.Minute,
+		ReconcileInterval:    365 * 24 * time.Hour,
+		MaxDeliveryAttempts:  3,
+	}
+	scheduler := NewScheduler(bot, NewMemoryStore(clock), clock, config)
+	return scheduler, fake, scheduler.Store(), clock
+}
+
+// runScheduler runs the scheduler until the returned function is called or the test ends. That
+// function returns once the scheduler has stopped, so whatever it was sending has been sent.
+func runScheduler(t *testing.T, scheduler *Scheduler) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scheduler.Run(ctx)
+	}()
+	stop = sync.OnceFunc(func() {
+		cancel()
+		wg.Wait()
+	})
+	t.Cleanup(stop)
+	return stop
+}
+
+// queuedTasks returns the IDs of the tasks with anything in the scheduler's queue, in ascending order
+func queuedTasks(scheduler *Scheduler) []uint {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	var ids []uint
+	for key := range scheduler.entries {
+		ids = append(ids, key.taskID)
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+func TestSchedulerUnschedulesCancelledSeries(t *testing.T) {
+	for _, action := range []string{"cancel", "delete"} {
+		t.Run(action, func(t *testing.T) {
+			scheduler, fake, store, clock := newTestScheduler(t)
+			daily := "FREQ=DAILY"
+			first := newStoreTask(t, store, ReminderPayload{Title: "Stretch", Datetime: "2026-10-17T09:00:00", Recurrence: &daily, Alerts: []string{"30m"}})
+			second, err := store.ScheduleNextOccurrence(first)
+			if err != nil || second == nil {
+				t.Fatalf("ScheduleNextOccurrence() = %v, %v", second, err)
+			}
+			other := newStoreTask(t, store, ReminderPayload{Title: "Water plants", Datetime: "2026-10-17T09:00:00"})
+
+			var count int64
+			if action == "cancel" {
+				count, err = store.CancelTaskSeries(first.ID)
+			} else {
+				count, err = store.DeleteTaskSeries(first.ID)
+			}
+			if err != nil || count != 2 {
+				t.Fatalf("%s series = %d, %v, want 2 tasks", action, count, err)
+			}
+			if got, want := queuedTasks(scheduler), []uint{other.ID}; fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("queued tasks = %v after the series %s, want %v", got, action, want)
+			}
+
+			// Neither occurrence nor its alert is ever sent, while the other task still is
+			stop := runScheduler(t, scheduler)
+			clock.Advance(2 * 24 * time.Hour)
+			if _, err := fake.WaitForCalls("sendMessage", 1, 5*time.Second); err != nil {
+				t.Fatalf("the other task wasn't delivered: %v", err)
+			}
+			stop()
+			calls := fake.Calls("sendMessage")
+			if len(calls) != 1 || !strings.Contains(calls[0].Params["text"], "Water plants") {
+				t.Errorf("sent %d messages, want only the reminder for 'Water plants'", len(calls))
+				for _, call := range calls {
+					t.Logf("sent %q", call.Params["text"])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// JSONSchema is the subset of JSON Schema used to constrain model responses
+type JSONSchema struct {
+	Type        string                 `json:"type"`
+	Description string                 `json:"description,omitempty"`
+	Enum        []string               `json:"enum,omitempty"`
+	Properties  map[string]*JSONSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+	Items       *JSONSchema            `json:"items,omitempty"`
+	Nullable    bool                   `json:"-"`
+
+	// order keeps properties in struct field order, which models tend to follow
+	order []string
+}
+
+// SchemaFor derives a JSON schema from a struct type using its json, desc and enum tags.
+// Fields without omitempty are required; pointer fields are nullable.
+func SchemaFor(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: SchemaFor(t.Elem())}
+	case reflect.Struct:
+		schema := &JSONSchema{Type: "object", Properties: map[string]*JSONSchema{}}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			prop := SchemaFor(field.Type)
+			prop.Description = field.Tag.Get("desc")
+			prop.Nullable = field.Type.Kind() == reflect.Pointer
+			if enum := field.Tag.Get("enum"); enum != "" {
+				prop.Enum = strings.Split(enum, ",")
+			}
+
+			schema.Properties[name] = prop
+			schema.order = append(schema.order, name)
+			if !strings.Contains(opts, "omitempty") {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema
+	default:
+		return &JSONSchema{Type: "string"}
+	}
+}
+
+// openAIMap renders the schema for OpenAI-compatible APIs, where nullable types are
+// written as a ["type", "null"] union
+func (s *JSONSchema) openAIMap() map[string]any {
+	m := map[string]any{"type": s.Type}
+	if s.Nullable {
+		m["type"] = []string{s.Type, "null"}
+	}
+	if s.Description != "" {
+		m["description"] = s.Description
+	}
+	if len(s.Enum) > 0 {
+		m["enum"] = s.Enum
+	}
+	if len(s.Properties) > 0 {
+		props := map[string]any{}
+		for name, prop := range s.Properties {
+			props[name] = prop.openAIMap()
+		}
+		m["properties"] = props
+	}
+	if len(s.Required) > 0 {
+		m["required"] = s.Required
+	}
+	if s.Items != nil {
+		m["items"] = s.Items.openAIMap()
+	}
+	return m
+}
+
+// genaiSchema converts the schema into the Gemini API's schema type
+func (s *JSONSchema) genaiSchema() *genai.Schema {
+	schema := &genai.Schema{
+		Type:             genai.Type(strings.ToUpper(s.Type)),
+		Description:      s.Description,
+		Enum:             s.Enum,
+		Required:         s.Required,
+		PropertyOrdering: s.order,
+	}
+	if s.Nullable {
+		schema.Nullable = genai.Ptr(true)
+	}
+	if len(s.Properties) > 0 {
+		schema.Properties = map[string]*genai.Schema{}
+		for name, prop := range s.Properties {
+			schema.Properties[name] = prop.genaiSchema()
+		}
+	}
+	if s.Items != nil {
+		schema.Items = s.Items.genaiSchema()
+	}
+	return schema
+}
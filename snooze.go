@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// reminderKeyboard builds the inline keyboard attached to a delivered reminder
+func reminderKeyboard(taskID uint) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Done", NewCallbackData("task", taskID, "done")),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💤 10m", NewCallbackData("task", taskID, "snooze", "10m")),
+			tgbotapi.NewInlineKeyboardButtonData("💤 1h", NewCallbackData("task", taskID, "snooze", "1h")),
+			tgbotapi.NewInlineKeyboardButtonData("🌅 Tomorrow", NewCallbackData("task", taskID, "snooze", "tomorrow")),
+			tgbotapi.NewInlineKeyboardButtonData("✏️ Custom", NewCallbackData("task", taskID, "snooze", "custom")),
+		),
+	)
+}
+
+// handleSnoozeCallback handles the snooze buttons of a delivered reminder
+func (d *Dispatcher) handleSnoozeCallback(ctx *CallbackContext, task *Task) CallbackResult {
+	if len(ctx.Data.Args) != 1 {
+		return CallbackResult{Answer: "Unknown snooze option"}
+	}
+
+	if ctx.Data.Args[0] == "custom" {
+		chatID := ctx.Query.Message.Chat.ID
+		msg := tgbotapi.NewMessage(chatID,
+			fmt.Sprintf("⏳ How long should I snooze '%s'? Reply with a duration like 30m, 2h or 1d.", task.Title))
+		msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true, Selective: true}
+		sent, err := ctx.Bot.Send(msg)
+		if err != nil {
+			log.Printf("Error sending custom snooze prompt: %v", err)
+			return CallbackResult{Answer: "❌ Failed to ask for a snooze duration"}
+		}
+		d.snoozePrompts.Set(chatID, snoozePrompt{TaskID: task.ID, MessageID: sent.MessageID})
+		return CallbackResult{}
+	}
+
+	until, err := snoozeUntil(task, ctx.User.Timezone, ctx.Data.Args[0], ctx.Clock.Now())
+	if err != nil {
+		return CallbackResult{Answer: "Unknown snooze option"}
+	}
+	if err := ctx.Store.SnoozeTask(task, until); err != nil {
+		log.Printf("Error snoozing task %d: %v", task.ID, err)
+		return CallbackResult{Answer: "❌ Failed to snooze the reminder"}
+	}
+	return CallbackResult{Answer: "💤 Snoozed", EditText: snoozedText(task, until, ctx.User.Timezone)}
+}
+
+// snoozePrompt is a custom snooze waiting for the user to reply with a duration
+type snoozePrompt struct {
+	TaskID    uint
+	MessageID int // the ForceReply prompt the duration has to reply to
+}
+
+// handleCustomSnoozeReply applies a duration typed in reply to a custom snooze prompt.
+// It returns false when the message doesn't reply to the chat's pending prompt or isn't a
+// duration, so it is handled like any other message.
+func (d *Dispatcher) handleCustomSnoozeReply(user *User, message *tgbotapi.Message, text string) (string, bool) {
+	chatID := message.Chat.ID
+	prompt, ok := d.snoozePrompts.Get(chatID)
+	if !ok || message.ReplyToMessage == nil || message.ReplyToMessage.MessageID != prompt.MessageID {
+		return "", false
+	}
+	duration, err := parseSnoozeDuration(text)
+	if err != nil {
+		return "", false
+	}
+	d.snoozePrompts.Delete(chatID)
+
+	task, err := d.store.GetUserTask(user.ID, prompt.TaskID)
+	if err != nil || task.Status != "pending" {
+		return "❌ That reminder can no longer be snoozed.", true
+	}
+
+	until := d.clock.Now().Add(duration)
+	if err := d.store.SnoozeTask(task, until); err != nil {
+		log.Printf("Error snoozing task %d: %v", task.ID, err)
+		return "❌ Failed to snooze the reminder. Please try again.", true
+	}
+	return snoozedText(task, until, user.Timezone), true
+}
+
+// snoozeUntil resolves a snooze button choice to the new due time
+func snoozeUntil(task *Task, userTimezone, choice string, now time.Time) (time.Time, error) {
+	if choice == "tomorrow" {
+		// Same time of day as the original reminder, on the day after today
+		loc := LoadTimezone(userTimezone)
+		due := task.DueDateTime.In(loc)
+		today := now.In(loc)
+		return time.Date(today.Year(), today.Month(), today.Day()+1,
+			due.Hour(), due.Minute(), 0, 0, loc).UTC(), nil
+	}
+
+	duration, err := parseSnoozeDuration(choice)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(duration).UTC().Truncate(time.Minute), nil
+}
+
+// parseSnoozeDuration parses durations like "10m", "1h30m", "2d", "45" (minutes) or "2 hours"
+func parseSnoozeDuration(text string) (time.Duration, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	text = strings.TrimPrefix(text, "for ")
+
+	if minutes, err := strconv.Atoi(text); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute, nil
+	}
+
+	// "2 hours", "30 mins", "1 day"
+	if fields := strings.Fields(text); len(fields) == 2 {
+		if n, err := strconv.Atoi(fields[0]); err == nil && n > 0 {
+			switch strings.TrimSuffix(fields[1], "s") {
+			case "min", "minute":
+				return time.Duration(n) * time.Minute, nil
+			case "hour", "hr":
+				return time.Duration(n) * time.Hour, nil
+			case "day":
+				return time.Duration(n) * 24 * time.Hour, nil
+			}
+		}
+	}
+
+	if days, ok := strings.CutSuffix(text, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+
+	duration, err := time.ParseDuration(text)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid snooze duration %q", text)
+	}
+	return duration, nil
+}
+
+// snoozedText is the confirmation shown once a reminder has been snoozed
+func snoozedText(task *Task, until time.Time, userTimezone string) string {
+	return fmt.Sprintf("💤 Snoozed '%s' until %s (%s)",
+		task.Title, FormatTaskDateTime(until, userTimezone), userTimezone)
+}
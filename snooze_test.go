@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestParseSnoozeDuration(t *testing.T) {
+	tests := []struct {
+		text string
+		want time.Duration
+	}{
+		{"10m", 10 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"2d", 48 * time.Hour},
+		{"45", 45 * time.Minute},
+		{"2 hours", 2 * time.Hour},
+		{"for 30 mins", 30 * time.Minute},
+		{"1 day", 24 * time.Hour},
+		{"remind me to call mom at 6", 0},
+		{"-5m", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseSnoozeDuration(tt.text)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("parseSnoozeDuration(%q) = %v, want an error", tt.text, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSnoozeDuration(%q) = %v, %v, want %v", tt.text, got, err, tt.want)
+		}
+	}
+}
+
+func TestCustomSnoozeReply(t *testing.T) {
+	d, _, store, _ := newTestDispatcher(t)
+	user, task := newTestTask(t, store, "Call mom", "2026-10-17T09:00:00")
+	d.snoozePrompts.Set(testUserID, snoozePrompt{TaskID: task.ID, MessageID: 7})
+
+	// Only a duration that replies to the prompt snoozes the task; anything else, such as a new
+	// reminder sent while the prompt is pending, is left to the usual handling
+	prompt := &tgbotapi.Message{MessageID: 7}
+	tests := []struct {
+		name    string
+		replyTo *tgbotapi.Message
+		text    string
+		handled bool
+	}{
+		{"new reminder", nil, "remind me to call mom at 6", false},
+		{"duration without replying", nil, "30m", false},
+		{"reply to another message", &tgbotapi.Message{MessageID: 3}, "30m", false},
+		{"reply that isn't a duration", prompt, "whenever", false},
+		{"duration in reply to the prompt", prompt, "30m", true},
+	}
+	for _, tt := range tests {
+		message := &tgbotapi.Message{MessageID: 8, Chat: &tgbotapi.Chat{ID: testUserID}, Text: tt.text, ReplyToMessage: tt.replyTo}
+		if _, handled := d.handleCustomSnoozeReply(user, message, tt.text); handled != tt.handled {
+			t.Errorf("%s: handled = %v, want %v", tt.name, handled, tt.handled)
+		}
+	}
+
+	got, err := store.GetUserTask(user.ID, task.ID)
+	if err != nil {
+		t.Fatalf("failed to load task: %v", err)
+	}
+	if want := time.Date(2026, 10, 17, 8, 30, 0, 0, time.UTC); !got.DueDateTime.Equal(want) {
+		t.Errorf("task is due %v, want it snoozed until %v", got.DueDateTime, want)
+	}
+	if _, ok := d.snoozePrompts.Get(testUserID); ok {
+		t.Errorf("the prompt is still pending after the snooze")
+	}
+}
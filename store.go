@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// errRecordNotFound is returned by stores when a user or task does not exist
+var errRecordNotFound = errors.New("record not found")
+
+// Store persists users, tasks and reminder delivery state. GormStore keeps them in a SQL database;
+// MemoryStore keeps them in memory for tests and local development.
+type Store interface {
+	// GetOrCreateUser retrieves an existing user, updating their profile, or creates a new one
+	GetOrCreateUser(telegramID int64, username, firstName, lastName, languageCode *string) (*User, error)
+	// GetUserByTelegramID retrieves a user by their Telegram ID
+	GetUserByTelegramID(telegramID int64) (*User, error)
+	// UpdateUserTimezone updates the user's timezone
+	UpdateUserTimezone(userID uint, timezone string) error
+	// UpdateUserDefaultAlerts updates the alerts new tasks of the user get by default, see FormatAlertOffsets
+	UpdateUserDefaultAlerts(userID uint, alerts string) error
+	// UpdateUserNagPolicy updates how often and how many times new tasks of the user are resent by
+	// default until they're done; an interval of 0 turns nagging off
+	UpdateUserNagPolicy(userID uint, everyMinutes, repeats int) error
+	// UpdateUserQuietHours updates the user's daily quiet hours, e.g. "22:00" to "07:00" or empty to
+	// turn them off, and what happens to reminders during them, see QuietModeDefer
+	UpdateUserQuietHours(userID uint, start, end, mode string) error
+	// UpdateUserDND turns do not disturb on until the given time, or off if that is nil
+	UpdateUserDND(userID uint, until *time.Time) error
+
+	// CreateTask creates a new task for a user
+	CreateTask(userID uint, payload *ReminderPayload) (*Task, error)
+	// CreateTasks creates several tasks from one message, either all of them or none
+	CreateTasks(userID uint, payloads []ReminderPayload) ([]Task, error)
+	// UpdateTaskFromPayload applies an edited payload to an existing task and reschedules its alerts
+	UpdateTaskFromPayload(task *Task, payload *ReminderPayload) error
+	// GetUserTask retrieves a single task owned by a user, with its user, snooze history and alerts loaded
+	GetUserTask(userID, taskID uint) (*Task, error)
+	// GetUserTasks retrieves all active tasks for a user, soonest first, with their snooze history
+	GetUserTasks(userID uint) ([]Task, error)
+	// MarkTaskAsCompleted marks a task as completed
+	MarkTaskAsCompleted(taskID uint) error
+	// MarkTaskMissed marks a task whose reminder was dropped because it was too far overdue
+	MarkTaskMissed(taskID uint) error
+	// CancelTask cancels a single task and deactivates it
+	CancelTask(taskID uint) error
+	// CancelTaskSeries cancels every pending task of a recurring series and returns how many were cancelled
+	CancelTaskSeries(seriesID uint) (int64, error)
+	// DeleteTask deletes a single task
+	DeleteTask(taskID uint) error
+	// DeleteTaskSeries deletes every task of a recurring series and returns how many were deleted
+	DeleteTaskSeries(seriesID uint) (int64, error)
+	// ScheduleNextOccurrence creates the task for the next occurrence of a recurring series, see nextOccurrenceTask
+	ScheduleNextOccurrence(task *Task) (*Task, error)
+	// SnoozeTask postpones a task, records the snooze, clears its sent marker and nag state and
+	// reschedules its alerts
+	SnoozeTask(task *Task, until time.Time) error
+
+	// RecordTaskMessage remembers that a bot message in a chat belongs to a task
+	RecordTaskMessage(taskID uint, chatID int64, messageID int, kind string) error
+	// FindTasksByMessage returns the tasks of a user that a bot message belongs to
+	FindTasksByMessage(userID uint, chatID int64, messageID int) ([]Task, error)
+
+	// GetScheduledTasks retrieves every pending task whose reminder wasn't sent or that is still
+	// nagging, soonest first, with the alerts that are still to be sent
+	GetScheduledTasks() ([]Task, error)
+	// ClaimDueTasks atomically claims the pending tasks due by dueBy whose reminder wasn't sent, for
+	// workerID until the lease expires, and returns every task the worker holds. Tasks claimed by
+	// another worker are skipped until that worker's lease expires.
+	ClaimDueTasks(workerID string, dueBy time.Time, lease time.Duration) ([]Task, error)
+	// MarkTaskReminderSent marks a claimed task as having its reminder sent, records the successful
+	// delivery attempt and releases the claim. The reminder is sent again at nextNagAt unless that is
+	// nil. It does nothing if the claim was lost, e.g. because the task was snoozed in the meantime.
+	MarkTaskReminderSent(taskID uint, workerID string, nextNagAt *time.Time) error
+	// RecordDeliveryFailure records a failed delivery attempt and releases the claim. The task is
+	// retried at attempt.NextRetryAt, or moves to the failed status if that is nil.
+	RecordDeliveryFailure(taskID uint, workerID string, attempt *DeliveryAttempt) error
+	// DeferTaskReminder holds back a claimed task's reminder, or its next nag once the reminder was
+	// sent, until the user's quiet period ends, without counting a delivery attempt, and releases
+	// the claim. It does nothing if the claim was lost.
+	DeferTaskReminder(task *Task, workerID string, until time.Time) error
+	// ResumeDeferredReminders makes the user's reminders that were held back for a quiet period due
+	// right away, e.g. after do not disturb is turned off early, and returns their IDs. Reminders that
+	// are waiting to be retried after a failed attempt keep their retry time.
+	ResumeDeferredReminders(userID uint) ([]uint, error)
+	// GetFailedTasks retrieves every task whose reminder gave up after failed delivery attempts, newest first
+	GetFailedTasks() ([]Task, error)
+	// GetDeliveryAttempts retrieves the delivery attempts of a task, oldest first
+	GetDeliveryAttempts(taskID uint) ([]DeliveryAttempt, error)
+	// ReplayTask moves a failed task back to pending with a fresh set of attempts, to be sent right away
+	ReplayTask(taskID uint) error
+	// ClaimDueAlerts atomically claims the alerts due by dueBy that weren't sent, of pending tasks
+	// that are still ahead of dueBy, for workerID until the lease expires, and returns every alert
+	// the worker holds with its task and user loaded
+	ClaimDueAlerts(workerID string, dueBy time.Time, lease time.Duration) ([]TaskAlert, error)
+	// MarkAlertSent marks a claimed alert as sent and releases the claim. It does nothing if the
+	// claim was lost.
+	MarkAlertSent(alertID uint, workerID string) error
+	// RecordAlertFailure stores a failed attempt to send a claimed alert and releases the claim. The
+	// alert is retried at alert.NextRetryAt, or given up if that is nil.
+	RecordAlertFailure(alert *TaskAlert, workerID string) error
+
+	// ClaimDueNags atomically claims the pending tasks whose reminder was sent and is due to be sent
+	// again by dueBy, the same way ClaimDueTasks does, and returns every such task the worker holds
+	ClaimDueNags(workerID string, dueBy time.Time, lease time.Duration) ([]Task, error)
+	// RecordTaskNag counts a repeat of a claimed task's reminder and releases the claim. A repeat that
+	// was sent also moves the task's sent marker. The reminder is repeated again at nextNagAt, or no
+	// more if that is nil. It does nothing if the claim was lost.
+	RecordTaskNag(taskID uint, workerID string, sent bool, nextNagAt *time.Time) error
+
+	// GetLastRemindedTask returns the user's pending task whose reminder was sent most recently
+	GetLastRemindedTask(userID uint) (*Task, error)
+
+	// Close releases the store's resources
+	Close() error
+}
+
+// newTaskFromPayload builds an unsaved pending task from a parsed reminder
+func newTaskFromPayload(userID uint, payload *ReminderPayload) (*Task, error) {
+	// Parse the datetime string and convert from user's timezone to UTC
+	dueDateTime, err := ParseTaskDateTime(payload.Datetime, payload.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse datetime: %v", err)
+	}
+
+	recurrence, err := canonicalRecurrence(payload.Recurrence, dueDateTime, payload.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts, err := canonicalAlerts(payload.Alerts)
+	if err != nil {
+		return nil, err
+	}
+
+	nagEvery, nagRepeats, err := nagPolicy(payload.NagEvery, payload.NagRepeats)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Task{
+		UserID:          userID,
+		Title:           payload.Title,
+		Description:     payload.Description,
+		DueDateTime:     dueDateTime,      // Store in UTC
+		Timezone:        payload.Timezone, // Store user's timezone for display
+		Recurrence:      recurrence,
+		SourceText:      payload.SourceText,
+		Status:          "pending",
+		IsActive:        true,
+		AlertOffsets:    alerts,
+		NagEveryMinutes: nagEvery,
+		NagRepeats:      nagRepeats,
+		Urgent:          payload.Urgent,
+	}, nil
+}
+
+// canonicalRecurrence parses a recurrence from the LLM and returns its canonical stored form,
+// anchored at the given first due time, or nil if the task does not repeat
+func canonicalRecurrence(recurrence *string, dueDateTime time.Time, timezone string) (*string, error) {
+	if recurrence == nil || strings.TrimSpace(*recurrence) == "" {
+		return nil, nil
+	}
+	loc := LoadTimezone(timezone)
+	rule, err := ParseRecurrence(*recurrence, loc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse recurrence: %v", err)
+	}
+	rule.Start = dueDateTime.In(loc)
+	canonical := rule.String()
+	return &canonical, nil
+}
+
+// editedRecurrence returns the canonical recurrence of an edited task. A rule the edit leaves
+// alone keeps its DTSTART, so editing one occurrence neither restarts a COUNT series nor moves
+// the series anchor; a new rule starts at the edited due time.
+func editedRecurrence(task *Task, recurrence *string, dueDateTime time.Time, timezone string) (*string, error) {
+	edited, err := canonicalRecurrence(recurrence, dueDateTime, timezone)
+	if err != nil || edited == nil || timezone != task.Timezone {
+		return edited, err
+	}
+	current, err := TaskRecurrence(task)
+	if err != nil || current == nil {
+		return edited, nil
+	}
+	rule, err := ParseRecurrence(*edited, LoadTimezone(timezone))
+	if err != nil || rule.RRule() != current.RRule() {
+		return edited, nil
+	}
+	unchanged := current.String()
+	return &unchanged, nil
+}
+
+// editedTask returns a copy of task with an edited payload applied. If the due time moves into
+// the future, the sent marker and nag state are cleared so the reminder fires again; otherwise a
+// reminder that was sent nags from now on according to the edited policy.
+func editedTask(task *Task, payload *ReminderPayload, now time.Time) (*Task, error) {
+	timezone := payload.Timezone
+	if timezone == "" {
+		timezone = task.Timezone
+	}
+
+	dueDateTime, err := ParseTaskDateTime(payload.Datetime, timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse datetime: %v", err)
+	}
+
+	recurrence, err := editedRecurrence(task, payload.Recurrence, dueDateTime, timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts, err := canonicalAlerts(payload.Alerts)
+	if err != nil {
+		return nil, err
+	}
+
+	nagEvery, nagRepeats, err := nagPolicy(payload.NagEvery, payload.NagRepeats)
+	if err != nil {
+		return nil, err
+	}
+
+	edited := *task
+	edited.AlertOffsets = alerts
+	edited.NagEveryMinutes = nagEvery
+	edited.NagRepeats = nagRepeats
+	edited.Urgent = payload.Urgent
+	edited.Title = payload.Title
+	edited.Description = payload.Description
+	edited.DueDateTime = dueDateTime
+	edited.Timezone = timezone
+	edited.Recurrence = recurrence
+	if dueDateTime.After(now) {
+		edited.ReminderSentAt = nil
+	}
+	if edited.ReminderSentAt == nil {
+		edited.NagCount = 0
+		edited.NextNagAt = nil
+	} else {
+		// A reminder that was already sent starts or stops nagging from now on
+		edited.NextNagAt = nextNagAt(&edited, edited.NagCount, now)
+	}
+	return &edited, nil
+}
+
+// nextOccurrenceTask builds the unsaved task for the next occurrence of a recurring series,
+// computed in the task's own timezone. It returns nil when the task does not repeat or the
+// series has ended.
+func nextOccurrenceTask(task *Task, now time.Time) (*Task, error) {
+	rule, err := TaskRecurrence(task)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse recurrence for task %d: %v", task.ID, err)
+	}
+	if rule == nil {
+		return nil, nil
+	}
+
+	// Occurrences that passed while the bot was down are skipped rather than replayed
+	after := task.DueDateTime
+	if now.After(after) {
+		after = now
+	}
+
+	next, ok := rule.NextOccurrence(after)
+	if !ok {
+		return nil, nil
+	}
+
+	seriesID := task.SeriesKey()
+	recurrence := rule.String()
+	return &Task{
+		UserID:          task.UserID,
+		Title:           task.Title,
+		Description:     task.Description,
+		DueDateTime:     next.UTC(),
+		Timezone:        task.Timezone,
+		Recurrence:      &recurrence,
+		SeriesID:        &seriesID,
+		SourceText:      task.SourceText,
+		Status:          "pending",
+		IsActive:        true,
+		AlertOffsets:    task.AlertOffsets,
+		NagEveryMinutes: task.NagEveryMinutes,
+		NagRepeats:      task.NagRepeats,
+		Urgent:          task.Urgent,
+	}, nil
+}
@@ -0,0 +1,866 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory Store for tests and local development. It is safe for concurrent
+// use, and every method returns copies so callers can't modify the stored records.
+type MemoryStore struct {
+	mu         sync.Mutex
+	users      map[uint]*User
+	tasks      map[uint]*Task
+	snoozes    []TaskSnooze
+	messages   []TaskMessage
+	attempts   []DeliveryAttempt
+	alerts     []TaskAlert
+	nextUserID uint
+	nextTaskID uint
+	nextID     uint // snoozes, messages, delivery attempts and alerts
+	clock      Clock
+}
+
+// NewMemoryStore creates an empty MemoryStore that timestamps records with clock
+func NewMemoryStore(clock Clock) *MemoryStore {
+	return &MemoryStore{
+		clock: clock,
+		users: make(map[uint]*User),
+		tasks: make(map[uint]*Task),
+	}
+}
+
+// GetOrCreateUser retrieves an existing user, updating their profile, or creates a new one
+func (s *MemoryStore) GetOrCreateUser(telegramID int64, username, firstName, lastName, languageCode *string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	if user := s.userByTelegramID(telegramID); user != nil {
+		if username != nil {
+			user.Username = username
+		}
+		if firstName != nil {
+			user.FirstName = firstName
+		}
+		if lastName != nil {
+			user.LastName = lastName
+		}
+		if languageCode != nil {
+			user.LanguageCode = languageCode
+		}
+		user.UpdatedAt = now
+		copied := *user
+		return &copied, nil
+	}
+
+	s.nextUserID++
+	user := &User{
+		ID:           s.nextUserID,
+		TelegramID:   telegramID,
+		Username:     username,
+		FirstName:    firstName,
+		LastName:     lastName,
+		LanguageCode: languageCode,
+		Timezone:     "Asia/Kolkata", // Default timezone
+		QuietMode:    QuietModeDefer,
+		IsActive:     true,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	s.users[user.ID] = user
+
+	log.Printf("Created new user: %d", telegramID)
+	copied := *user
+	return &copied, nil
+}
+
+// GetUserByTelegramID retrieves a user by their Telegram ID
+func (s *MemoryStore) GetUserByTelegramID(telegramID int64) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.userByTelegramID(telegramID)
+	if user == nil {
+		return nil, fmt.Errorf("failed to get user: %v", errRecordNotFound)
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// UpdateUserTimezone updates the user's timezone
+func (s *MemoryStore) UpdateUserTimezone(userID uint, timezone string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("failed to update user timezone: %v", errRecordNotFound)
+	}
+	user.Timezone = timezone
+	user.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+// UpdateUserNagPolicy updates how often and how many times new tasks of the user are resent by default
+func (s *MemoryStore) UpdateUserNagPolicy(userID uint, everyMinutes, repeats int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("failed to update user nag policy: %v", errRecordNotFound)
+	}
+	user.NagEveryMinutes = everyMinutes
+	user.NagRepeats = repeats
+	user.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+// UpdateUserQuietHours updates the user's daily quiet hours and what happens to reminders during them
+func (s *MemoryStore) UpdateUserQuietHours(userID uint, start, end, mode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("failed to update user quiet hours: %v", errRecordNotFound)
+	}
+	user.QuietHoursStart = start
+	user.QuietHoursEnd = end
+	user.QuietMode = mode
+	user.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+// UpdateUserDND turns do not disturb on until the given time, or off if that is nil
+func (s *MemoryStore) UpdateUserDND(userID uint, until *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("failed to update user do not disturb: %v", errRecordNotFound)
+	}
+	user.DNDUntil = until
+	user.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+// UpdateUserDefaultAlerts updates the alerts new tasks of the user get by default
+func (s *MemoryStore) UpdateUserDefaultAlerts(userID uint, alerts string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("failed to update user default alerts: %v", errRecordNotFound)
+	}
+	user.DefaultAlerts = alerts
+	user.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+// CreateTask creates a new task for a user
+func (s *MemoryStore) CreateTask(userID uint, payload *ReminderPayload) (*Task, error) {
+	tasks, err := s.CreateTasks(userID, []ReminderPayload{*payload})
+	if err != nil {
+		return nil, err
+	}
+	return &tasks[0], nil
+}
+
+// CreateTasks creates several tasks from one message, either all of them or none
+func (s *MemoryStore) CreateTasks(userID uint, payloads []ReminderPayload) ([]Task, error) {
+	now := s.clock.Now()
+	tasks := make([]Task, 0, len(payloads))
+	for i := range payloads {
+		task, err := newTaskFromPayload(userID, &payloads[i])
+		if err != nil {
+			return nil, fmt.Errorf("task %d: %v", i+1, err)
+		}
+		task.Alerts = pendingTaskAlerts(task, now, nil)
+		tasks = append(tasks, *task)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range tasks {
+		s.insertTask(&tasks[i])
+	}
+	return tasks, nil
+}
+
+// UpdateTaskFromPayload applies an edited payload to an existing task. If the due time moves
+// into the future, the sent marker is cleared so the reminder fires again.
+func (s *MemoryStore) UpdateTaskFromPayload(task *Task, payload *ReminderPayload) error {
+	now := s.clock.Now()
+	edited, err := editedTask(task, payload, now)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.tasks[task.ID]
+	if !ok {
+		return fmt.Errorf("failed to update task: %v", errRecordNotFound)
+	}
+	stored.Title = edited.Title
+	stored.Description = edited.Description
+	stored.DueDateTime = edited.DueDateTime
+	stored.Timezone = edited.Timezone
+	stored.Recurrence = edited.Recurrence
+	stored.AlertOffsets = edited.AlertOffsets
+	stored.NagEveryMinutes = edited.NagEveryMinutes
+	stored.NagRepeats = edited.NagRepeats
+	stored.NagCount = edited.NagCount
+	stored.NextNagAt = edited.NextNagAt
+	stored.Urgent = edited.Urgent
+	if edited.ReminderSentAt == nil {
+		stored.ReminderSentAt = nil
+		stored.ClaimedBy = nil
+		stored.ClaimExpiresAt = nil
+		stored.DeliveryAttempts = 0
+		stored.NextRetryAt = nil
+	}
+	stored.UpdatedAt = s.clock.Now()
+	s.replaceTaskAlerts(stored, now)
+	return nil
+}
+
+// GetUserTask retrieves a single task owned by a user, with its user, snooze history and alerts loaded
+func (s *MemoryStore) GetUserTask(userID, taskID uint) (*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[taskID]
+	if !ok || task.UserID != userID {
+		return nil, fmt.Errorf("failed to get task: %v", errRecordNotFound)
+	}
+	return s.loadTask(task, true, true), nil
+}
+
+// GetUserTasks retrieves all active tasks for a user, soonest first, with their snooze history
+func (s *MemoryStore) GetUserTasks(userID uint) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.findTasks(func(t *Task) bool { return t.UserID == userID && t.IsActive }, false, true), nil
+}
+
+// MarkTaskAsCompleted marks a task as completed
+func (s *MemoryStore) MarkTaskAsCompleted(taskID uint) error {
+	return s.updateTask(taskID, func(t *Task) { t.Status = "completed" })
+}
+
+// MarkTaskMissed marks a task whose reminder was dropped because it was too far overdue
+func (s *MemoryStore) MarkTaskMissed(taskID uint) error {
+	return s.updateTask(taskID, func(t *Task) {
+		t.Status = "missed"
+		t.ClaimedBy = nil
+		t.ClaimExpiresAt = nil
+	})
+}
+
+// CancelTask cancels a single task and deactivates it
+func (s *MemoryStore) CancelTask(taskID uint) error {
+	return s.updateTask(taskID, func(t *Task) {
+		t.Status = "cancelled"
+		t.IsActive = false
+	})
+}
+
+// CancelTaskSeries cancels every pending task of a recurring series and returns how many were cancelled
+func (s *MemoryStore) CancelTaskSeries(seriesID uint) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	for _, task := range s.tasks {
+		if task.SeriesKey() == seriesID && task.Status == "pending" {
+			task.Status = "cancelled"
+			task.IsActive = false
+			task.UpdatedAt = s.clock.Now()
+			count++
+		}
+	}
+	return count, nil
+}
+
+// DeleteTask deletes a single task
+func (s *MemoryStore) DeleteTask(taskID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tasks, taskID)
+	return nil
+}
+
+// DeleteTaskSeries deletes every task of a recurring series and returns how many were deleted
+func (s *MemoryStore) DeleteTaskSeries(seriesID uint) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	for id, task := range s.tasks {
+		if task.SeriesKey() == seriesID {
+			delete(s.tasks, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ScheduleNextOccurrence creates the task for the next occurrence of a recurring series,
+// computed in the task's own timezone. It returns nil when the task does not repeat or the
+// series has ended, and is safe to call more than once for the same occurrence.
+func (s *MemoryStore) ScheduleNextOccurrence(task *Task) (*Task, error) {
+	nextTask, err := nextOccurrenceTask(task, s.clock.Now())
+	if err != nil || nextTask == nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Skip if this occurrence was already scheduled
+	seriesID := *nextTask.SeriesID
+	existing := s.findTasks(func(t *Task) bool {
+		return t.SeriesKey() == seriesID && t.DueDateTime.Equal(nextTask.DueDateTime)
+	}, false, false)
+	if len(existing) > 0 {
+		return &existing[0], nil
+	}
+
+	nextTask.Alerts = pendingTaskAlerts(nextTask, s.clock.Now(), nil)
+	s.insertTask(nextTask)
+	return nextTask, nil
+}
+
+// SnoozeTask postpones a task, records the snooze, clears its sent marker and reschedules its alerts
+func (s *MemoryStore) SnoozeTask(task *Task, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.tasks[task.ID]
+	if !ok {
+		return fmt.Errorf("failed to snooze task: %v", errRecordNotFound)
+	}
+
+	s.nextID++
+	s.snoozes = append(s.snoozes, TaskSnooze{
+		ID:              s.nextID,
+		TaskID:          task.ID,
+		FromDueDateTime: task.DueDateTime,
+		ToDueDateTime:   until.UTC(),
+		CreatedAt:       s.clock.Now(),
+	})
+	stored.DueDateTime = until.UTC()
+	stored.ReminderSentAt = nil
+	stored.ClaimedBy = nil
+	stored.ClaimExpiresAt = nil
+	stored.DeliveryAttempts = 0
+	stored.NextRetryAt = nil
+	stored.NagCount = 0
+	stored.NextNagAt = nil
+	stored.UpdatedAt = s.clock.Now()
+	s.replaceTaskAlerts(stored, s.clock.Now())
+	return nil
+}
+
+// RecordTaskMessage remembers that a bot message in a chat belongs to a task
+func (s *MemoryStore) RecordTaskMessage(taskID uint, chatID int64, messageID int, kind string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	s.messages = append(s.messages, TaskMessage{
+		ID:        s.nextID,
+		TaskID:    taskID,
+		ChatID:    chatID,
+		MessageID: messageID,
+		Kind:      kind,
+		CreatedAt: s.clock.Now(),
+	})
+	return nil
+}
+
+// FindTasksByMessage returns the tasks of a user that a bot message belongs to
+func (s *MemoryStore) FindTasksByMessage(userID uint, chatID int64, messageID int) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tasks []Task
+	for _, message := range s.messages {
+		if message.ChatID != chatID || message.MessageID != messageID {
+			continue
+		}
+		if task, ok := s.tasks[message.TaskID]; ok && task.UserID == userID {
+			tasks = append(tasks, *s.loadTask(task, true, false))
+		}
+	}
+	slices.SortFunc(tasks, func(a, b Task) int { return int(a.ID) - int(b.ID) })
+	return tasks, nil
+}
+
+// GetScheduledTasks retrieves every pending task whose reminder wasn't sent or that is still nagging,
+// soonest first, with its alerts
+func (s *MemoryStore) GetScheduledTasks() ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.findTasks(func(t *Task) bool {
+		return t.Status == "pending" && t.IsActive && (t.ReminderSentAt == nil || t.NextNagAt != nil)
+	}, false, false), nil
+}
+
+// ClaimDueTasks claims the pending tasks due by dueBy whose reminder wasn't sent and returns every
+// task workerID holds
+func (s *MemoryStore) ClaimDueTasks(workerID string, dueBy time.Time, lease time.Duration) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now().UTC()
+	expires := now.Add(lease)
+	for _, t := range s.tasks {
+		if t.DueDateTime.After(dueBy) || t.Status != "pending" || !t.IsActive || t.ReminderSentAt != nil ||
+			(t.NextRetryAt != nil && t.NextRetryAt.After(dueBy)) {
+			continue
+		}
+		if t.ClaimedBy == nil || *t.ClaimedBy == workerID || t.ClaimExpiresAt.Before(now) {
+			t.ClaimedBy = &workerID
+			t.ClaimExpiresAt = &expires
+		}
+	}
+
+	return s.findTasks(func(t *Task) bool {
+		return t.ClaimedBy != nil && *t.ClaimedBy == workerID && t.Status == "pending" && t.IsActive && t.ReminderSentAt == nil
+	}, true, false), nil
+}
+
+// MarkTaskReminderSent marks a claimed task as having its reminder sent, records the successful
+// delivery attempt and releases the claim. The reminder is sent again at nextNagAt unless that is
+// nil. It does nothing if the claim was lost.
+func (s *MemoryStore) MarkTaskReminderSent(taskID uint, workerID string, nextNagAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[taskID]
+	if !ok {
+		return fmt.Errorf("failed to mark task reminder as sent: %v", errRecordNotFound)
+	}
+	if task.ClaimedBy == nil || *task.ClaimedBy != workerID {
+		return nil
+	}
+
+	now := s.clock.Now().UTC()
+	s.addAttempt(DeliveryAttempt{TaskID: taskID, Attempt: task.DeliveryAttempts + 1, WorkerID: workerID})
+	task.ReminderSentAt = &now
+	task.ClaimedBy = nil
+	task.ClaimExpiresAt = nil
+	task.DeliveryAttempts = 0
+	task.NextRetryAt = nil
+	task.NagCount = 0
+	task.NextNagAt = nextNagAt
+	task.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+// DeferTaskReminder holds back a claimed task's reminder, or its next nag once the reminder was sent,
+// until the given time and releases the claim
+func (s *MemoryStore) DeferTaskReminder(task *Task, workerID string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.tasks[task.ID]
+	if !ok || stored.ClaimedBy == nil || *stored.ClaimedBy != workerID {
+		return nil
+	}
+	until = until.UTC()
+	if task.ReminderSentAt != nil {
+		stored.NextNagAt = &until
+	} else {
+		stored.NextRetryAt = &until
+	}
+	stored.ClaimedBy = nil
+	stored.ClaimExpiresAt = nil
+	stored.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+// ResumeDeferredReminders makes the user's reminders that were held back for a quiet period due right away
+func (s *MemoryStore) ResumeDeferredReminders(userID uint) ([]uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now().UTC()
+	var taskIDs []uint
+	for _, t := range s.tasks {
+		if t.UserID == userID && t.Status == "pending" && t.IsActive && t.ReminderSentAt == nil &&
+			t.DeliveryAttempts == 0 && t.NextRetryAt != nil && t.NextRetryAt.After(now) {
+			t.NextRetryAt = &now
+			taskIDs = append(taskIDs, t.ID)
+		}
+	}
+	slices.Sort(taskIDs)
+	return taskIDs, nil
+}
+
+// ClaimDueNags claims the pending tasks whose reminder was sent and is due to be sent again by dueBy,
+// and returns every nagging task workerID holds
+func (s *MemoryStore) ClaimDueNags(workerID string, dueBy time.Time, lease time.Duration) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now().UTC()
+	expires := now.Add(lease)
+	for _, t := range s.tasks {
+		if t.NextNagAt == nil || t.NextNagAt.After(dueBy) || t.Status != "pending" || !t.IsActive || t.ReminderSentAt == nil {
+			continue
+		}
+		if t.ClaimedBy == nil || *t.ClaimedBy == workerID || t.ClaimExpiresAt.Before(now) {
+			t.ClaimedBy = &workerID
+			t.ClaimExpiresAt = &expires
+		}
+	}
+
+	tasks := s.findTasks(func(t *Task) bool {
+		return t.ClaimedBy != nil && *t.ClaimedBy == workerID && t.Status == "pending" && t.IsActive &&
+			t.ReminderSentAt != nil && t.NextNagAt != nil
+	}, true, false)
+	slices.SortStableFunc(tasks, func(a, b Task) int { return a.NextNagAt.Compare(*b.NextNagAt) })
+	return tasks, nil
+}
+
+// RecordTaskNag counts a repeat of a claimed task's reminder and releases the claim. A repeat that was
+// sent also moves the sent marker.
+func (s *MemoryStore) RecordTaskNag(taskID uint, workerID string, sent bool, nextNagAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[taskID]
+	if !ok || task.ClaimedBy == nil || *task.ClaimedBy != workerID {
+		return nil
+	}
+	if sent {
+		now := s.clock.Now().UTC()
+		task.ReminderSentAt = &now
+	}
+	task.NagCount++
+	task.NextNagAt = nextNagAt
+	task.ClaimedBy = nil
+	task.ClaimExpiresAt = nil
+	task.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+// RecordDeliveryFailure records a failed delivery attempt and releases the claim. The task is
+// retried at attempt.NextRetryAt, or moves to the failed status if that is nil.
+func (s *MemoryStore) RecordDeliveryFailure(taskID uint, workerID string, attempt *DeliveryAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt.TaskID = taskID
+	attempt.WorkerID = workerID
+	*attempt = s.addAttempt(*attempt)
+
+	task, ok := s.tasks[taskID]
+	if !ok || task.ClaimedBy == nil || *task.ClaimedBy != workerID {
+		return nil
+	}
+	task.DeliveryAttempts = attempt.Attempt
+	task.NextRetryAt = attempt.NextRetryAt
+	task.ClaimedBy = nil
+	task.ClaimExpiresAt = nil
+	if attempt.NextRetryAt == nil {
+		task.Status = "failed"
+	}
+	task.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+// GetFailedTasks retrieves every task whose reminder gave up after failed delivery attempts, newest first
+func (s *MemoryStore) GetFailedTasks() ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks := s.findTasks(func(t *Task) bool { return t.Status == "failed" }, true, false)
+	slices.Reverse(tasks)
+	return tasks, nil
+}
+
+// GetDeliveryAttempts retrieves the delivery attempts of a task, oldest first
+func (s *MemoryStore) GetDeliveryAttempts(taskID uint) ([]DeliveryAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var attempts []DeliveryAttempt
+	for _, attempt := range s.attempts {
+		if attempt.TaskID == taskID {
+			attempts = append(attempts, attempt)
+		}
+	}
+	return attempts, nil
+}
+
+// ReplayTask moves a failed task back to pending with a fresh set of attempts, to be sent right away
+func (s *MemoryStore) ReplayTask(taskID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[taskID]
+	if !ok || task.Status != "failed" {
+		return fmt.Errorf("failed to replay task %d: it is not a failed reminder", taskID)
+	}
+	now := s.clock.Now().UTC()
+	task.Status = "pending"
+	task.IsActive = true
+	task.ReminderSentAt = nil
+	task.DeliveryAttempts = 0
+	task.NextRetryAt = &now
+	task.NagCount = 0
+	task.NextNagAt = nil
+	task.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+// ClaimDueAlerts claims the alerts due by dueBy that weren't sent, of pending tasks that are still
+// ahead of dueBy, and returns every alert workerID holds with its task and user
+func (s *MemoryStore) ClaimDueAlerts(workerID string, dueBy time.Time, lease time.Duration) ([]TaskAlert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now().UTC()
+	expires := now.Add(lease)
+	for i := range s.alerts {
+		a := &s.alerts[i]
+		if a.AlertAt.After(dueBy) || a.SentAt != nil || a.FailedAt != nil || (a.NextRetryAt != nil && a.NextRetryAt.After(dueBy)) {
+			continue
+		}
+		task, ok := s.tasks[a.TaskID]
+		if !ok || task.Status != "pending" || !task.IsActive || task.ReminderSentAt != nil || !task.DueDateTime.After(dueBy) {
+			continue
+		}
+		if a.ClaimedBy == nil || *a.ClaimedBy == workerID || a.ClaimExpiresAt.Before(now) {
+			a.ClaimedBy = &workerID
+			a.ClaimExpiresAt = &expires
+		}
+	}
+
+	var alerts []TaskAlert
+	for _, a := range s.alerts {
+		if a.ClaimedBy == nil || *a.ClaimedBy != workerID || a.SentAt != nil || a.FailedAt != nil {
+			continue
+		}
+		if task, ok := s.tasks[a.TaskID]; ok {
+			a.Task = *s.loadTask(task, true, false)
+			alerts = append(alerts, a)
+		}
+	}
+	slices.SortFunc(alerts, func(a, b TaskAlert) int {
+		if c := a.AlertAt.Compare(b.AlertAt); c != 0 {
+			return c
+		}
+		return int(a.ID) - int(b.ID)
+	})
+	return alerts, nil
+}
+
+// MarkAlertSent marks a claimed alert as sent and releases the claim. It does nothing if the claim
+// was lost.
+func (s *MemoryStore) MarkAlertSent(alertID uint, workerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.alertByID(alertID)
+	if a == nil || a.ClaimedBy == nil || *a.ClaimedBy != workerID {
+		return nil
+	}
+	now := s.clock.Now().UTC()
+	a.SentAt = &now
+	a.ClaimedBy = nil
+	a.ClaimExpiresAt = nil
+	a.NextRetryAt = nil
+	return nil
+}
+
+// RecordAlertFailure stores a failed attempt to send a claimed alert and releases the claim. The
+// alert is retried at alert.NextRetryAt, or given up if that is nil.
+func (s *MemoryStore) RecordAlertFailure(alert *TaskAlert, workerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.alertByID(alert.ID)
+	if a == nil || a.ClaimedBy == nil || *a.ClaimedBy != workerID {
+		return nil
+	}
+	a.Attempts = alert.Attempts
+	a.NextRetryAt = alert.NextRetryAt
+	a.ClaimedBy = nil
+	a.ClaimExpiresAt = nil
+	if alert.NextRetryAt == nil {
+		now := s.clock.Now().UTC()
+		a.FailedAt = &now
+	}
+	return nil
+}
+
+// GetLastRemindedTask returns the user's pending task whose reminder was sent most recently
+func (s *MemoryStore) GetLastRemindedTask(userID uint) (*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var last *Task
+	for _, task := range s.tasks {
+		if task.UserID != userID || task.Status != "pending" || !task.IsActive || task.ReminderSentAt == nil {
+			continue
+		}
+		if last == nil || task.ReminderSentAt.After(*last.ReminderSentAt) {
+			last = task
+		}
+	}
+	if last == nil {
+		return nil, fmt.Errorf("failed to get last reminded task: %v", errRecordNotFound)
+	}
+	return s.loadTask(last, false, false), nil
+}
+
+// Close does nothing; the data is simply dropped with the store
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) userByTelegramID(telegramID int64) *User {
+	for _, user := range s.users {
+		if user.TelegramID == telegramID {
+			return user
+		}
+	}
+	return nil
+}
+
+// insertTask assigns the task and its alerts IDs and stores copies of them
+func (s *MemoryStore) insertTask(task *Task) {
+	s.nextTaskID++
+	now := s.clock.Now()
+	task.ID = s.nextTaskID
+	task.CreatedAt = now
+	task.UpdatedAt = now
+	for i := range task.Alerts {
+		task.Alerts[i].TaskID = task.ID
+		task.Alerts[i] = s.addAlert(task.Alerts[i])
+	}
+
+	stored := *task
+	stored.Alerts = nil
+	s.tasks[task.ID] = &stored
+}
+
+// addAlert stores an alert and returns it with its ID and timestamp set
+func (s *MemoryStore) addAlert(alert TaskAlert) TaskAlert {
+	s.nextID++
+	alert.ID = s.nextID
+	alert.CreatedAt = s.clock.Now()
+	s.alerts = append(s.alerts, alert)
+	return alert
+}
+
+// alertByID returns the stored alert with the given ID, or nil
+func (s *MemoryStore) alertByID(alertID uint) *TaskAlert {
+	for i := range s.alerts {
+		if s.alerts[i].ID == alertID {
+			return &s.alerts[i]
+		}
+	}
+	return nil
+}
+
+// replaceTaskAlerts drops the alerts of a stored task that weren't sent and creates them again for
+// its current due time and alert offsets, see the GormStore version
+func (s *MemoryStore) replaceTaskAlerts(task *Task, now time.Time) {
+	var sent []TaskAlert
+	s.alerts = slices.DeleteFunc(s.alerts, func(a TaskAlert) bool {
+		if a.TaskID != task.ID {
+			return false
+		}
+		if a.SentAt != nil {
+			sent = append(sent, a)
+			return false
+		}
+		return true
+	})
+	for _, alert := range pendingTaskAlerts(task, now, sent) {
+		s.addAlert(alert)
+	}
+}
+
+// updateTask applies update to a stored task
+func (s *MemoryStore) updateTask(taskID uint, update func(t *Task)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[taskID]
+	if !ok {
+		return fmt.Errorf("failed to update task: %v", errRecordNotFound)
+	}
+	update(task)
+	task.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+// findTasks returns copies of the tasks matching keep, ordered by due time and ID
+func (s *MemoryStore) findTasks(keep func(t *Task) bool, withUser, withSnoozes bool) []Task {
+	var tasks []Task
+	for _, task := range s.tasks {
+		if keep(task) {
+			tasks = append(tasks, *s.loadTask(task, withUser, withSnoozes))
+		}
+	}
+	slices.SortFunc(tasks, func(a, b Task) int {
+		if c := a.DueDateTime.Compare(b.DueDateTime); c != 0 {
+			return c
+		}
+		return int(a.ID) - int(b.ID)
+	})
+	return tasks
+}
+
+// addAttempt stores a delivery attempt and returns it with its ID and timestamp set
+func (s *MemoryStore) addAttempt(attempt DeliveryAttempt) DeliveryAttempt {
+	s.nextID++
+	attempt.ID = s.nextID
+	attempt.CreatedAt = s.clock.Now()
+	s.attempts = append(s.attempts, attempt)
+	return attempt
+}
+
+// loadTask returns a copy of a stored task with its alerts, and its user and snooze history on request
+func (s *MemoryStore) loadTask(task *Task, withUser, withSnoozes bool) *Task {
+	copied := *task
+	copied.User = User{}
+	copied.Snoozes = nil
+	copied.Alerts = nil
+	for _, alert := range s.alerts {
+		if alert.TaskID == task.ID {
+			copied.Alerts = append(copied.Alerts, alert)
+		}
+	}
+	if withUser {
+		if user, ok := s.users[task.UserID]; ok {
+			copied.User = *user
+		}
+	}
+	if withSnoozes {
+		for _, snooze := range s.snoozes {
+			if snooze.TaskID == task.ID {
+				copied.Snoozes = append(copied.Snoozes, snooze)
+			}
+		}
+	}
+	return &copied
+}
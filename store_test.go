@@ -0,0 +1,522 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testWorker = "worker-a"
+
+// testStart is where the fake clock of store tests starts
+var testStart = time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+
+// forEachStore runs a test against every Store implementation: the memory store, GORM on in-memory
+// SQLite and, when DATABASE_URL points at Postgres, GORM on a throwaway schema in that database.
+func forEachStore(t *testing.T, test func(t *testing.T, store Store, clock *FakeClock)) {
+	t.Run("memory", func(t *testing.T) {
+		clock := NewFakeClock(testStart)
+		test(t, NewMemoryStore(clock), clock)
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		clock := NewFakeClock(testStart)
+		test(t, NewGormStore(openTestDatabase(t, "sqlite::memory:"), clock), clock)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		clock := NewFakeClock(testStart)
+		test(t, NewGormStore(openTestDatabase(t, postgresTestURL(t)), clock), clock)
+	})
+}
+
+// openTestDatabase opens a database at the latest schema version, with SQL logging turned off
+func openTestDatabase(t *testing.T, databaseURL string) *gorm.DB {
+	t.Helper()
+	db := openUnmigratedTestDatabase(t, databaseURL)
+	if err := MigrateTo(db, LatestSchemaVersion(), NewFakeClock(testStart)); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+// openUnmigratedTestDatabase opens a database without touching its schema
+func openUnmigratedTestDatabase(t *testing.T, databaseURL string) *gorm.DB {
+	t.Helper()
+	db, err := openDatabase(databaseURL)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.Logger = db.Logger.LogMode(logger.Silent)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// postgresTestURL creates an empty schema in the Postgres database at DATABASE_URL, dropped again
+// when the test ends, and returns a URL that works in it. It skips the test without DATABASE_URL.
+func postgresTestURL(t *testing.T) string {
+	t.Helper()
+	databaseURL := os.Getenv("DATABASE_URL")
+	if !strings.HasPrefix(databaseURL, "postgres://") && !strings.HasPrefix(databaseURL, "postgresql://") {
+		t.Skip("set DATABASE_URL to a Postgres database to run the Postgres store tests")
+	}
+
+	admin := openUnmigratedTestDatabase(t, databaseURL)
+	schema := fmt.Sprintf("goremindbot_test_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := admin.Exec("DROP SCHEMA " + schema + " CASCADE").Error; err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	separator := "?"
+	if strings.Contains(databaseURL, "?") {
+		separator = "&"
+	}
+	return databaseURL + separator + "search_path=" + schema
+}
+
+// newStoreTask creates a user in UTC and a task of theirs due at the given UTC time
+func newStoreTask(t *testing.T, store Store, payload ReminderPayload) *Task {
+	t.Helper()
+	user, err := store.GetOrCreateUser(testUserID, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if payload.Type == "" {
+		payload.Type = "task"
+	}
+	if payload.Timezone == "" {
+		payload.Timezone = "UTC"
+	}
+	task, err := store.CreateTask(user.ID, &payload)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	return task
+}
+
+// taskIDs returns the IDs of tasks in order
+func taskIDs(tasks []Task) []uint {
+	ids := make([]uint, len(tasks))
+	for i := range tasks {
+		ids[i] = tasks[i].ID
+	}
+	return ids
+}
+
+func TestMigrations(t *testing.T) {
+	urls := map[string]func(t *testing.T) string{
+		"sqlite":   func(t *testing.T) string { return "sqlite::memory:" },
+		"postgres": postgresTestURL,
+	}
+	for name, url := range urls {
+		t.Run(name, func(t *testing.T) {
+			db := openUnmigratedTestDatabase(t, url(t))
+			latest := LatestSchemaVersion()
+			clock := NewFakeClock(testStart)
+
+			// Every version can be reached going up and coming back down one step at a time
+			for version := 1; version <= latest; version++ {
+				if err := MigrateTo(db, version, clock); err != nil {
+					t.Fatalf("MigrateTo(%d) error = %v", version, err)
+				}
+			}
+			for version := latest - 1; version >= 0; version-- {
+				if err := MigrateTo(db, version, clock); err != nil {
+					t.Fatalf("MigrateTo(%d) error = %v", version, err)
+				}
+				if got, err := SchemaVersion(db); err != nil || got != version {
+					t.Fatalf("SchemaVersion() = %d, %v, want %d", got, err, version)
+				}
+				// Reverting a migration keeps the indexes of the tables it changes
+				if version > 0 && !db.Migrator().HasIndex(&v1Task{}, "idx_tasks_due_date_time") {
+					t.Fatalf("tasks lost their due_date_time index at version %d", version)
+				}
+			}
+			if db.Migrator().HasTable("tasks") {
+				t.Errorf("tasks table is left at version 0")
+			}
+
+			clock.Advance(time.Hour)
+			if err := MigrateTo(db, latest, clock); err != nil {
+				t.Fatalf("MigrateTo(%d) error = %v", latest, err)
+			}
+			var applied []SchemaMigration
+			if err := db.Order("version").Find(&applied).Error; err != nil || len(applied) != latest {
+				t.Fatalf("applied migrations = %+v, %v, want %d", applied, err, latest)
+			}
+			for _, m := range applied {
+				if !m.AppliedAt.Equal(clock.Now()) {
+					t.Errorf("migration %d was applied at %v, want %v", m.Version, m.AppliedAt, clock.Now())
+				}
+			}
+			// Running it again is a no-op
+			if err := MigrateTo(db, latest, clock); err != nil {
+				t.Fatalf("MigrateTo(%d) again error = %v", latest, err)
+			}
+			if err := MigrateTo(db, latest+1, clock); err == nil {
+				t.Errorf("MigrateTo(%d) succeeded, want an unknown version error", latest+1)
+			}
+
+			// The migrated schema is the one the store works with
+			store := NewGormStore(db, clock)
+			newStoreTask(t, store, ReminderPayload{Title: "Call mom", Datetime: "2026-10-17T09:00:00", Alerts: []string{"1h"}, NagEvery: "10m"})
+		})
+	}
+}
+
+func TestMigrationsRefuseNewerSchema(t *testing.T) {
+	db := openTestDatabase(t, "sqlite::memory:")
+	if err := db.Create(&SchemaMigration{Version: LatestSchemaVersion() + 1, Name: "from the future", AppliedAt: testStart}).Error; err != nil {
+		t.Fatalf("failed to record migration: %v", err)
+	}
+	if err := CheckSchemaVersion(db); err == nil {
+		t.Errorf("CheckSchemaVersion() accepted a newer schema")
+	}
+}
+
+func TestStoreClaimDueTasks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, clock *FakeClock) {
+		overdue := newStoreTask(t, store, ReminderPayload{Title: "Overdue", Datetime: "2026-10-17T07:00:00"})
+		due := newStoreTask(t, store, ReminderPayload{Title: "Due", Datetime: "2026-10-17T08:00:00"})
+		newStoreTask(t, store, ReminderPayload{Title: "Later", Datetime: "2026-10-17T09:00:00"})
+		cancelled := newStoreTask(t, store, ReminderPayload{Title: "Cancelled", Datetime: "2026-10-17T07:30:00"})
+		if err := store.CancelTask(cancelled.ID); err != nil {
+			t.Fatalf("CancelTask() error = %v", err)
+		}
+
+		claimed, err := store.ClaimDueTasks(testWorker, clock.Now(), time.Minute)
+		if err != nil {
+			t.Fatalf("ClaimDueTasks() error = %v", err)
+		}
+		if got, want := taskIDs(claimed), []uint{overdue.ID, due.ID}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("claimed %v, want %v", got, want)
+		}
+		if claimed[0].User.TelegramID != testUserID {
+			t.Errorf("claimed task has user %+v, want it loaded", claimed[0].User)
+		}
+
+		// Claiming again renews the claim and returns the same tasks
+		again, err := store.ClaimDueTasks(testWorker, clock.Now(), time.Minute)
+		if err != nil || fmt.Sprint(taskIDs(again)) != fmt.Sprint(taskIDs(claimed)) {
+			t.Errorf("claiming again = %v, %v, want %v", taskIDs(again), err, taskIDs(claimed))
+		}
+	})
+}
+
+func TestStoreMarkTaskReminderSent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, clock *FakeClock) {
+		task := newStoreTask(t, store, ReminderPayload{Title: "Call mom", Datetime: "2026-10-17T08:00:00"})
+		if _, err := store.ClaimDueTasks(testWorker, clock.Now(), time.Minute); err != nil {
+			t.Fatalf("ClaimDueTasks() error = %v", err)
+		}
+
+		nextNag := clock.Now().Add(10 * time.Minute)
+		if err := store.MarkTaskReminderSent(task.ID, testWorker, &nextNag); err != nil {
+			t.Fatalf("MarkTaskReminderSent() error = %v", err)
+		}
+
+		got, err := store.GetUserTask(task.UserID, task.ID)
+		if err != nil {
+			t.Fatalf("GetUserTask() error = %v", err)
+		}
+		switch {
+		case got.ReminderSentAt == nil || !got.ReminderSentAt.Equal(clock.Now()):
+			t.Errorf("ReminderSentAt = %v, want %v", got.ReminderSentAt, clock.Now())
+		case got.ClaimedBy != nil || got.ClaimExpiresAt != nil:
+			t.Errorf("claim = %v until %v, want it released", got.ClaimedBy, got.ClaimExpiresAt)
+		case got.NextNagAt == nil || !got.NextNagAt.Equal(nextNag):
+			t.Errorf("NextNagAt = %v, want %v", got.NextNagAt, nextNag)
+		}
+
+		attempts, err := store.GetDeliveryAttempts(task.ID)
+		if err != nil || len(attempts) != 1 || attempts[0].Attempt != 1 || attempts[0].WorkerID != testWorker || attempts[0].ErrorClass != "" {
+			t.Errorf("delivery attempts = %+v, %v, want one successful attempt", attempts, err)
+		}
+
+		// A sent reminder isn't claimed again
+		claimed, err := store.ClaimDueTasks(testWorker, clock.Now(), time.Minute)
+		if err != nil || len(claimed) != 0 {
+			t.Errorf("claimed %v, %v after the reminder was sent", taskIDs(claimed), err)
+		}
+	})
+}
+
+func TestStoreScheduleNextOccurrence(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, clock *FakeClock) {
+		daily := "FREQ=DAILY;COUNT=2"
+		first := newStoreTask(t, store, ReminderPayload{Title: "Stretch", Datetime: "2026-10-17T08:00:00", Recurrence: &daily, Alerts: []string{"30m"}})
+
+		next, err := store.ScheduleNextOccurrence(first)
+		if err != nil || next == nil {
+			t.Fatalf("ScheduleNextOccurrence() = %v, %v", next, err)
+		}
+		if want := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC); !next.DueDateTime.Equal(want) {
+			t.Errorf("next occurrence is due %v, want %v", next.DueDateTime, want)
+		}
+		if next.SeriesKey() != first.ID || next.Status != "pending" || next.AlertOffsets != "30m" {
+			t.Errorf("next occurrence = series %d, %s, alerts %q", next.SeriesKey(), next.Status, next.AlertOffsets)
+		}
+
+		// Scheduling the same occurrence twice returns the task that is already there
+		again, err := store.ScheduleNextOccurrence(first)
+		if err != nil || again == nil || again.ID != next.ID {
+			t.Errorf("scheduling again = %v, %v, want task %d", again, err, next.ID)
+		}
+
+		// COUNT=2 ends the series after the second occurrence
+		clock.Advance(24 * time.Hour)
+		if last, err := store.ScheduleNextOccurrence(next); err != nil || last != nil {
+			t.Errorf("ScheduleNextOccurrence() after the last occurrence = %v, %v, want nil", last, err)
+		}
+	})
+}
+
+func TestStoreEditOccurrenceOfCountSeries(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, clock *FakeClock) {
+		daily := "FREQ=DAILY;COUNT=3"
+		first := newStoreTask(t, store, ReminderPayload{Title: "Stretch", Datetime: "2026-10-17T08:00:00", Recurrence: &daily})
+		second, err := store.ScheduleNextOccurrence(first)
+		if err != nil || second == nil {
+			t.Fatalf("ScheduleNextOccurrence() = %v, %v", second, err)
+		}
+
+		// Moving the second occurrence keeps the series anchored at the first one
+		edit := &ReminderPayload{Type: "task", Title: "Stretch", Datetime: "2026-10-18T10:00:00", Timezone: "UTC", Recurrence: &daily}
+		if err := store.UpdateTaskFromPayload(second, edit); err != nil {
+			t.Fatalf("UpdateTaskFromPayload() error = %v", err)
+		}
+		edited, err := store.GetUserTask(second.UserID, second.ID)
+		if err != nil {
+			t.Fatalf("GetUserTask() error = %v", err)
+		}
+		if want := first.Recurrence; edited.Recurrence == nil || *edited.Recurrence != *want {
+			t.Errorf("edited recurrence = %v, want %q", edited.Recurrence, *want)
+		}
+
+		// so the third occurrence is still the last, at the series' time of day
+		third, err := store.ScheduleNextOccurrence(edited)
+		if err != nil || third == nil {
+			t.Fatalf("ScheduleNextOccurrence() = %v, %v", third, err)
+		}
+		if want := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC); !third.DueDateTime.Equal(want) {
+			t.Errorf("third occurrence is due %v, want %v", third.DueDateTime, want)
+		}
+		clock.Advance(48 * time.Hour)
+		if last, err := store.ScheduleNextOccurrence(third); err != nil || last != nil {
+			t.Errorf("ScheduleNextOccurrence() after the third occurrence = %v, %v, want nil", last, err)
+		}
+	})
+}
+
+// claimKinds are the three kinds of work the scheduler claims, each with a way to set up one item
+// that is due on the clock and to claim the items due by then, returning the claimed IDs
+var claimKinds = []struct {
+	name  string
+	setup func(t *testing.T, store Store, clock *FakeClock) uint
+	claim func(store Store, worker string, dueBy time.Time) ([]uint, error)
+}{
+	{
+		name: "tasks",
+		setup: func(t *testing.T, store Store, clock *FakeClock) uint {
+			return newStoreTask(t, store, ReminderPayload{Title: "Call mom", Datetime: "2026-10-17T08:00:00"}).ID
+		},
+		claim: func(store Store, worker string, dueBy time.Time) ([]uint, error) {
+			tasks, err := store.ClaimDueTasks(worker, dueBy, time.Minute)
+			return taskIDs(tasks), err
+		},
+	},
+	{
+		name: "nags",
+		setup: func(t *testing.T, store Store, clock *FakeClock) uint {
+			task := newStoreTask(t, store, ReminderPayload{Title: "Call mom", Datetime: "2026-10-17T07:50:00", NagEvery: "10m"})
+			if _, err := store.ClaimDueTasks("setup", clock.Now(), time.Minute); err != nil {
+				t.Fatalf("ClaimDueTasks() error = %v", err)
+			}
+			if err := store.MarkTaskReminderSent(task.ID, "setup", &testStart); err != nil {
+				t.Fatalf("MarkTaskReminderSent() error = %v", err)
+			}
+			return task.ID
+		},
+		claim: func(store Store, worker string, dueBy time.Time) ([]uint, error) {
+			tasks, err := store.ClaimDueNags(worker, dueBy, time.Minute)
+			return taskIDs(tasks), err
+		},
+	},
+	{
+		name: "alerts",
+		setup: func(t *testing.T, store Store, clock *FakeClock) uint {
+			// Alerts that are already due when the task is created are skipped, so this one
+			// comes due by moving the clock
+			task := newStoreTask(t, store, ReminderPayload{Title: "Call mom", Datetime: "2026-10-17T10:00:00", Alerts: []string{"1h"}})
+			clock.Advance(time.Hour)
+			loaded, err := store.GetUserTask(task.UserID, task.ID)
+			if err != nil || len(loaded.Alerts) != 1 {
+				t.Fatalf("GetUserTask() = %+v, %v, want a task with one alert", loaded, err)
+			}
+			return loaded.Alerts[0].ID
+		},
+		claim: func(store Store, worker string, dueBy time.Time) ([]uint, error) {
+			alerts, err := store.ClaimDueAlerts(worker, dueBy, time.Minute)
+			ids := make([]uint, len(alerts))
+			for i := range alerts {
+				ids[i] = alerts[i].ID
+			}
+			return ids, err
+		},
+	},
+}
+
+func TestStoreClaimsAreExclusive(t *testing.T) {
+	for _, kind := range claimKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			forEachStore(t, func(t *testing.T, store Store, clock *FakeClock) {
+				id := kind.setup(t, store, clock)
+
+				// Workers race for the same due row and exactly one of them gets it
+				workers := []string{"worker-a", "worker-b", "worker-c", "worker-d"}
+				claims := make([][]uint, len(workers))
+				errs := make([]error, len(workers))
+				var wg sync.WaitGroup
+				for i, worker := range workers {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						claims[i], errs[i] = kind.claim(store, worker, clock.Now())
+					}()
+				}
+				wg.Wait()
+
+				winners := 0
+				for i := range workers {
+					if errs[i] != nil {
+						t.Fatalf("%s failed to claim: %v", workers[i], errs[i])
+					}
+					switch fmt.Sprint(claims[i]) {
+					case fmt.Sprint([]uint{id}):
+						winners++
+					case "[]":
+					default:
+						t.Errorf("%s claimed %v, want [%d] or nothing", workers[i], claims[i], id)
+					}
+				}
+				if winners != 1 {
+					t.Errorf("%d workers claimed %d, want exactly one", winners, id)
+				}
+			})
+		})
+	}
+}
+
+func TestStoreReclaimsExpiredLeases(t *testing.T) {
+	for _, kind := range claimKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			forEachStore(t, func(t *testing.T, store Store, clock *FakeClock) {
+				id := kind.setup(t, store, clock)
+				if got, err := kind.claim(store, "worker-a", clock.Now()); err != nil || len(got) != 1 {
+					t.Fatalf("worker-a claimed %v, %v, want [%d]", got, err, id)
+				}
+
+				// The lease holds while worker-a may still be sending
+				clock.Advance(time.Minute)
+				if got, err := kind.claim(store, "worker-b", clock.Now()); err != nil || len(got) != 0 {
+					t.Fatalf("worker-b claimed %v, %v before the lease expired", got, err)
+				}
+
+				// Once it expires, as when worker-a crashed, another worker takes over
+				clock.Advance(time.Second)
+				if got, err := kind.claim(store, "worker-b", clock.Now()); err != nil || fmt.Sprint(got) != fmt.Sprint([]uint{id}) {
+					t.Fatalf("worker-b claimed %v, %v after the lease expired, want [%d]", got, err, id)
+				}
+				if got, err := kind.claim(store, "worker-a", clock.Now()); err != nil || len(got) != 0 {
+					t.Errorf("worker-a still holds %v, %v after losing its lease", got, err)
+				}
+			})
+		})
+	}
+}
+
+func TestStoreMarkTaskReminderSentAfterLosingClaim(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, clock *FakeClock) {
+		task := newStoreTask(t, store, ReminderPayload{Title: "Call mom", Datetime: "2026-10-17T08:00:00"})
+		if _, err := store.ClaimDueTasks("worker-a", clock.Now(), time.Minute); err != nil {
+			t.Fatalf("ClaimDueTasks() error = %v", err)
+		}
+		clock.Advance(2 * time.Minute)
+		if _, err := store.ClaimDueTasks("worker-b", clock.Now(), time.Minute); err != nil {
+			t.Fatalf("ClaimDueTasks() error = %v", err)
+		}
+
+		// worker-a finishes late: its success isn't an error, but it doesn't count either
+		if err := store.MarkTaskReminderSent(task.ID, "worker-a", nil); err != nil {
+			t.Fatalf("MarkTaskReminderSent() error = %v, want nil", err)
+		}
+		got, err := store.GetUserTask(task.UserID, task.ID)
+		if err != nil {
+			t.Fatalf("GetUserTask() error = %v", err)
+		}
+		if got.ReminderSentAt != nil || got.ClaimedBy == nil || *got.ClaimedBy != "worker-b" {
+			t.Errorf("task was sent at %v and claimed by %v, want it unsent and held by worker-b", got.ReminderSentAt, got.ClaimedBy)
+		}
+		if attempts, err := store.GetDeliveryAttempts(task.ID); err != nil || len(attempts) != 0 {
+			t.Errorf("delivery attempts = %+v, %v, want none", attempts, err)
+		}
+
+		// The same goes for a claim lost to a snooze
+		if err := store.SnoozeTask(got, clock.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("SnoozeTask() error = %v", err)
+		}
+		if err := store.MarkTaskReminderSent(task.ID, "worker-b", nil); err != nil {
+			t.Fatalf("MarkTaskReminderSent() error = %v, want nil", err)
+		}
+		if got, err := store.GetUserTask(task.UserID, task.ID); err != nil || got.ReminderSentAt != nil {
+			t.Errorf("snoozed task = %+v, %v, want it unsent", got, err)
+		}
+	})
+}
+
+func TestStoreResumeDeferredReminders(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, clock *FakeClock) {
+		quietEnd := clock.Now().Add(8 * time.Hour)
+		deferred := newStoreTask(t, store, ReminderPayload{Title: "Deferred", Datetime: "2026-10-17T07:00:00"})
+		retrying := newStoreTask(t, store, ReminderPayload{Title: "Retrying", Datetime: "2026-10-17T07:30:00"})
+		if _, err := store.ClaimDueTasks(testWorker, clock.Now(), time.Minute); err != nil {
+			t.Fatalf("ClaimDueTasks() error = %v", err)
+		}
+		if err := store.DeferTaskReminder(deferred, testWorker, quietEnd); err != nil {
+			t.Fatalf("DeferTaskReminder() error = %v", err)
+		}
+		// A retry that happens to wait as long looks the same, except that it counts an attempt
+		retryAt := quietEnd
+		failure := &DeliveryAttempt{Attempt: 1, ErrorClass: DeliveryErrorNetwork, Error: "timeout", NextRetryAt: &retryAt}
+		if err := store.RecordDeliveryFailure(retrying.ID, testWorker, failure); err != nil {
+			t.Fatalf("RecordDeliveryFailure() error = %v", err)
+		}
+
+		resumed, err := store.ResumeDeferredReminders(deferred.UserID)
+		if err != nil || fmt.Sprint(resumed) != fmt.Sprint([]uint{deferred.ID}) {
+			t.Fatalf("ResumeDeferredReminders() = %v, %v, want [%d]", resumed, err, deferred.ID)
+		}
+		claimed, err := store.ClaimDueTasks(testWorker, clock.Now(), time.Minute)
+		if err != nil || fmt.Sprint(taskIDs(claimed)) != fmt.Sprint([]uint{deferred.ID}) {
+			t.Errorf("claimed %v, %v, want only the resumed task %d", taskIDs(claimed), err, deferred.ID)
+		}
+
+		// Nothing is left to resume
+		if resumed, err := store.ResumeDeferredReminders(deferred.UserID); err != nil || len(resumed) != 0 {
+			t.Errorf("resuming again = %v, %v, want nothing", resumed, err)
+		}
+	})
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// FakeTelegram is an in-process fake of the Telegram Bot API on an httptest server. It answers
+// the calls the bot makes the way Telegram would, records every one of them, and hands the bot
+// the updates queued with SendText, Reply and Press. A bot created with NewBot talks to it
+// instead of Telegram, so together with FakeParser and MemoryStore whole conversations can run
+// offline: send "remind me...", wait for the confirmation, let the reminder come due and check
+// it was delivered.
+type FakeTelegram struct {
+	Server *httptest.Server
+	// Bot is the identity answered by getMe
+	Bot tgbotapi.User
+
+	clock Clock // dates messages and calls, like the rest of the bot under test
+
+	mu            sync.Mutex
+	calls         []FakeCall
+	failures      map[string][]FakeFailure
+	messages      []*tgbotapi.Message // messages the bot sent, as last edited
+	updates       []tgbotapi.Update   // updates not yet acknowledged by getUpdates
+	nextMessageID int
+	nextUpdateID  int
+	changed       chan struct{} // closed and replaced whenever a call or update arrives
+	closed        chan struct{}
+}
+
+// FakeCall is one Bot API request received by a FakeTelegram
+type FakeCall struct {
+	Method string
+	Params map[string]string
+	Time   time.Time
+}
+
+// FakeFailure is an error response a FakeTelegram returns instead of handling a call
+type FakeFailure struct {
+	Code        int
+	Description string
+	RetryAfter  int // seconds, sent as the retry_after response parameter
+}
+
+// NewFakeTelegram starts a fake Bot API server that tells the time by clock. Close it when done.
+func NewFakeTelegram(clock Clock) *FakeTelegram {
+	f := &FakeTelegram{
+		clock:    clock,
+		Bot:      tgbotapi.User{ID: 1000, IsBot: true, FirstName: "GoRemindBot", UserName: "goremindbot"},
+		failures: make(map[string][]FakeFailure),
+		changed:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+// Close releases pending long polls and shuts the server down
+func (f *FakeTelegram) Close() {
+	f.mu.Lock()
+	select {
+	case <-f.closed:
+	default:
+		close(f.closed)
+	}
+	f.mu.Unlock()
+	f.Server.Close()
+}
+
+// Endpoint is the API endpoint template to pass to tgbotapi.NewBotAPIWithAPIEndpoint, or to
+// set as TELEGRAM_API_ENDPOINT
+func (f *FakeTelegram) Endpoint() string {
+	return f.Server.URL + "/bot%s/%s"
+}
+
+// NewBot creates a Bot API client that talks to the fake server
+func (f *FakeTelegram) NewBot() (*tgbotapi.BotAPI, error) {
+	return tgbotapi.NewBotAPIWithAPIEndpoint("fake-token", f.Endpoint())
+}
+
+// FailNext makes the next call of method fail with the given error instead of being handled.
+// Calling it again queues further failures for the calls after that.
+func (f *FakeTelegram) FailNext(method string, failure FakeFailure) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[method] = append(f.failures[method], failure)
+}
+
+// SendText queues a text message from a user to the bot in their private chat. Text starting
+// with a slash is marked as a command, as Telegram does.
+func (f *FakeTelegram) SendText(userID int64, text string) tgbotapi.Message {
+	return f.queueMessage(userID, text, nil)
+}
+
+// Reply queues a text message from a user that replies to the bot's message messageID
+func (f *FakeTelegram) Reply(userID int64, messageID int, text string) tgbotapi.Message {
+	f.mu.Lock()
+	replyTo := f.messageCopy(userID, messageID)
+	f.mu.Unlock()
+	return f.queueMessage(userID, text, replyTo)
+}
+
+// Press queues a user pressing the inline button with callback data on the bot's message
+// messageID, and returns the callback query ID the bot should answer
+func (f *FakeTelegram) Press(userID int64, messageID int, data string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextUpdateID++
+	query := &tgbotapi.CallbackQuery{
+		ID:      strconv.Itoa(f.nextUpdateID),
+		From:    f.user(userID),
+		Message: f.messageCopy(userID, messageID),
+		Data:    data,
+	}
+	f.updates = append(f.updates, tgbotapi.Update{UpdateID: f.nextUpdateID, CallbackQuery: query})
+	f.notify()
+	return query.ID
+}
+
+// Calls returns the recorded calls of method in order, or every call if method is empty
+func (f *FakeTelegram) Calls(method string) []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.callsLocked(method)
+}
+
+// WaitForCalls waits until at least n calls of method were made and returns all of them. The
+// timeout is real time, since the calls come from goroutines that run however the clock is set.
+func (f *FakeTelegram) WaitForCalls(method string, n int, timeout time.Duration) ([]FakeCall, error) {
+	deadline := time.After(timeout)
+	for {
+		f.mu.Lock()
+		calls, changed := f.callsLocked(method), f.changed
+		f.mu.Unlock()
+		if len(calls) >= n {
+			return calls, nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return calls, fmt.Errorf("got %d %s %s within %s, want %d", len(calls), method, pluralize(len(calls), "call", "calls"), timeout, n)
+		}
+	}
+}
+
+// Messages returns the messages the bot sent to a chat in order, as last edited
+func (f *FakeTelegram) Messages(chatID int64) []tgbotapi.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var messages []tgbotapi.Message
+	for _, message := range f.messages {
+		if message.Chat.ID == chatID {
+			messages = append(messages, *message)
+		}
+	}
+	return messages
+}
+
+func (f *FakeTelegram) callsLocked(method string) []FakeCall {
+	if method == "" {
+		return slices.Clone(f.calls)
+	}
+	var calls []FakeCall
+	for _, call := range f.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (f *FakeTelegram) queueMessage(userID int64, text string, replyTo *tgbotapi.Message) tgbotapi.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextMessageID++
+	message := &tgbotapi.Message{
+		MessageID:      f.nextMessageID,
+		From:           f.user(userID),
+		Chat:           f.chat(userID),
+		Date:           int(f.clock.Now().Unix()),
+		Text:           text,
+		ReplyToMessage: replyTo,
+	}
+	if strings.HasPrefix(text, "/") {
+		command, _, _ := strings.Cut(text, " ")
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+
+	f.nextUpdateID++
+	f.updates = append(f.updates, tgbotapi.Update{UpdateID: f.nextUpdateID, Message: message})
+	f.notify()
+	return *message
+}
+
+func (f *FakeTelegram) user(userID int64) *tgbotapi.User {
+	return &tgbotapi.User{ID: userID, FirstName: fmt.Sprintf("User %d", userID), LanguageCode: "en"}
+}
+
+func (f *FakeTelegram) chat(chatID int64) *tgbotapi.Chat {
+	return &tgbotapi.Chat{ID: chatID, Type: "private"}
+}
+
+// message returns the bot's message with the given ID in a chat, or nil
+func (f *FakeTelegram) message(chatID int64, messageID int) *tgbotapi.Message {
+	for _, message := range f.messages {
+		if message.Chat.ID == chatID && message.MessageID == messageID {
+			return message
+		}
+	}
+	return nil
+}
+
+// messageCopy returns a copy of the bot's message for an update, so later edits don't change it.
+// A message the fake doesn't know is returned with just its ID and chat.
+func (f *FakeTelegram) messageCopy(chatID int64, messageID int) *tgbotapi.Message {
+	message := f.message(chatID, messageID)
+	if message == nil {
+		return &tgbotapi.Message{MessageID: messageID, Chat: f.chat(chatID)}
+	}
+	copied := *message
+	return &copied
+}
+
+// notify wakes everyone waiting for a call or an update. The caller holds f.mu.
+func (f *FakeTelegram) notify() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// serveHTTP handles /bot<token>/<method> requests
+func (f *FakeTelegram) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+		f.reply(w, nil, &FakeFailure{Code: http.StatusBadRequest, Description: "Bad Request: " + err.Error()})
+		return
+	}
+	call := FakeCall{Method: path.Base(r.URL.Path), Params: make(map[string]string), Time: f.clock.Now()}
+	for name := range r.Form {
+		call.Params[name] = r.Form.Get(name)
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	f.notify()
+	if failures := f.failures[call.Method]; len(failures) > 0 {
+		f.failures[call.Method] = failures[1:]
+		f.mu.Unlock()
+		f.reply(w, nil, &failures[0])
+		return
+	}
+
+	if call.Method == "getUpdates" {
+		f.mu.Unlock()
+		f.reply(w, f.getUpdates(call.Params), nil)
+		return
+	}
+	defer f.mu.Unlock()
+
+	switch call.Method {
+	case "getMe":
+		f.reply(w, f.Bot, nil)
+	case "sendMessage":
+		chatID, _ := strconv.ParseInt(call.Params["chat_id"], 10, 64)
+		f.nextMessageID++
+		message := &tgbotapi.Message{
+			MessageID:   f.nextMessageID,
+			From:        &f.Bot,
+			Chat:        f.chat(chatID),
+			Date:        int(call.Time.Unix()),
+			Text:        call.Params["text"],
+			ReplyMarkup: inlineKeyboard(call.Params["reply_markup"]),
+		}
+		f.messages = append(f.messages, message)
+		f.reply(w, message, nil)
+	case "editMessageText", "editMessageReplyMarkup":
+		chatID, _ := strconv.ParseInt(call.Params["chat_id"], 10, 64)
+		messageID, _ := strconv.Atoi(call.Params["message_id"])
+		message := f.message(chatID, messageID)
+		if message == nil {
+			f.reply(w, nil, &FakeFailure{Code: http.StatusBadRequest, Description: "Bad Request: message to edit not found"})
+			return
+		}
+		if call.Method == "editMessageText" {
+			message.Text = call.Params["text"]
+		}
+		// Like Telegram, an edit without reply_markup removes the inline keyboard
+		message.ReplyMarkup = inlineKeyboard(call.Params["reply_markup"])
+		f.reply(w, message, nil)
+	case "deleteMessage":
+		chatID, _ := strconv.ParseInt(call.Params["chat_id"], 10, 64)
+		messageID, _ := strconv.Atoi(call.Params["message_id"])
+		f.messages = slices.DeleteFunc(f.messages, func(m *tgbotapi.Message) bool {
+			return m.Chat.ID == chatID && m.MessageID == messageID
+		})
+		f.reply(w, true, nil)
+	case "answerCallbackQuery", "setWebhook", "deleteWebhook", "setMyCommands", "sendChatAction":
+		f.reply(w, true, nil)
+	default:
+		f.reply(w, nil, &FakeFailure{Code: http.StatusNotFound, Description: "Not Found: method not supported by FakeTelegram"})
+	}
+}
+
+// getUpdates acknowledges the updates before offset and returns the rest, long polling for up to
+// timeout seconds of real time while there are none, as the bot's HTTP client expects
+func (f *FakeTelegram) getUpdates(params map[string]string) []tgbotapi.Update {
+	offset, _ := strconv.Atoi(params["offset"])
+	timeout, _ := strconv.Atoi(params["timeout"])
+	deadline := time.After(time.Duration(timeout) * time.Second)
+
+	for {
+		f.mu.Lock()
+		f.updates = slices.DeleteFunc(f.updates, func(u tgbotapi.Update) bool { return u.UpdateID < offset })
+		updates, changed := slices.Clone(f.updates), f.changed
+		f.mu.Unlock()
+		if len(updates) > 0 || timeout <= 0 {
+			return updates
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return nil
+		case <-f.closed:
+			return nil
+		}
+	}
+}
+
+// reply writes a Bot API response with the result, or the failure if it is set
+func (f *FakeTelegram) reply(w http.ResponseWriter, result any, failure *FakeFailure) {
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]any{"ok": true, "result": result}
+	if failure != nil {
+		response = map[string]any{"ok": false, "error_code": failure.Code, "description": failure.Description}
+		if failure.RetryAfter > 0 {
+			response["parameters"] = map[string]any{"retry_after": failure.RetryAfter}
+		}
+		w.WriteHeader(failure.Code)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// inlineKeyboard decodes a reply_markup parameter, returning nil unless it is an inline keyboard
+func inlineKeyboard(markup string) *tgbotapi.InlineKeyboardMarkup {
+	var keyboard tgbotapi.InlineKeyboardMarkup
+	if markup == "" || json.Unmarshal([]byte(markup), &keyboard) != nil || len(keyboard.InlineKeyboard) == 0 {
+		return nil
+	}
+	return &keyboard
+}
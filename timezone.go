@@ -44,6 +44,16 @@ func ConvertToUserTimezone(utcTime time.Time, userTimezone string) (time.Time, e
 	return utcTime.In(loc), nil
 }
 
+// LoadTimezone loads a timezone by name, falling back to UTC if it is invalid
+func LoadTimezone(timezone string) *time.Location {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		log.Printf("Invalid timezone %s, falling back to UTC: %v", timezone, err)
+		return time.UTC
+	}
+	return loc
+}
+
 // ConvertFromUserTimezone converts a time from user's timezone to UTC
 func ConvertFromUserTimezone(userTime time.Time, userTimezone string) (time.Time, error) {
 	// Load the user's timezone
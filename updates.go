@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// UpdateSource delivers updates from Telegram. Long polling and webhooks both implement it,
+// so the rest of the bot only sees a channel of updates to hand to the Dispatcher.
+type UpdateSource interface {
+	// Start begins receiving updates and returns the channel they are delivered on
+	Start() (<-chan tgbotapi.Update, error)
+	// Stop stops receiving updates and closes the channel returned by Start
+	Stop(ctx context.Context) error
+}
+
+// NewUpdateSource returns the update source selected by UPDATE_MODE. Registering a webhook
+// needs raw Bot API calls, so it takes the full client rather than a Messenger.
+func NewUpdateSource(bot *tgbotapi.BotAPI, config *Config) UpdateSource {
+	if config.UpdateMode == UpdateModeWebhook {
+		return newWebhookSource(bot, config)
+	}
+	return &pollingSource{bot: bot, done: make(chan struct{}), updates: make(chan tgbotapi.Update)}
+}
+
+// pollingSource receives updates with getUpdates long polling
+type pollingSource struct {
+	bot     Messenger
+	done    chan struct{}
+	updates chan tgbotapi.Update
+}
+
+// Start removes any webhook left over from webhook mode, which would make getUpdates fail,
+// and starts polling
+func (s *pollingSource) Start() (<-chan tgbotapi.Update, error) {
+	if _, err := s.bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return nil, fmt.Errorf("failed to delete webhook: %v", err)
+	}
+
+	// Create a new UpdateConfig struct with an offset of 0. Offsets are used
+	// to make sure Telegram knows we've handled previous values and we don't
+	// need them repeated.
+	updateConfig := tgbotapi.NewUpdate(0)
+
+	// Tell Telegram we should wait up to 30 seconds on each request for an
+	// update. This way we can get information just as quickly as making many
+	// frequent requests without having to send nearly as many.
+	updateConfig.Timeout = 30
+
+	log.Printf("Receiving updates with long polling")
+	polled := s.bot.GetUpdatesChan(updateConfig)
+
+	// Forward updates until Stop, so stopping doesn't wait for the current long poll to return.
+	// Updates already received are still handed over; the ones a pending long poll returns after
+	// Stop are never acknowledged, so Telegram delivers them again on the next start.
+	go func() {
+		defer close(s.updates)
+		for {
+			select {
+			case update, ok := <-polled:
+				if !ok {
+					return
+				}
+				s.updates <- update
+			case <-s.done:
+				for {
+					select {
+					case update, ok := <-polled:
+						if !ok {
+							return
+						}
+						s.updates <- update
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+	return s.updates, nil
+}
+
+// Stop ends polling and closes the updates channel
+func (s *pollingSource) Stop(ctx context.Context) error {
+	s.bot.StopReceivingUpdates()
+	close(s.done)
+	return nil
+}
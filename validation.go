@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ValidateParseResult checks a parse result and every task in it, see ValidatePayload
+func ValidateParseResult(result *ParseResult, now time.Time) error {
+	switch result.Type {
+	case "not_task":
+		return nil
+	case "needs_clarification":
+		return validateClarification(result)
+	case "task":
+	default:
+		return fmt.Errorf(`"type" must be "task", "not_task" or "needs_clarification", got %q`, result.Type)
+	}
+
+	if len(result.Tasks) == 0 {
+		return fmt.Errorf(`"tasks" must contain at least one task when "type" is "task"`)
+	}
+
+	var errs []error
+	for i := range result.Tasks {
+		if err := ValidatePayload(&result.Tasks[i], now); err != nil {
+			errs = append(errs, fmt.Errorf("tasks[%d]: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateClarification checks the question and candidate answers of a needs_clarification result
+func validateClarification(result *ParseResult) error {
+	var errs []error
+	if strings.TrimSpace(result.Question) == "" {
+		errs = append(errs, fmt.Errorf(`"question" is required when "type" is "needs_clarification"`))
+	}
+	if len(result.Options) > maxClarificationOptions {
+		errs = append(errs, fmt.Errorf(`"options" must have at most %d entries, got %d`, maxClarificationOptions, len(result.Options)))
+	}
+	for i, option := range result.Options {
+		if strings.TrimSpace(option) == "" {
+			errs = append(errs, fmt.Errorf("options[%d] must not be empty", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidatePayload checks a parsed reminder strictly before it is turned into a task: the type must be
+// known, and a task needs a title, a parseable datetime in a valid IANA timezone that is not in the
+// past, a recurrence in the supported RRULE grammar, alerts like "30m" or "1d" and a sensible nag
+// policy. All problems are reported together so they can be fed back to the model in one go.
+func ValidatePayload(payload *ReminderPayload, now time.Time) error {
+	return validatePayload(payload, now, true)
+}
+
+// validatePayload is ValidatePayload with the due-time check optional, for edits that keep a past due time
+func validatePayload(payload *ReminderPayload, now time.Time, requireFuture bool) error {
+	var errs []error
+
+	switch payload.Type {
+	case "not_task":
+		return nil
+	case "task":
+	default:
+		return fmt.Errorf(`"type" must be "task" or "not_task", got %q`, payload.Type)
+	}
+
+	if strings.TrimSpace(payload.Title) == "" {
+		errs = append(errs, fmt.Errorf(`"title" must not be empty`))
+	}
+
+	loc, err := time.LoadLocation(payload.Timezone)
+	if payload.Timezone == "" || err != nil {
+		errs = append(errs, fmt.Errorf(`"timezone" must be a valid IANA timezone such as "Asia/Kolkata", got %q`, payload.Timezone))
+		loc = nil
+	}
+
+	due, err := time.Parse("2006-01-02T15:04:05", payload.Datetime)
+	if err != nil {
+		errs = append(errs, fmt.Errorf(`"datetime" must be formatted as 2006-01-02T15:04:05, got %q`, payload.Datetime))
+	} else if loc != nil && requireFuture {
+		due = time.Date(due.Year(), due.Month(), due.Day(), due.Hour(), due.Minute(), 0, 0, loc)
+		if due.Before(now.Truncate(time.Minute)) {
+			errs = append(errs, fmt.Errorf(`"datetime" %s is in the past; the current time is %s`,
+				payload.Datetime, now.In(loc).Format("2006-01-02T15:04:05")))
+		}
+	}
+
+	if payload.Recurrence != nil && strings.TrimSpace(*payload.Recurrence) != "" {
+		if strings.Contains(strings.ToUpper(*payload.Recurrence), "DTSTART") {
+			errs = append(errs, fmt.Errorf(`"recurrence" must be an RRULE without DTSTART`))
+		} else if _, err := ParseRecurrence(*payload.Recurrence, time.UTC); err != nil {
+			errs = append(errs, fmt.Errorf(`"recurrence" is not a supported RRULE: %v`, err))
+		}
+	}
+
+	if _, err := ParseAlertOffsets(payload.Alerts); err != nil {
+		errs = append(errs, fmt.Errorf(`"alerts": %v`, err))
+	}
+
+	if _, _, err := nagPolicy(payload.NagEvery, payload.NagRepeats); err != nil {
+		errs = append(errs, fmt.Errorf(`"nag_every" and "nag_repeats": %v`, err))
+	}
+
+	return errors.Join(errs...)
+}
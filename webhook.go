@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// webhookSecretHeader carries the secret token Telegram sends with every webhook request
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookSource receives updates from Telegram over HTTP. It registers the webhook on Start
+// and deregisters it on Stop.
+type webhookSource struct {
+	bot    *tgbotapi.BotAPI
+	config *Config
+	secret string
+	server *http.Server
+
+	mu      sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	updates chan tgbotapi.Update
+}
+
+func newWebhookSource(bot *tgbotapi.BotAPI, config *Config) *webhookSource {
+	return &webhookSource{
+		bot:     bot,
+		config:  config,
+		secret:  config.WebhookSecret,
+		done:    make(chan struct{}),
+		updates: make(chan tgbotapi.Update, bot.Buffer),
+	}
+}
+
+// Start starts the HTTP server and registers the webhook with Telegram
+func (s *webhookSource) Start() (<-chan tgbotapi.Update, error) {
+	if s.secret == "" {
+		secret, err := randomWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		s.secret = secret
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(s.config.WebhookPath, s.handleUpdate)
+	s.server = &http.Server{
+		Addr:              s.config.WebhookListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// TLS is optional: behind a reverse proxy that terminates HTTPS the server speaks plain HTTP
+	var certPEM []byte
+	switch {
+	case s.config.WebhookTLSCert != "":
+		cert, err := tls.LoadX509KeyPair(s.config.WebhookTLSCert, s.config.WebhookTLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load webhook TLS certificate: %v", err)
+		}
+		s.server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		if s.config.WebhookSelfSigned {
+			certPEM, err = os.ReadFile(s.config.WebhookTLSCert)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read webhook TLS certificate: %v", err)
+			}
+		}
+	case s.config.WebhookSelfSigned:
+		cert, pemBytes, err := selfSignedCertificate(s.config.WebhookURL)
+		if err != nil {
+			return nil, err
+		}
+		s.server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		certPEM = pemBytes
+	}
+
+	listener, err := net.Listen("tcp", s.config.WebhookListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", s.config.WebhookListenAddr, err)
+	}
+	if s.server.TLSConfig != nil {
+		listener = tls.NewListener(listener, s.server.TLSConfig)
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Webhook server stopped: %v", err)
+		}
+	}()
+
+	if err := s.register(certPEM); err != nil {
+		s.server.Close()
+		return nil, err
+	}
+
+	log.Printf("Receiving updates with webhook %s (listening on %s%s, TLS: %t)",
+		s.config.WebhookURL, s.config.WebhookListenAddr, s.config.WebhookPath, s.server.TLSConfig != nil)
+	return s.updates, nil
+}
+
+// register calls setWebhook with the public URL, the secret token and, for self-signed TLS, the certificate
+func (s *webhookSource) register(certPEM []byte) error {
+	params := tgbotapi.Params{
+		"url":          s.config.WebhookURL,
+		"secret_token": s.secret,
+	}
+
+	var err error
+	if certPEM != nil {
+		files := []tgbotapi.RequestFile{{
+			Name: "certificate",
+			Data: tgbotapi.FileBytes{Name: "certificate.pem", Bytes: certPEM},
+		}}
+		_, err = s.bot.UploadFiles("setWebhook", params, files)
+	} else {
+		_, err = s.bot.MakeRequest("setWebhook", params)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set webhook: %v", err)
+	}
+	return nil
+}
+
+// Stop deregisters the webhook, shuts the HTTP server down and closes the updates channel
+func (s *webhookSource) Stop(ctx context.Context) error {
+	var errs []error
+	if _, err := s.bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		errs = append(errs, fmt.Errorf("failed to delete webhook: %v", err))
+	}
+
+	// Unblock handlers waiting on a full channel before waiting for them to finish
+	close(s.done)
+	if s.server != nil {
+		if err := s.server.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to shut down webhook server: %v", err))
+		}
+	}
+
+	s.mu.Lock()
+	s.closed = true
+	close(s.updates)
+	s.mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// handleUpdate accepts one update POSTed by Telegram after checking the secret token
+func (s *webhookSource) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(webhookSecretHeader)), []byte(s.secret)) != 1 {
+		log.Printf("Rejected webhook request from %s: bad secret token", r.RemoteAddr)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	update, err := s.bot.HandleUpdate(r)
+	if err != nil {
+		log.Printf("Rejected webhook request from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	select {
+	case s.updates <- *update:
+		w.WriteHeader(http.StatusOK)
+	case <-s.done:
+		// Telegram retries updates that were not acknowledged
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	}
+}
+
+// randomWebhookSecret generates a secret token for this run
+func randomWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// selfSignedCertificate generates a certificate for the host of the webhook URL and returns it
+// together with its PEM encoding for uploading to Telegram
+func selfSignedCertificate(webhookURL string) (tls.Certificate, []byte, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("invalid webhook URL: %v", err)
+	}
+	host := u.Hostname()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to generate webhook TLS key: %v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to create webhook TLS certificate: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to load webhook TLS certificate: %v", err)
+	}
+	return cert, certPEM, nil
+}